@@ -2,26 +2,41 @@ package main
 
 import (
 	"antdb/config"
+	"antdb/internal/gateway"
+	"antdb/internal/health"
 	"antdb/internal/network"
 	"antdb/internal/prepare"
 	"antdb/internal/service"
 	"antdb/internal/service/compute"
+	"antdb/internal/service/pubsub"
 	"antdb/internal/service/storage"
 	"antdb/internal/service/storage/engine"
 	"antdb/internal/service/storage/replication"
 	"antdb/internal/service/storage/wal"
 	"antdb/internal/tools"
 	"context"
+	"crypto/tls"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"log"
+	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 )
 
+// version задается при сборке: -ldflags "-X main.version=..."
+var version = "dev"
+
+// forceShutdownDelay - сколько после shutdown_timeout ждать остальные компоненты
+const forceShutdownDelay = 5 * time.Second
+
 func main() {
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -36,88 +51,363 @@ func main() {
 		log.Fatal("can't init logger", err)
 	}
 
+	tracerProvider, err := prepare.CreateTracerProvider(ctx, cfg.Tracing)
+	if err != nil {
+		logger.Fatal("can't create tracer provider", zap.Error(err))
+	}
+	if tracerProvider != nil {
+		otel.SetTracerProvider(tracerProvider)
+	}
+
 	maxSegmentSize, err := tools.ParseSize(cfg.WAL.MaxSegmentSize)
 	if err != nil {
 		logger.Fatal("can't parse max segment size", zap.Error(err))
 	}
 
-	buffer := wal.NewBuffer(cfg.WAL.FlushingBatchSize)
-	walWriter := wal.NewWriter(cfg.WAL.DataDirectory, maxSegmentSize, logger)
-	walReader := wal.NewReader(cfg.WAL.DataDirectory, logger)
-	walJournal := wal.NewWAL(walWriter, walReader, buffer, logger)
-
+	// процесс завершается, даже если остановка зависла
 	go func() {
-		if err = walJournal.Start(ctx, cfg.WAL.FlushingBatchTimeout); err != nil {
-			logger.Fatal("can't start wal journal", zap.Error(err))
-		}
+		<-ctx.Done()
+		time.Sleep(cfg.Network.ShutdownTimeout + forceShutdownDelay)
+		logger.Error("shutdown takes too long, exiting")
+		os.Exit(1)
 	}()
 
+	walStopped := make(chan struct{})
+	var walJournal *wal.Wal
+
+	memoryTable := engine.NewMemoryTable()
+
+	// метрики собираются всегда, сервер для них запускается, если он настроен
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		memoryTable)
+	service.RegisterMetrics(registry)
+	wal.RegisterMetrics(registry)
+
+	// проверки добавляются по мере запуска компонентов, до конца восстановления
+	// журнала узел не готов
+	checker := health.NewChecker()
+	recovery := health.NewFlag("wal replay is in progress")
+	checker.Add("recovery", recovery.Check)
+
+	wg := sync.WaitGroup{}
+	if cfg.Metrics != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			metricsServer := gateway.NewMetricsServer(cfg.Metrics.Address, registry, checker, logger,
+				gateway.WithHTTPTimeouts(cfg.Network.IdleTimeout, cfg.Network.ReadTimeout, cfg.Network.WriteTimeout))
+			if err := metricsServer.Start(ctx, cfg.Network.ShutdownTimeout); err != nil {
+				logger.Fatal("can't start metrics server", zap.Error(err))
+			}
+		}()
+	}
+
+	// через хаб идут PUBLISH и события ключей, которые публикует хранилище
+	hub := pubsub.NewHub(cfg.PubSub.BufferSize)
 	streamCh := make(chan []*wal.Unit)
+	var st *storage.Storage
 	var replica replication.Replication
-	if cfg.ReplicationConfig.ReplicaType == "master" {
-		replica, err = prepare.CreateMasterReplication(cfg.ReplicationConfig, cfg.WAL, logger)
+	if cfg.ReplicationConfig.ReplicaType == config.ReplicaTypeRaft {
+		if cfg.WAL.Compaction {
+			logger.Fatal("compaction is not supported with raft replication")
+		}
+
+		replica, err = prepare.CreateRaftReplication(cfg.ReplicationConfig.Raft, cfg.WAL, maxSegmentSize, memoryTable, logger)
 		if err != nil {
-			logger.Fatal("can't create master replication", zap.Error(err))
+			logger.Fatal("can't create raft replication", zap.Error(err))
 		}
+
+		// журнал ведет raft, состояние восстанавливается по мере коммита записей
+		restoreCh := make(chan []*wal.Unit)
+		close(restoreCh)
+		close(walStopped)
+		st = storage.NewStorage(memoryTable, nil, replica, restoreCh, streamCh, logger,
+			storage.WithKeyspaceEvents(hub))
 	} else {
-		replica, err = prepare.CreateSlaveReplication(cfg.ReplicationConfig, cfg.WAL, streamCh, logger)
+		buffer := wal.NewBuffer(cfg.WAL.FlushingBatchSize)
+		walWriter := wal.NewWriter(cfg.WAL.DataDirectory, maxSegmentSize, logger)
+		walReader := wal.NewReader(cfg.WAL.DataDirectory, logger)
+		walJournal = wal.NewWAL(walWriter, walReader, buffer, logger)
+
+		go func() {
+			defer close(walStopped)
+
+			if err := walJournal.Start(ctx, cfg.WAL.FlushingBatchTimeout); err != nil {
+				logger.Fatal("can't start wal journal", zap.Error(err))
+			}
+		}()
+
+		if cfg.ReplicationConfig.ReplicaType == config.ReplicaTypeMaster {
+			replica, err = prepare.CreateMasterReplication(cfg.ReplicationConfig, cfg.WAL, walWriter, logger)
+			if err != nil {
+				logger.Fatal("can't create master replication", zap.Error(err))
+			}
+		} else {
+			slave, err := prepare.CreateSlaveReplication(cfg.ReplicationConfig, cfg.WAL, maxSegmentSize, streamCh, logger)
+			if err != nil {
+				logger.Fatal("can't create slave replication", zap.Error(err))
+			}
+			replica = slave
+
+			// реплика может раздавать полученный журнал своим репликам
+			if cfg.ReplicationConfig.RelayAddress != "" {
+				replica, err = prepare.CreateRelayReplication(cfg.ReplicationConfig, cfg.WAL, slave, logger)
+				if err != nil {
+					logger.Fatal("can't create relay replication", zap.Error(err))
+				}
+			}
+		}
+		st = storage.NewStorage(memoryTable, walJournal, replica, walReader.GetStream(), streamCh, logger,
+			storage.WithKeyspaceEvents(hub))
+	}
+	recovery.Done()
+	checker.Add("wal", func(context.Context) error {
+		return st.CheckWAL()
+	})
+	checker.Add("replication", func(context.Context) error {
+		return st.CheckReplication(cfg.ReplicationConfig.ReadyMaxLag)
+	})
+
+	// raft пишет свой журнал теми же сегментами
+	registry.MustRegister(wal.NewSegmentsCollector(cfg.WAL.DataDirectory))
+	if reporter, ok := replica.(replication.Reporter); ok {
+		registry.MustRegister(replication.NewCollector(reporter))
+	}
+
+	acl, err := prepare.CreateACL(cfg.Security)
+	if err != nil {
+		logger.Fatal("can't create acl", zap.Error(err))
+	}
+	if acl == nil {
+		logger.Warn("authentication is disabled: no users in security config")
+	}
+
+	messageSize, err := tools.ParseSize(cfg.Network.MessageSize)
+	if err != nil {
+		logger.Fatal("can't parse message size", zap.Error(err))
+	}
+
+	// TCP и HTTP серверы используют общие сертификаты
+	var serverTLS *tls.Config
+	if tlsCfg := cfg.Network.TLS; tlsCfg != nil {
+		certificates, err := network.NewReloadableTLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile)
 		if err != nil {
-			logger.Fatal("can't create slave replication", zap.Error(err))
+			logger.Fatal("can't load tls certificates", zap.Error(err))
 		}
+		serverTLS = certificates.Config()
+
+		go reloadCertificates(ctx, certificates, logger)
 	}
+
+	serverOptions := []network.ServerOption{
+		network.WithShutdownTimeout(cfg.Network.ShutdownTimeout),
+		network.WithTimeouts(cfg.Network.IdleTimeout, cfg.Network.ReadTimeout, cfg.Network.WriteTimeout),
+		network.WithOverflowResponse([]byte("[error] too many clients\n")),
+		network.WithDelimiter('\n'),
+	}
+	if serverTLS != nil {
+		serverOptions = append(serverOptions, network.WithTLS(serverTLS))
+	}
+	if cfg.Network.SocketMode != "" {
+		mode, err := strconv.ParseUint(cfg.Network.SocketMode, 8, 32)
+		if err != nil {
+			logger.Fatal("can't parse socket mode", zap.Error(err))
+		}
+		serverOptions = append(serverOptions, network.WithSocketMode(os.FileMode(mode)))
+	}
+
+	tcpServer, err := network.NewServer(cfg.Network.Address, cfg.Network.MaxConnections, messageSize, logger, serverOptions...)
+	if err != nil {
+		logger.Fatal("can't create tcp server", zap.Error(err))
+	}
+	registry.MustRegister(tcpServer)
+
+	// реплики, отставшие от свернутой истории, догоняют мастер через снимок
+	var compaction *wal.Compaction
 	if cfg.WAL.Compaction {
-		logger.Warn("replication be disabled when compaction is enabled")
-		replica = nil
+		compaction = wal.NewCompaction(cfg.WAL.DataDirectory, time.Second*5, logger)
+	}
+
+	limiter, err := prepare.CreateRateLimiter(cfg.Limits)
+	if err != nil {
+		logger.Fatal("can't create rate limiter", zap.Error(err))
+	}
+	dbOptions := []service.DatabaseOption{
+		service.WithSlowLog(service.NewSlowLog(cfg.SlowLog.Threshold, cfg.SlowLog.MaxLen)),
+		service.WithServerInfo(version, configSummary(cfg)),
+		service.WithClients(tcpServer),
+		service.WithPersistence(cfg.WAL.DataDirectory, compaction),
+		service.WithPubSub(hub),
+	}
+	if limiter != nil {
+		dbOptions = append(dbOptions, service.WithRateLimiter(limiter))
+		registry.MustRegister(limiter)
+	}
+	auditLog, err := prepare.CreateAuditLog(cfg.Audit, logger)
+	if err != nil {
+		logger.Fatal("can't create audit log", zap.Error(err))
+	}
+	if auditLog != nil {
+		dbOptions = append(dbOptions, service.WithAuditLog(auditLog))
 	}
 
-	st := storage.NewStorage(engine.NewMemoryTable(), walJournal, replica, walReader.GetStream(), streamCh, logger)
 	cmp := compute.NewCompute(compute.NewParser(), compute.NewAnalyzer(logger), logger)
-	db := service.NewDatabase(cmp, st, logger)
+	db := service.NewDatabase(
+		cmp,
+		st,
+		cfg.ReplicationConfig.ReadWaitTimeout,
+		cfg.ReplicationConfig.RedirectAddress,
+		acl,
+		logger,
+		dbOptions...)
 
-	wg := sync.WaitGroup{}
-	wg.Add(2)
+	wg.Add(3)
 	go func() {
 		defer wg.Done()
 
-		if cfg.WAL.Compaction {
-			compaction := wal.NewCompaction(cfg.WAL.DataDirectory, time.Second*5, logger)
-			err = compaction.Start(ctx)
-			if err != nil {
-				logger.Fatal("can't start compaction", zap.Error(err))
-			}
-		} else {
-			err = replica.Start(ctx)
-			if err != nil {
-				logger.Fatal("can't start slave replication", zap.Error(err))
-			}
+		if compaction == nil {
+			return
+		}
+
+		if err := compaction.Start(ctx); err != nil {
+			logger.Fatal("can't start compaction", zap.Error(err))
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
 
-		messageSize, err := tools.ParseSize(cfg.Network.MessageSize)
-		if err != nil {
-			logger.Fatal("can't parse message size", zap.Error(err))
+		if err := replica.Start(ctx); err != nil {
+			logger.Fatal("can't start replication", zap.Error(err))
 		}
+	}()
 
-		tcpServer, err := network.NewServer(cfg.Network.Address, cfg.Network.MaxConnections, messageSize, logger)
-		if err != nil {
-			logger.Fatal("can't create tcp server", zap.Error(err))
-		}
+	go func() {
+		defer wg.Done()
 
-		err = tcpServer.Start(ctx, func(ctx context.Context, s []byte) []byte {
+		err := tcpServer.Start(ctx, func(ctx context.Context, s []byte) []byte {
 			return []byte(db.HandleQuery(ctx, string(s)) + "\n")
 		})
 		if err != nil {
 			logger.Fatal("can't start tcp server", zap.Error(err))
 		}
-
 	}()
 
+	if cfg.HTTP != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			options := []gateway.HTTPOption{
+				gateway.WithHTTPTimeouts(cfg.Network.IdleTimeout, cfg.Network.ReadTimeout, cfg.Network.WriteTimeout),
+			}
+			if serverTLS != nil {
+				options = append(options, gateway.WithHTTPTLS(serverTLS))
+			}
+
+			httpServer, err := gateway.NewHTTPServer(cfg.HTTP.Address, messageSize, db, logger, options...)
+			if err != nil {
+				logger.Fatal("can't create http server", zap.Error(err))
+			}
+			if err = httpServer.Start(ctx, cfg.Network.ShutdownTimeout); err != nil {
+				logger.Fatal("can't start http server", zap.Error(err))
+			}
+		}()
+	}
+
+	if cfg.GRPC != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			options := []gateway.GRPCOption{
+				gateway.WithGRPCIdleTimeout(cfg.Network.IdleTimeout),
+			}
+			if serverTLS != nil {
+				options = append(options, gateway.WithGRPCTLS(serverTLS))
+			}
+
+			grpcServer, err := gateway.NewGRPCServer(cfg.GRPC.Address, messageSize, db, logger, options...)
+			if err != nil {
+				logger.Fatal("can't create grpc server", zap.Error(err))
+			}
+			if err = grpcServer.Start(ctx, cfg.Network.ShutdownTimeout); err != nil {
+				logger.Fatal("can't start grpc server", zap.Error(err))
+			}
+		}()
+	}
+
 	wg.Wait()
 
-	logger.Debug("shutdown server")
+	// журнал закрывается после того, как серверы дождались запросов
+	<-walStopped
+	if walJournal != nil {
+		if err = walJournal.Close(); err != nil {
+			logger.Error("can't close wal", zap.Error(err))
+		}
+	}
+
+	if auditLog != nil {
+		if err = auditLog.Close(); err != nil {
+			logger.Error("can't close audit log", zap.Error(err))
+		}
+	}
+
+	// отправляет спаны, которые еще лежат в пачке
+	if tracerProvider != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Network.ShutdownTimeout)
+		if err = tracerProvider.Shutdown(shutdownCtx); err != nil {
+			logger.Error("can't shutdown tracer provider", zap.Error(err))
+		}
+		cancel()
+	}
+
+	logger.Info("shutdown server")
+}
+
+// configSummary - основные параметры конфигурации для INFO server
+func configSummary(cfg *config.Config) map[string]string {
+	summary := map[string]string{
+		"engine_type":       cfg.Engine.Type,
+		"tcp_address":       cfg.Network.Address,
+		"replica_type":      cfg.ReplicationConfig.ReplicaType,
+		"wal_max_segment":   cfg.WAL.MaxSegmentSize,
+		"wal_flush_batch":   strconv.Itoa(cfg.WAL.FlushingBatchSize),
+		"wal_flush_timeout": cfg.WAL.FlushingBatchTimeout.String(),
+		"auth_enabled":      strconv.FormatBool(cfg.Security != nil && len(cfg.Security.Users) > 0),
+		"tls_enabled":       strconv.FormatBool(cfg.Network.TLS != nil),
+	}
+	if cfg.HTTP != nil {
+		summary["http_address"] = cfg.HTTP.Address
+	}
+	if cfg.GRPC != nil {
+		summary["grpc_address"] = cfg.GRPC.Address
+	}
+	return summary
+}
+
+// reloadCertificates перечитывает сертификаты сервера по SIGHUP
+func reloadCertificates(ctx context.Context, certificates *network.ReloadableTLSConfig, logger *zap.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := certificates.Reload(); err != nil {
+				logger.Error("can't reload tls certificates", zap.Error(err))
+				continue
+			}
+			logger.Info("tls certificates reloaded")
+		}
+	}
 }
 
 func initLogger(logCfg *config.LoggingConfig) (*zap.Logger, error) {
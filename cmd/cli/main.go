@@ -1,19 +1,28 @@
 package main
 
 import (
+	"antdb/internal/network"
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 	"net"
 	"os"
+	"strings"
 	"syscall"
 )
 
 func main() {
-	address := flag.String("address", ":3223", "db address")
+	address := flag.String("address", ":3223", "db address, host:port or unix:///path.sock")
+	useTLS := flag.Bool("tls", false, "connect over tls")
+	caFile := flag.String("ca", "", "ca certificate to verify the server, system pool by default")
+	certFile := flag.String("cert", "", "client certificate, if the server verifies clients")
+	keyFile := flag.String("key", "", "client certificate key")
+	serverName := flag.String("server-name", "", "server name to verify, host from address by default")
 	flag.Parse()
 
 	logger, err := initLogger()
@@ -21,7 +30,7 @@ func main() {
 		panic(err)
 	}
 
-	conn, err := net.Dial("tcp", *address)
+	conn, err := dial(*address, *useTLS, *caFile, *certFile, *keyFile, *serverName)
 	if err != nil {
 		logger.Fatal("failed to connect to server", zap.Error(err))
 	}
@@ -67,9 +76,93 @@ func main() {
 		}
 
 		fmt.Print(response)
+
+		// после MONITOR и подписки сервер присылает сообщения без запроса, пока открыто соединение
+		if isPushCommand(command) && strings.HasPrefix(response, "[ok]") {
+			streamMessages(conn, connReader, consoleReader, logger)
+			return
+		}
+	}
+}
+
+// streamMessages печатает сообщения сервера и продолжает отправлять команды,
+// например UNSUBSCRIBE: ответы на них приходят в том же потоке, что и сообщения
+func streamMessages(conn net.Conn, connReader, consoleReader *bufio.Reader, logger *zap.Logger) {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		// соединение закрывается и при выходе по exit
+		if _, err := io.Copy(os.Stdout, connReader); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Error("failed to read messages", zap.Error(err))
+		}
+	}()
+
+	commands := make(chan string)
+	go func() {
+		defer close(commands)
+		for {
+			command, err := consoleReader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			commands <- command
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case command, ok := <-commands:
+			if !ok || command == "exit\n" {
+				return
+			}
+			if _, err := conn.Write([]byte(command)); err != nil {
+				logger.Error("failed to send query", zap.Error(err))
+				return
+			}
+		}
 	}
 }
 
+func isPushCommand(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch fields[0] {
+	case "MONITOR", "SUBSCRIBE", "PSUBSCRIBE":
+		return true
+	}
+	return false
+}
+
+func dial(address string, useTLS bool, caFile, certFile, keyFile, serverName string) (net.Conn, error) {
+	protocol, addr := network.SplitAddress(address)
+	if !useTLS {
+		return net.Dial(protocol, addr)
+	}
+
+	if serverName == "" && protocol == "tcp" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		serverName = host
+	}
+	if serverName == "" {
+		serverName = "localhost"
+	}
+
+	tlsConfig, err := network.NewClientTLSConfig(certFile, keyFile, caFile, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.Dial(protocol, addr, tlsConfig)
+}
+
 func initLogger() (*zap.Logger, error) {
 	opts := zap.Config{
 		Level:       zap.NewAtomicLevelAt(zap.DebugLevel),
@@ -11,11 +11,35 @@ import (
 const (
 	EngineTypeMemory = "in_memory"
 	NetworkAddress   = ":3223"
+	HTTPAddress      = ":8080"
+	GRPCAddress      = ":9090"
+	MetricsAddress   = ":2112"
 	MasterAddress    = ":3232"
 	MaxConnections   = 1
 	MessageSize      = "1KB"
+	ShutdownTimeout  = 5 * time.Second
+	IdleTimeout      = 5 * time.Minute
+	ReadTimeout      = 10 * time.Second
+	WriteTimeout     = 10 * time.Second
 	LoggingLevel     = "debug"
 	LoggingOutput    = "console"
+	SlowLogThreshold = 10 * time.Millisecond
+	SlowLogMaxLen    = 128
+	// TracingSampleRatio - доля трассировок, которые начинаются на сервере
+	TracingSampleRatio = 1
+	AuditMaxSize       = "100MB"
+	PubSubBufferSize   = 1024
+)
+
+const (
+	TracingExporterStdout   = "stdout"
+	TracingExporterOTLPFile = "otlp_file"
+)
+
+const (
+	ReplicaTypeMaster = "master"
+	ReplicaTypeSlave  = "slave"
+	ReplicaTypeRaft   = "raft"
 )
 
 type Config struct {
@@ -24,16 +48,116 @@ type Config struct {
 	Logging           *LoggingConfig     `yaml:"logging"`
 	WAL               *WALConfig         `yaml:"wal"`
 	ReplicationConfig *ReplicationConfig `yaml:"replication"`
+	Security          *SecurityConfig    `yaml:"security"`
+	HTTP              *HTTPConfig        `yaml:"http"`
+	GRPC              *GRPCConfig        `yaml:"grpc"`
+	Limits            *LimitsConfig      `yaml:"limits"`
+	Metrics           *MetricsConfig     `yaml:"metrics"`
+	SlowLog           *SlowLogConfig     `yaml:"slowlog"`
+	Tracing           *TracingConfig     `yaml:"tracing"`
+	Audit             *AuditConfig       `yaml:"audit"`
+	PubSub            *PubSubConfig      `yaml:"pubsub"`
 }
 
 type EngineConfig struct {
 	Type string `yaml:"type"`
 }
 
+// NetworkConfig - клиентский сервер. Address - host:port или unix:///path.sock,
+// для unix-сокета SocketMode задает права на файл в восьмеричном виде, например "0660"
 type NetworkConfig struct {
-	Address        string `yaml:"address"`
-	MaxConnections int    `yaml:"max_connections"`
-	MessageSize    string `yaml:"message_size"`
+	Address         string        `yaml:"address"`
+	SocketMode      string        `yaml:"socket_mode"`
+	MaxConnections  int           `yaml:"max_connections"`
+	MessageSize     string        `yaml:"message_size"`
+	TLS             *TLSConfig    `yaml:"tls"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+}
+
+// HTTPConfig - REST-шлюз. Таймауты, размер запроса и TLS берутся из NetworkConfig
+type HTTPConfig struct {
+	Address string `yaml:"address"`
+}
+
+// GRPCConfig - сервис KV. Размер сообщения, таймаут простоя и TLS берутся
+// из NetworkConfig
+type GRPCConfig struct {
+	Address string `yaml:"address"`
+}
+
+// MetricsConfig - HTTP-сервер с метриками Prometheus по пути /metrics и
+// проверками состояния /healthz и /readyz. Сервер работает без TLS и
+// аутентификации, его адрес не стоит открывать наружу
+type MetricsConfig struct {
+	Address string `yaml:"address"`
+}
+
+// SecurityConfig - пользователи базы. Если список пуст, аутентификация отключена
+type SecurityConfig struct {
+	Users []UserConfig `yaml:"users"`
+}
+
+// UserConfig - пользователь и его права. password_hash - bcrypt-хэш пароля,
+// commands - команды или категории read, write, admin, all, keys - шаблоны
+// ключей, где * заменяет любую последовательность символов
+type UserConfig struct {
+	Name         string   `yaml:"name"`
+	PasswordHash string   `yaml:"password_hash"`
+	Commands     []string `yaml:"commands"`
+	Keys         []string `yaml:"keys"`
+}
+
+// LimitsConfig - ограничения частоты запросов. Аутентифицированные клиенты
+// учитываются по имени пользователя, остальные по IP-адресу. Лимиты из users
+// и clients заменяют общие для отдельных пользователей и адресов
+type LimitsConfig struct {
+	RateLimitConfig `yaml:",inline"`
+	Users           map[string]RateLimitConfig `yaml:"users"`
+	Clients         map[string]RateLimitConfig `yaml:"clients"`
+}
+
+// RateLimitConfig - лимиты клиента, bytes_per_second задается размером, например
+// "1MB". Пустое или нулевое значение снимает ограничение
+type RateLimitConfig struct {
+	CommandsPerSecond float64 `yaml:"commands_per_second"`
+	BytesPerSecond    string  `yaml:"bytes_per_second"`
+}
+
+// SlowLogConfig - журнал медленных запросов: последние max_len запросов,
+// которые выполнялись дольше threshold
+type SlowLogConfig struct {
+	Threshold time.Duration `yaml:"threshold"`
+	MaxLen    int           `yaml:"max_len"`
+}
+
+// TracingConfig - трассировка запросов OpenTelemetry. Экспортер stdout пишет
+// спаны в JSON в стандартный вывод, otlp_file дописывает их в file в формате
+// OTLP JSON. sample_ratio - доля трассировок от 0 до 1; если клиент передал
+// контекст трассировки, используется его решение
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	File        string  `yaml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// AuditConfig - журнал аудита: SET, DEL, AUTH и административные команды
+// в формате JSON lines. Когда файл вырастает больше max_size, он
+// переименовывается, из старых файлов хранятся max_backups последних
+// (0 - все). Значения ключей записываются, только если log_values: true
+type AuditConfig struct {
+	File       string `yaml:"file"`
+	MaxSize    string `yaml:"max_size"`
+	MaxBackups int    `yaml:"max_backups"`
+	LogValues  bool   `yaml:"log_values"`
+}
+
+// PubSubConfig - подписки на каналы. buffer_size - сколько сообщений может
+// накопить подписчик, который не успевает их читать, прежде чем его отключат
+type PubSubConfig struct {
+	BufferSize int `yaml:"buffer_size"`
 }
 
 type LoggingConfig struct {
@@ -50,9 +174,38 @@ type WALConfig struct {
 }
 
 type ReplicationConfig struct {
-	ReplicaType   string        `yaml:"replica_type"`
-	MasterAddress string        `yaml:"master_address"`
-	SyncInterval  time.Duration `yaml:"sync_interval"`
+	ReplicaType      string        `yaml:"replica_type"`
+	MasterAddress    string        `yaml:"master_address"`
+	SyncInterval     time.Duration `yaml:"sync_interval"`
+	ReplicaID        string        `yaml:"replica_id"`
+	RelayAddress     string        `yaml:"relay_address"`
+	ReadWaitTimeout  time.Duration `yaml:"read_wait_timeout"`
+	RedirectAddress  string        `yaml:"redirect_address"`
+	MinReplicasToAck int           `yaml:"min_replicas_to_ack"`
+	AckTimeout       time.Duration `yaml:"ack_timeout"`
+	AuthToken        string        `yaml:"auth_token"`
+	TLS              *TLSConfig    `yaml:"tls"`
+	Raft             *RaftConfig   `yaml:"raft"`
+	// реплика готова (/readyz), если отстает от мастера не больше чем на
+	// ready_max_lag записей, 0 - отставание не проверяется
+	ReadyMaxLag uint64 `yaml:"ready_max_lag"`
+}
+
+// TLSConfig - сертификаты для шифрования соединения. На стороне сервера ca_file
+// включает проверку клиентских сертификатов, на стороне клиента - проверку сервера
+type TLSConfig struct {
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	CAFile     string `yaml:"ca_file"`
+	ServerName string `yaml:"server_name"`
+}
+
+type RaftConfig struct {
+	NodeID            string            `yaml:"node_id"`
+	Address           string            `yaml:"address"`
+	Peers             map[string]string `yaml:"peers"`
+	ElectionTimeout   time.Duration     `yaml:"election_timeout"`
+	HeartbeatInterval time.Duration     `yaml:"heartbeat_interval"`
 }
 
 func GetConfig() (*Config, error) {
@@ -87,6 +240,18 @@ func setDefaults(cfg *Config) {
 	if cfg.Network.MessageSize == "" {
 		cfg.Network.MessageSize = MessageSize
 	}
+	if cfg.Network.ShutdownTimeout == 0 {
+		cfg.Network.ShutdownTimeout = ShutdownTimeout
+	}
+	if cfg.Network.IdleTimeout == 0 {
+		cfg.Network.IdleTimeout = IdleTimeout
+	}
+	if cfg.Network.ReadTimeout == 0 {
+		cfg.Network.ReadTimeout = ReadTimeout
+	}
+	if cfg.Network.WriteTimeout == 0 {
+		cfg.Network.WriteTimeout = WriteTimeout
+	}
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = LoggingLevel
 	}
@@ -109,7 +274,7 @@ func setDefaults(cfg *Config) {
 		cfg.WAL.DataDirectory = "-"
 	}
 	if cfg.ReplicationConfig.ReplicaType == "" {
-		cfg.ReplicationConfig.ReplicaType = "slave"
+		cfg.ReplicationConfig.ReplicaType = ReplicaTypeSlave
 	}
 	if cfg.ReplicationConfig.SyncInterval == 0 {
 		cfg.ReplicationConfig.SyncInterval = time.Second
@@ -117,4 +282,57 @@ func setDefaults(cfg *Config) {
 	if cfg.ReplicationConfig.MasterAddress == "" {
 		cfg.ReplicationConfig.MasterAddress = MasterAddress
 	}
+	if cfg.ReplicationConfig.ReplicaID == "" {
+		hostname, _ := os.Hostname()
+		cfg.ReplicationConfig.ReplicaID = hostname + cfg.Network.Address
+	}
+	if cfg.ReplicationConfig.ReadWaitTimeout == 0 {
+		cfg.ReplicationConfig.ReadWaitTimeout = time.Second
+	}
+	if cfg.ReplicationConfig.AckTimeout == 0 {
+		cfg.ReplicationConfig.AckTimeout = time.Second
+	}
+	if cfg.ReplicationConfig.Raft != nil {
+		if cfg.ReplicationConfig.Raft.ElectionTimeout == 0 {
+			cfg.ReplicationConfig.Raft.ElectionTimeout = 300 * time.Millisecond
+		}
+		if cfg.ReplicationConfig.Raft.HeartbeatInterval == 0 {
+			cfg.ReplicationConfig.Raft.HeartbeatInterval = 50 * time.Millisecond
+		}
+	}
+	if cfg.HTTP != nil && cfg.HTTP.Address == "" {
+		cfg.HTTP.Address = HTTPAddress
+	}
+	if cfg.GRPC != nil && cfg.GRPC.Address == "" {
+		cfg.GRPC.Address = GRPCAddress
+	}
+	if cfg.Metrics != nil && cfg.Metrics.Address == "" {
+		cfg.Metrics.Address = MetricsAddress
+	}
+	if cfg.SlowLog == nil {
+		cfg.SlowLog = &SlowLogConfig{}
+	}
+	if cfg.SlowLog.Threshold == 0 {
+		cfg.SlowLog.Threshold = SlowLogThreshold
+	}
+	if cfg.SlowLog.MaxLen == 0 {
+		cfg.SlowLog.MaxLen = SlowLogMaxLen
+	}
+	if cfg.Tracing != nil {
+		if cfg.Tracing.Exporter == "" {
+			cfg.Tracing.Exporter = TracingExporterStdout
+		}
+		if cfg.Tracing.SampleRatio == 0 {
+			cfg.Tracing.SampleRatio = TracingSampleRatio
+		}
+	}
+	if cfg.PubSub == nil {
+		cfg.PubSub = &PubSubConfig{}
+	}
+	if cfg.PubSub.BufferSize == 0 {
+		cfg.PubSub.BufferSize = PubSubBufferSize
+	}
+	if cfg.Audit != nil && cfg.Audit.MaxSize == "" {
+		cfg.Audit.MaxSize = AuditMaxSize
+	}
 }
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"io"
+	"sync"
+	"time"
+)
+
+// Entry - запись журнала аудита: кто, откуда и что сделал. Для команд
+// без ключа в Arguments записываются их аргументы
+type Entry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	ClientAddr string    `json:"client_addr,omitempty"`
+	Command    string    `json:"command"`
+	Key        string    `json:"key,omitempty"`
+	Value      string    `json:"value,omitempty"`
+	Arguments  []string  `json:"arguments,omitempty"`
+	LSN        uint64    `json:"lsn,omitempty"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Log пишет записи аудита в формате JSON lines, по строке на запись
+type Log struct {
+	mu     sync.Mutex
+	writer io.WriteCloser
+	// values - записывать ли значения ключей
+	values bool
+	logger *zap.Logger
+}
+
+type LogOption func(*Log)
+
+// WithValues включает запись значений, по умолчанию они не попадают в журнал
+func WithValues() LogOption {
+	return func(l *Log) {
+		l.values = true
+	}
+}
+
+func NewLog(writer io.WriteCloser, logger *zap.Logger, options ...LogOption) *Log {
+	l := &Log{
+		writer: writer,
+		logger: logger,
+	}
+
+	for _, option := range options {
+		option(l)
+	}
+
+	return l
+}
+
+// Record дописывает запись. Запрос к этому моменту уже выполнен, поэтому
+// ошибка записи только попадает в лог
+func (l *Log) Record(entry Entry) {
+	if !l.values {
+		entry.Value = ""
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		l.logger.Error("can't encode audit entry", zap.Error(err))
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err = l.writer.Write(append(line, '\n')); err != nil {
+		l.logger.Error("can't write audit entry",
+			zap.String("command", entry.Command),
+			zap.String("user", entry.User),
+			zap.Error(err))
+	}
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.writer.Close()
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (c *nopCloser) Close() error {
+	return nil
+}
+
+func TestLog_Record(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		options []LogOption
+		value   string
+	}{
+		"without values": {},
+		"with values": {
+			options: []LogOption{WithValues()},
+			value:   "secret",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			buffer := &nopCloser{}
+			log := NewLog(buffer, zap.NewNop(), test.options...)
+			entry := Entry{
+				Time:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				User:       "admin",
+				ClientAddr: "127.0.0.1:5000",
+				Command:    "SET",
+				Key:        "key",
+				Value:      "secret",
+				LSN:        3,
+				Result:     "ok",
+			}
+			log.Record(entry)
+			log.Record(entry)
+			require.NoError(t, log.Close())
+
+			lines := bytes.Split(bytes.TrimSuffix(buffer.Bytes(), []byte{'\n'}), []byte{'\n'})
+			require.Len(t, lines, 2)
+
+			var fields map[string]any
+			require.NoError(t, json.Unmarshal(lines[0], &fields))
+			expected := map[string]any{
+				"time":        "2024-01-01T00:00:00Z",
+				"user":        "admin",
+				"client_addr": "127.0.0.1:5000",
+				"command":     "SET",
+				"key":         "key",
+				"lsn":         float64(3),
+				"result":      "ok",
+			}
+			if test.value != "" {
+				expected["value"] = test.value
+			}
+			require.Equal(t, expected, fields)
+		})
+	}
+}
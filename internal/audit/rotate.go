@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat - суффикс старых файлов. Имена сортируются так же, как время
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// RotatingFile дописывает данные в файл, а когда файл вырастает больше
+// maxSize, переименовывает его в <имя>.<время> и начинает новый. Из старых
+// файлов хранятся maxBackups последних, maxBackups == 0 - хранятся все
+type RotatingFile struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	now        func() time.Time
+}
+
+func NewRotatingFile(filename string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		filename:   filename,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write записывает p целиком в один файл: файл сменяется до записи,
+// если с ней он превысит maxSize
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Sync()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("can't open audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("can't stat audit log: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate вызывается под f.mu
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("can't sync audit log: %w", err)
+	}
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("can't close audit log: %w", err)
+	}
+	f.file = nil
+
+	backup := f.filename + "." + f.now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.filename, backup); err != nil {
+		return fmt.Errorf("can't rename audit log: %w", err)
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.removeBackups()
+}
+
+// removeBackups удаляет самые старые файлы сверх maxBackups
+func (f *RotatingFile) removeBackups() error {
+	if f.maxBackups == 0 {
+		return nil
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > f.maxBackups {
+		if err = os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("can't remove old audit log: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backups возвращает старые файлы от старых к новым
+func (f *RotatingFile) backups() ([]string, error) {
+	dir, name := filepath.Split(f.filename)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, fmt.Errorf("can't read audit log directory: %w", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), name+".")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if _, err = time.Parse(backupTimeFormat, suffix); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, entry.Name()))
+	}
+
+	sort.Strings(backups)
+	return backups, nil
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "audit.jsonl")
+	file, err := NewRotatingFile(filename, 10, 2)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	file.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, file.Close())
+
+	// запись не делится между файлами, хранятся два последних старых файла
+	backups, err := file.backups()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filename + ".20240101T000002.000000000Z",
+		filename + ".20240101T000003.000000000Z",
+	}, backups)
+
+	data, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(data))
+
+	data, err = os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "fourth\n", string(data))
+
+	_, err = file.Write([]byte("closed\n"))
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, os.WriteFile(filename, []byte("existing\n"), 0o600))
+
+	// размер уже записанного учитывается после перезапуска
+	file, err := NewRotatingFile(filename, 10, 0)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "new\n", string(data))
+
+	backups, err := file.backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+}
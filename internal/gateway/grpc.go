@@ -0,0 +1,429 @@
+package gateway
+
+import (
+	"antdb/api/kv"
+	"antdb/internal/network"
+	"antdb/internal/service"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage"
+	"antdb/internal/tracing"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type KVDatabase interface {
+	Database
+	Scan(ctx context.Context, prefix, after string, limit int) ([]storage.KeyValue, error)
+	Watch(ctx context.Context, prefix string) (<-chan storage.Event, error)
+}
+
+// GRPCServer - сервис KV поверх базы. Логин и пароль передаются в метаданных
+// authorization в формате Basic, как в HTTP
+type GRPCServer struct {
+	kv.UnimplementedKVServer
+
+	address string
+	server  *grpc.Server
+	db      KVDatabase
+	// закрывается при остановке, чтобы завершить потоки Watch
+	shutdown chan struct{}
+	logger   *zap.Logger
+}
+
+type GRPCOption func(*grpcOptions)
+
+type grpcOptions struct {
+	tlsConfig   *tls.Config
+	idleTimeout time.Duration
+}
+
+// WithGRPCTLS включает TLS
+func WithGRPCTLS(cfg *tls.Config) GRPCOption {
+	return func(o *grpcOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithGRPCIdleTimeout закрывает соединения, по которым долго нет вызовов
+func WithGRPCIdleTimeout(timeout time.Duration) GRPCOption {
+	return func(o *grpcOptions) {
+		o.idleTimeout = timeout
+	}
+}
+
+func NewGRPCServer(address string, messageSize int, db KVDatabase, logger *zap.Logger, options ...GRPCOption) (*GRPCServer, error) {
+	if messageSize < 1 {
+		return nil, errors.New("invalid message size")
+	}
+
+	var opts grpcOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
+	serverOptions := []grpc.ServerOption{grpc.MaxRecvMsgSize(messageSize)}
+	if opts.tlsConfig != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(withH2(opts.tlsConfig))))
+	}
+	if opts.idleTimeout > 0 {
+		serverOptions = append(serverOptions, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: opts.idleTimeout,
+		}))
+	}
+
+	s := &GRPCServer{
+		address:  address,
+		server:   grpc.NewServer(serverOptions...),
+		db:       db,
+		shutdown: make(chan struct{}),
+		logger:   logger,
+	}
+	kv.RegisterKVServer(s.server, s)
+
+	return s, nil
+}
+
+// Start обслуживает вызовы, пока не отменен ctx. После отмены ждет
+// выполняющиеся вызовы не дольше shutdownTimeout, потоки Watch прерываются
+// сразу
+func (s *GRPCServer) Start(ctx context.Context, shutdownTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("can't start grpc server: %w", err)
+	}
+
+	return s.Serve(ctx, listener, shutdownTimeout)
+}
+
+// Serve обслуживает вызовы на готовом listener
+func (s *GRPCServer) Serve(ctx context.Context, listener net.Listener, shutdownTimeout time.Duration) error {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		close(s.shutdown)
+
+		done := make(chan struct{})
+		go func() {
+			s.server.GracefulStop()
+			close(done)
+		}()
+
+		timer := time.NewTimer(shutdownTimeout)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+			s.logger.Warn("grpc shutdown timeout, closing connections")
+			s.server.Stop()
+		}
+	}()
+
+	if err := s.server.Serve(listener); err != nil {
+		return fmt.Errorf("can't serve grpc: %w", err)
+	}
+
+	<-stopped
+	return nil
+}
+
+func (s *GRPCServer) Get(ctx context.Context, request *kv.GetRequest) (*kv.GetResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	result, err := s.db.Execute(ctx, getQuery(request))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &kv.GetResponse{Value: result.Value}, nil
+}
+
+func (s *GRPCServer) Set(ctx context.Context, request *kv.SetRequest) (*kv.SetResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	result, err := s.db.Execute(ctx, setQuery(request))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &kv.SetResponse{Lsn: result.LSN}, nil
+}
+
+func (s *GRPCServer) Del(ctx context.Context, request *kv.DelRequest) (*kv.DelResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	result, err := s.db.Execute(ctx, delQuery(request))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &kv.DelResponse{Lsn: result.LSN}, nil
+}
+
+func (s *GRPCServer) Batch(ctx context.Context, request *kv.BatchRequest) (*kv.BatchResponse, error) {
+	if len(request.Operations) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "too many operations, max %d", maxBatchSize)
+	}
+
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &kv.BatchResponse{Results: make([]*kv.OperationResult, 0, len(request.Operations))}
+	for _, operation := range request.Operations {
+		var query *compute.Query
+		switch op := operation.Operation.(type) {
+		case *kv.Operation_Get:
+			query = getQuery(op.Get)
+		case *kv.Operation_Set:
+			query = setQuery(op.Set)
+		case *kv.Operation_Del:
+			query = delQuery(op.Del)
+		default:
+			response.Results = append(response.Results, &kv.OperationResult{
+				Code:  uint32(codes.InvalidArgument),
+				Error: "empty operation",
+			})
+			continue
+		}
+
+		result, err := s.db.Execute(ctx, query)
+		if err != nil {
+			st := status.Convert(grpcError(err))
+			response.Results = append(response.Results, &kv.OperationResult{
+				Code:  uint32(st.Code()),
+				Error: st.Message(),
+			})
+			continue
+		}
+		response.Results = append(response.Results, &kv.OperationResult{Value: result.Value, Lsn: result.LSN})
+	}
+
+	return response, nil
+}
+
+func (s *GRPCServer) Scan(request *kv.ScanRequest, stream kv.KV_ScanServer) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return grpcError(err)
+	}
+
+	entries, err := s.db.Scan(ctx, request.Prefix, request.StartAfter, int(request.Limit))
+	if err != nil {
+		return grpcError(err)
+	}
+
+	for _, entry := range entries {
+		if err = stream.Send(&kv.KeyValue{Key: entry.Key, Value: entry.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *GRPCServer) Watch(request *kv.WatchRequest, stream kv.KV_WatchServer) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return grpcError(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	events, err := s.db.Watch(ctx, request.Prefix)
+	if err != nil {
+		return grpcError(err)
+	}
+	// заголовки сообщают клиенту, что подписка создана
+	if err = stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for event := range events {
+		message := &kv.WatchEvent{Type: kv.WatchEvent_SET, Key: event.Key, Value: event.Value, Lsn: event.LSN}
+		if event.Command == compute.DelCommand {
+			message.Type = kv.WatchEvent_DEL
+		}
+		if err = stream.Send(message); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-s.shutdown:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	default:
+	}
+	// канал закрывается без отмены, только если клиент не успевал читать
+	if ctx.Err() == nil {
+		return status.Error(codes.ResourceExhausted, "watcher is too slow")
+	}
+	return status.FromContextError(ctx.Err()).Err()
+}
+
+// authenticate создает сессию вызова и, если клиент передал логин и пароль,
+// запоминает в ней пользователя
+func (s *GRPCServer) authenticate(ctx context.Context) (context.Context, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		ctx = network.WithClientAddr(ctx, p.Addr.String())
+	}
+	ctx = network.WithSession(ctx, network.NewSession())
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracing.Extract(ctx, metadataCarrier(md))
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ctx, nil
+	}
+
+	name, password, ok := parseBasicAuth(values[0])
+	if !ok {
+		return nil, fmt.Errorf("%w authorization header", service.ErrInvalidArgument)
+	}
+	if err := s.db.Authenticate(ctx, name, password); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// metadataCarrier позволяет читать контекст трассировки из метаданных вызова
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func parseBasicAuth(header string) (string, string, bool) {
+	const prefix = "Basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
+
+func getQuery(request *kv.GetRequest) *compute.Query {
+	query := compute.NewQuery(compute.GetCommand, []string{request.Key})
+	if request.MinLsn > 0 {
+		query.SetModifier(compute.MinLSNModifier, []string{strconv.FormatUint(request.MinLsn, 10)})
+	}
+	return query
+}
+
+func setQuery(request *kv.SetRequest) *compute.Query {
+	query := compute.NewQuery(compute.SetCommand, []string{request.Key, request.Value})
+	setGRPCWait(query, request.WaitReplicas, request.WaitTimeout)
+	return query
+}
+
+func delQuery(request *kv.DelRequest) *compute.Query {
+	query := compute.NewQuery(compute.DelCommand, []string{request.Key})
+	setGRPCWait(query, request.WaitReplicas, request.WaitTimeout)
+	return query
+}
+
+func setGRPCWait(query *compute.Query, replicas int32, timeout int64) {
+	if replicas == 0 {
+		return
+	}
+	if timeout == 0 {
+		timeout = int64(time.Second / time.Millisecond)
+	}
+	query.SetModifier(compute.WaitModifier, []string{
+		strconv.Itoa(int(replicas)),
+		strconv.FormatInt(timeout, 10),
+	})
+}
+
+// grpcError выбирает код ответа по ошибке базы
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, service.ErrAuthRequired), errors.Is(err, auth.ErrAuthFailed):
+		code = codes.Unauthenticated
+	case errors.Is(err, service.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrAuthDisabled):
+		code = codes.InvalidArgument
+	case errors.Is(err, service.ErrMoved):
+		code = codes.FailedPrecondition
+	case errors.Is(err, service.ErrRateLimited):
+		code = codes.ResourceExhausted
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// withH2 добавляет h2 в ALPN и настройкам, которые выбираются при handshake:
+// credentials.NewTLS дописывает его только в переданный конфиг
+func withH2(cfg *tls.Config) *tls.Config {
+	cfg = cfg.Clone()
+	if getConfig := cfg.GetConfigForClient; getConfig != nil {
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			clientCfg, err := getConfig(hello)
+			if err != nil || clientCfg == nil {
+				return clientCfg, err
+			}
+
+			clientCfg = clientCfg.Clone()
+			clientCfg.NextProtos = append(clientCfg.NextProtos, "h2")
+			return clientCfg, nil
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,240 @@
+package gateway
+
+import (
+	"antdb/api/kv"
+	"antdb/internal/service"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/limit"
+	"antdb/internal/tracing"
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestGRPCClient(t *testing.T, acl *auth.ACL, options ...service.DatabaseOption) kv.KVClient {
+	t.Helper()
+
+	server, err := NewGRPCServer("", 1024, newTestDatabase(t, acl, options...), zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := bufconn.Listen(1 << 20)
+	stopped := make(chan error)
+	go func() {
+		stopped <- server.Serve(ctx, listener, time.Second)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+		cancel()
+		require.NoError(t, <-stopped)
+	})
+	return kv.NewKVClient(conn)
+}
+
+func withBasicAuth(ctx context.Context, name, password string) context.Context {
+	credentials := base64.StdEncoding.EncodeToString([]byte(name + ":" + password))
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Basic "+credentials)
+}
+
+func TestGRPCServer_Keys(t *testing.T) {
+	t.Parallel()
+
+	client := newTestGRPCClient(t, nil)
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, &kv.GetRequest{Key: "key"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Set(ctx, &kv.SetRequest{Key: "key", Value: "value with spaces"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Set(ctx, &kv.SetRequest{Key: "key", Value: "value_1"})
+	require.NoError(t, err)
+
+	response, err := client.Get(ctx, &kv.GetRequest{Key: "key"})
+	require.NoError(t, err)
+	require.Equal(t, "value_1", response.Value)
+
+	_, err = client.Del(ctx, &kv.DelRequest{Key: "key"})
+	require.NoError(t, err)
+
+	_, err = client.Get(ctx, &kv.GetRequest{Key: "key"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Set(ctx, &kv.SetRequest{Key: "key", Value: "value", WaitReplicas: -1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_Batch(t *testing.T) {
+	t.Parallel()
+
+	client := newTestGRPCClient(t, nil)
+	response, err := client.Batch(context.Background(), &kv.BatchRequest{Operations: []*kv.Operation{
+		{Operation: &kv.Operation_Set{Set: &kv.SetRequest{Key: "a", Value: "1"}}},
+		{Operation: &kv.Operation_Get{Get: &kv.GetRequest{Key: "a"}}},
+		{Operation: &kv.Operation_Del{Del: &kv.DelRequest{Key: "a"}}},
+		{Operation: &kv.Operation_Get{Get: &kv.GetRequest{Key: "a"}}},
+		{},
+	}})
+	require.NoError(t, err)
+
+	require.Len(t, response.Results, 5)
+	require.Equal(t, "1", response.Results[1].Value)
+	require.Equal(t, uint32(codes.NotFound), response.Results[3].Code)
+	require.Equal(t, uint32(codes.InvalidArgument), response.Results[4].Code)
+}
+
+func TestGRPCServer_Scan(t *testing.T) {
+	t.Parallel()
+
+	client := newTestGRPCClient(t, nil)
+	ctx := context.Background()
+	for _, key := range []string{"user/3", "user/1", "order/1", "user/2"} {
+		_, err := client.Set(ctx, &kv.SetRequest{Key: key, Value: key})
+		require.NoError(t, err)
+	}
+
+	scan := func(request *kv.ScanRequest) []string {
+		stream, err := client.Scan(ctx, request)
+		require.NoError(t, err)
+
+		var keys []string
+		for {
+			entry, err := stream.Recv()
+			if err == io.EOF {
+				return keys
+			}
+			require.NoError(t, err)
+			keys = append(keys, entry.Key)
+		}
+	}
+
+	require.Equal(t, []string{"user/1", "user/2", "user/3"}, scan(&kv.ScanRequest{Prefix: "user/"}))
+	require.Equal(t, []string{"user/1", "user/2"}, scan(&kv.ScanRequest{Prefix: "user/", Limit: 2}))
+	require.Equal(t, []string{"user/3"}, scan(&kv.ScanRequest{Prefix: "user/", StartAfter: "user/2"}))
+}
+
+func TestGRPCServer_Watch(t *testing.T) {
+	t.Parallel()
+
+	client := newTestGRPCClient(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &kv.WatchRequest{Prefix: "user/"})
+	require.NoError(t, err)
+	// заголовки приходят, когда сервер уже подписался
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	_, err = client.Set(ctx, &kv.SetRequest{Key: "order/1", Value: "1"})
+	require.NoError(t, err)
+	_, err = client.Set(ctx, &kv.SetRequest{Key: "user/1", Value: "1"})
+	require.NoError(t, err)
+	_, err = client.Del(ctx, &kv.DelRequest{Key: "user/1"})
+	require.NoError(t, err)
+
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, kv.WatchEvent_SET, event.Type)
+	require.Equal(t, "user/1", event.Key)
+	require.Equal(t, "1", event.Value)
+
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, kv.WatchEvent_DEL, event.Type)
+	require.Equal(t, "user/1", event.Key)
+}
+
+func TestGRPCServer_Auth(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"public_*"}},
+	})
+	require.NoError(t, err)
+
+	client := newTestGRPCClient(t, acl)
+	admin := withBasicAuth(context.Background(), "admin", "secret")
+	reader := withBasicAuth(context.Background(), "reader", "secret")
+
+	_, err = client.Get(context.Background(), &kv.GetRequest{Key: "public_key"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Get(withBasicAuth(context.Background(), "reader", "wrong"), &kv.GetRequest{Key: "public_key"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Set(admin, &kv.SetRequest{Key: "public_key", Value: "1"})
+	require.NoError(t, err)
+	_, err = client.Set(admin, &kv.SetRequest{Key: "private_key", Value: "2"})
+	require.NoError(t, err)
+
+	_, err = client.Get(reader, &kv.GetRequest{Key: "private_key"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Set(reader, &kv.SetRequest{Key: "public_key", Value: "3"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// недоступные ключи не попадают в результат
+	stream, err := client.Scan(reader, &kv.ScanRequest{})
+	require.NoError(t, err)
+	entry, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "public_key", entry.Key)
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestGRPCServer_AuthRateLimit(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	limiter := limit.NewLimiter(limit.Limits{CommandsPerSecond: 2}, nil)
+	client := newTestGRPCClient(t, acl, service.WithRateLimiter(limiter))
+	wrong := withBasicAuth(context.Background(), "reader", "wrong")
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Get(wrong, &kv.GetRequest{Key: "key"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+
+	_, err = client.Get(wrong, &kv.GetRequest{Key: "key"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestMetadataCarrier(t *testing.T) {
+	t.Parallel()
+
+	md := metadata.Pairs("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	spanContext := trace.SpanContextFromContext(tracing.Extract(context.Background(), metadataCarrier(md)))
+	require.True(t, spanContext.IsRemote())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+	require.Equal(t, []string{"traceparent"}, metadataCarrier(md).Keys())
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"antdb/internal/health"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// HealthChecker - проверки готовности узла для /readyz
+type HealthChecker interface {
+	Check(ctx context.Context) []health.Result
+}
+
+const (
+	statusOK       = "ok"
+	statusNotReady = "not ready"
+)
+
+// healthResponse - ответ /healthz и /readyz, в checks - "ok" или текст ошибки проверки
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// registerHealth регистрирует /healthz, который отвечает, пока процесс жив,
+// и /readyz, который отвечает 503, пока не пройдены все проверки checker
+func registerHealth(mux *http.ServeMux, checker HealthChecker, logger *zap.Logger) {
+	mux.HandleFunc(healthzPath, func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: statusOK}, logger)
+	})
+
+	mux.HandleFunc(readyzPath, func(w http.ResponseWriter, r *http.Request) {
+		response := healthResponse{Status: statusOK, Checks: make(map[string]string)}
+		status := http.StatusOK
+		for _, result := range checker.Check(r.Context()) {
+			if result.Err != nil {
+				response.Status = statusNotReady
+				response.Checks[result.Name] = result.Err.Error()
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			response.Checks[result.Name] = statusOK
+		}
+		writeHealth(w, status, response, logger)
+	})
+}
+
+func writeHealth(w http.ResponseWriter, status int, response healthResponse, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Warn("can't write health response", zap.Error(err))
+	}
+}
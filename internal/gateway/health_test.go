@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"antdb/internal/health"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getHealth(t *testing.T, url string) (int, healthResponse) {
+	t.Helper()
+
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	var body healthResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+	return response.StatusCode, body
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	t.Parallel()
+
+	checker := health.NewChecker()
+	recovery := health.NewFlag("wal replay is in progress")
+	checker.Add("recovery", recovery.Check)
+
+	server := httptest.NewServer(NewMetricsServer(":0", prometheus.NewRegistry(), checker, zap.NewNop()).Handler())
+	t.Cleanup(server.Close)
+
+	status, body := getHealth(t, server.URL+healthzPath)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, healthResponse{Status: statusOK}, body)
+
+	status, body = getHealth(t, server.URL+readyzPath)
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, healthResponse{
+		Status: statusNotReady,
+		Checks: map[string]string{"recovery": "wal replay is in progress"},
+	}, body)
+
+	recovery.Done()
+	status, body = getHealth(t, server.URL+readyzPath)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, healthResponse{
+		Status: statusOK,
+		Checks: map[string]string{"recovery": statusOK},
+	}, body)
+}
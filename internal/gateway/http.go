@@ -0,0 +1,365 @@
+package gateway
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage"
+	"antdb/internal/tracing"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keysPath  = "/v1/keys/"
+	batchPath = "/v1/batch"
+
+	// maxBatchSize ограничивает число операций в одном пакетном запросе
+	maxBatchSize = 1000
+)
+
+type Database interface {
+	Execute(ctx context.Context, query *compute.Query) (service.Result, error)
+	Authenticate(ctx context.Context, name, password string) error
+}
+
+// HTTPServer - REST-шлюз к базе. Запросы проходят те же проверки прав,
+// что и запросы по TCP: пользователь передается через Basic-аутентификацию
+type HTTPServer struct {
+	server *http.Server
+	db     Database
+	logger *zap.Logger
+}
+
+type HTTPOption func(*http.Server)
+
+// WithHTTPTLS включает HTTPS
+func WithHTTPTLS(cfg *tls.Config) HTTPOption {
+	return func(s *http.Server) {
+		s.TLSConfig = cfg
+	}
+}
+
+// WithHTTPTimeouts задает таймауты ожидания запроса (idle), его чтения (read)
+// и записи ответа (write)
+func WithHTTPTimeouts(idle, read, write time.Duration) HTTPOption {
+	return func(s *http.Server) {
+		s.IdleTimeout = idle
+		s.ReadTimeout = read
+		s.WriteTimeout = write
+	}
+}
+
+func NewHTTPServer(address string, messageSize int, db Database, logger *zap.Logger, options ...HTTPOption) (*HTTPServer, error) {
+	if messageSize < 1 {
+		return nil, errors.New("invalid message size")
+	}
+
+	s := &HTTPServer{
+		db:     db,
+		logger: logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(keysPath, s.handleKey)
+	mux.HandleFunc(batchPath, s.handleBatch)
+
+	s.server = &http.Server{
+		Addr: address,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(messageSize))
+			mux.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          zap.NewStdLog(logger),
+	}
+	for _, option := range options {
+		option(s.server)
+	}
+
+	return s, nil
+}
+
+// Handler возвращает обработчик запросов, например для тестов
+func (s *HTTPServer) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start обслуживает запросы, пока не отменен ctx. После отмены сервер
+// перестает принимать соединения и ждет выполняющиеся запросы не дольше
+// shutdownTimeout
+func (s *HTTPServer) Start(ctx context.Context, shutdownTimeout time.Duration) error {
+	return serveHTTP(ctx, s.server, shutdownTimeout, s.logger)
+}
+
+func serveHTTP(ctx context.Context, server *http.Server, shutdownTimeout time.Duration, logger *zap.Logger) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("can't start http server: %w", err)
+	}
+	if server.TLSConfig != nil {
+		listener = tls.NewListener(listener, server.TLSConfig)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("http shutdown timeout, closing connections", zap.Error(err))
+			_ = server.Close()
+		}
+	}()
+
+	if err = server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("can't serve http: %w", err)
+	}
+
+	<-stopped
+	return nil
+}
+
+type valueResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type writeRequest struct {
+	Value string `json:"value"`
+}
+
+type writeResponse struct {
+	LSN uint64 `json:"lsn,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type batchOperation struct {
+	Command string `json:"command"`
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+}
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchResult struct {
+	Value string `json:"value,omitempty"`
+	LSN   uint64 `json:"lsn,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// handleKey обслуживает GET, PUT и DELETE /v1/keys/{key}. Параметры запроса
+// min_lsn, wait_replicas и wait_timeout (мс) соответствуют модификаторам
+// MINLSN и WAIT текстового протокола
+func (s *HTTPServer) handleKey(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, keysPath)
+	if key == "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("empty key"))
+		return
+	}
+
+	ctx, err := s.authenticate(r)
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	var query *compute.Query
+	switch r.Method {
+	case http.MethodGet:
+		query = compute.NewQuery(compute.GetCommand, []string{key})
+		if lsn := r.URL.Query().Get("min_lsn"); lsn != "" {
+			query.SetModifier(compute.MinLSNModifier, []string{lsn})
+		}
+	case http.MethodPut:
+		var request writeRequest
+		if !s.decodeBody(w, r, &request) {
+			return
+		}
+		query = compute.NewQuery(compute.SetCommand, []string{key, request.Value})
+		setWait(query, r)
+	case http.MethodDelete:
+		query = compute.NewQuery(compute.DelCommand, []string{key})
+		setWait(query, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	result, err := s.db.Execute(ctx, query)
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		s.writeJSON(w, http.StatusOK, valueResponse{Key: key, Value: result.Value})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, writeResponse{LSN: result.LSN})
+}
+
+// handleBatch выполняет операции по порядку. Пакет не атомарен: ошибка
+// операции записывается в ее результат и не отменяет остальные
+func (s *HTTPServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	ctx, err := s.authenticate(r)
+	if err != nil {
+		s.writeQueryError(w, err)
+		return
+	}
+
+	var request batchRequest
+	if !s.decodeBody(w, r, &request) {
+		return
+	}
+	if len(request.Operations) > maxBatchSize {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("too many operations, max %d", maxBatchSize))
+		return
+	}
+
+	response := batchResponse{Results: make([]batchResult, 0, len(request.Operations))}
+	for _, operation := range request.Operations {
+		query, err := batchQuery(operation)
+		if err != nil {
+			response.Results = append(response.Results, batchResult{Error: err.Error()})
+			continue
+		}
+
+		result, err := s.db.Execute(ctx, query)
+		if err != nil {
+			response.Results = append(response.Results, batchResult{Error: err.Error()})
+			continue
+		}
+		response.Results = append(response.Results, batchResult{Value: result.Value, LSN: result.LSN})
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+func batchQuery(operation batchOperation) (*compute.Query, error) {
+	if operation.Key == "" {
+		return nil, errors.New("empty key")
+	}
+
+	switch compute.Command(strings.ToUpper(operation.Command)) {
+	case compute.GetCommand:
+		return compute.NewQuery(compute.GetCommand, []string{operation.Key}), nil
+	case compute.SetCommand:
+		return compute.NewQuery(compute.SetCommand, []string{operation.Key, operation.Value}), nil
+	case compute.DelCommand:
+		return compute.NewQuery(compute.DelCommand, []string{operation.Key}), nil
+	default:
+		return nil, fmt.Errorf("unsupported command %s", operation.Command)
+	}
+}
+
+// authenticate создает сессию запроса и, если клиент передал логин и пароль,
+// запоминает в ней пользователя
+func (s *HTTPServer) authenticate(r *http.Request) (context.Context, error) {
+	ctx := tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx = network.WithClientAddr(ctx, r.RemoteAddr)
+	ctx = network.WithSession(ctx, network.NewSession())
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return ctx, nil
+	}
+	if err := s.db.Authenticate(ctx, name, password); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// decodeBody читает JSON из тела запроса, при ошибке отвечает клиенту сам
+func (s *HTTPServer) decodeBody(w http.ResponseWriter, r *http.Request, body any) bool {
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("body is larger than %d bytes", maxBytesErr.Limit))
+		return false
+	}
+	s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+	return false
+}
+
+func setWait(query *compute.Query, r *http.Request) {
+	replicas := r.URL.Query().Get("wait_replicas")
+	if replicas == "" {
+		return
+	}
+
+	timeout := r.URL.Query().Get("wait_timeout")
+	if timeout == "" {
+		timeout = strconv.Itoa(int(time.Second / time.Millisecond))
+	}
+	query.SetModifier(compute.WaitModifier, []string{replicas, timeout})
+}
+
+// writeQueryError выбирает код ответа по ошибке базы
+func (s *HTTPServer) writeQueryError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrAuthRequired), errors.Is(err, auth.ErrAuthFailed):
+		w.Header().Set("WWW-Authenticate", `Basic realm="antdb"`)
+		status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidArgument), errors.Is(err, service.ErrAuthDisabled):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrMoved):
+		status = http.StatusMisdirectedRequest
+	case errors.Is(err, service.ErrRateLimited):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+
+	s.writeError(w, status, err)
+}
+
+func (s *HTTPServer) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (s *HTTPServer) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Warn("can't write http response", zap.Error(err))
+	}
+}
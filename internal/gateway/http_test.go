@@ -0,0 +1,243 @@
+package gateway
+
+import (
+	"antdb/internal/service"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/limit"
+	"antdb/internal/service/storage"
+	"antdb/internal/service/storage/engine"
+	"antdb/internal/service/storage/wal"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDatabase(t *testing.T, acl *auth.ACL, options ...service.DatabaseOption) *service.Database {
+	t.Helper()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := storage.NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+	cmp := compute.NewCompute(compute.NewParser(), compute.NewAnalyzer(zap.NewNop()), zap.NewNop())
+	return service.NewDatabase(cmp, st, time.Second, "", acl, zap.NewNop(), options...)
+}
+
+func newTestHTTPServer(t *testing.T, acl *auth.ACL) *httptest.Server {
+	t.Helper()
+
+	server, err := NewHTTPServer(":0", 1024, newTestDatabase(t, acl), zap.NewNop())
+	require.NoError(t, err)
+
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func doRequest(t *testing.T, method, url, body string, setup func(*http.Request)) (int, map[string]any) {
+	t.Helper()
+
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if setup != nil {
+		setup(request)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	var result map[string]any
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+	return response.StatusCode, result
+}
+
+func TestHTTPServer_Keys(t *testing.T) {
+	t.Parallel()
+
+	server := newTestHTTPServer(t, nil)
+	url := server.URL + "/v1/keys/users/1"
+
+	status, body := doRequest(t, http.MethodGet, url, "", nil)
+	require.Equal(t, http.StatusNotFound, status)
+	require.Equal(t, "not found", body["error"])
+
+	status, _ = doRequest(t, http.MethodPut, url, `{"value":"John_Smith"}`, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	status, body = doRequest(t, http.MethodGet, url, "", nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, map[string]any{"key": "users/1", "value": "John_Smith"}, body)
+
+	status, _ = doRequest(t, http.MethodDelete, url, "", nil)
+	require.Equal(t, http.StatusOK, status)
+
+	status, _ = doRequest(t, http.MethodGet, url, "", nil)
+	require.Equal(t, http.StatusNotFound, status)
+}
+
+func TestHTTPServer_Errors(t *testing.T) {
+	t.Parallel()
+
+	server := newTestHTTPServer(t, nil)
+
+	tests := map[string]struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		"empty key":          {method: http.MethodGet, path: "/v1/keys/", status: http.StatusBadRequest},
+		"invalid body":       {method: http.MethodPut, path: "/v1/keys/key", body: "value", status: http.StatusBadRequest},
+		"invalid lsn":        {method: http.MethodGet, path: "/v1/keys/key?min_lsn=abc", status: http.StatusBadRequest},
+		"invalid wait":       {method: http.MethodDelete, path: "/v1/keys/key?wait_replicas=-1", status: http.StatusBadRequest},
+		"method not allowed": {method: http.MethodPost, path: "/v1/keys/key", status: http.StatusMethodNotAllowed},
+		// ключи и значения подчиняются тем же правилам, что в текстовом протоколе
+		"key with space":     {method: http.MethodGet, path: "/v1/keys/user%20name", status: http.StatusBadRequest},
+		"value with space":   {method: http.MethodPut, path: "/v1/keys/key", body: `{"value":"John Smith"}`, status: http.StatusBadRequest},
+		"value with newline": {method: http.MethodPut, path: "/v1/keys/key", body: `{"value":"a\nb"}`, status: http.StatusBadRequest},
+		"empty value":        {method: http.MethodPut, path: "/v1/keys/key", body: `{"value":""}`, status: http.StatusBadRequest},
+		"too large body": {
+			method: http.MethodPut,
+			path:   "/v1/keys/key",
+			body:   `{"value":"` + strings.Repeat("a", 2048) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			status, body := doRequest(t, test.method, server.URL+test.path, test.body, nil)
+			require.Equal(t, test.status, status)
+			require.NotEmpty(t, body["error"])
+		})
+	}
+}
+
+func TestHTTPServer_Batch(t *testing.T) {
+	t.Parallel()
+
+	server := newTestHTTPServer(t, nil)
+	request := `{"operations":[
+		{"command":"set","key":"a","value":"1"},
+		{"command":"get","key":"a"},
+		{"command":"del","key":"a"},
+		{"command":"get","key":"a"},
+		{"command":"info","key":"a"}
+	]}`
+
+	status, body := doRequest(t, http.MethodPost, server.URL+"/v1/batch", request, nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []any{
+		map[string]any{},
+		map[string]any{"value": "1"},
+		map[string]any{},
+		map[string]any{"error": "not found"},
+		map[string]any{"error": "unsupported command info"},
+	}, body["results"])
+}
+
+func TestHTTPServer_Auth(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"public_*"}},
+	})
+	require.NoError(t, err)
+
+	server := newTestHTTPServer(t, acl)
+	reader := func(r *http.Request) {
+		r.SetBasicAuth("reader", "secret")
+	}
+
+	tests := map[string]struct {
+		method string
+		path   string
+		setup  func(*http.Request)
+		status int
+	}{
+		"anonymous": {method: http.MethodGet, path: "/v1/keys/public_key", status: http.StatusUnauthorized},
+		"wrong password": {
+			method: http.MethodGet,
+			path:   "/v1/keys/public_key",
+			setup:  func(r *http.Request) { r.SetBasicAuth("reader", "wrong") },
+			status: http.StatusUnauthorized,
+		},
+		"allowed":           {method: http.MethodGet, path: "/v1/keys/public_key", setup: reader, status: http.StatusNotFound},
+		"forbidden key":     {method: http.MethodGet, path: "/v1/keys/private_key", setup: reader, status: http.StatusForbidden},
+		"forbidden command": {method: http.MethodDelete, path: "/v1/keys/public_key", setup: reader, status: http.StatusForbidden},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			status, _ := doRequest(t, test.method, server.URL+test.path, "", test.setup)
+			require.Equal(t, test.status, status)
+		})
+	}
+}
+
+func TestHTTPServer_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	limiter := limit.NewLimiter(limit.Limits{CommandsPerSecond: 1}, nil)
+	server, err := NewHTTPServer(":0", 1024, newTestDatabase(t, nil, service.WithRateLimiter(limiter)), zap.NewNop())
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	status, _ := doRequest(t, http.MethodPut, httpServer.URL+"/v1/keys/key", `{"value":"1"}`, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	status, body := doRequest(t, http.MethodGet, httpServer.URL+"/v1/keys/key", "", nil)
+	require.Equal(t, http.StatusTooManyRequests, status)
+	require.Equal(t, "rate limit exceeded: commands per second", body["error"])
+}
+
+func TestHTTPServer_AuthRateLimit(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	limiter := limit.NewLimiter(limit.Limits{CommandsPerSecond: 2}, nil)
+	server, err := NewHTTPServer(":0", 1024, newTestDatabase(t, acl, service.WithRateLimiter(limiter)), zap.NewNop())
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+
+	wrong := func(r *http.Request) { r.SetBasicAuth("reader", "wrong") }
+	for i := 0; i < 2; i++ {
+		status, _ := doRequest(t, http.MethodGet, httpServer.URL+"/v1/keys/key", "", wrong)
+		require.Equal(t, http.StatusUnauthorized, status)
+	}
+
+	// подбор пароля ограничен по адресу клиента, даже верный пароль
+	// не проверяется, пока лимит исчерпан
+	status, body := doRequest(t, http.MethodGet, httpServer.URL+"/v1/keys/key", "", wrong)
+	require.Equal(t, http.StatusTooManyRequests, status)
+	require.Equal(t, "rate limit exceeded: commands per second", body["error"])
+
+	status, _ = doRequest(t, http.MethodGet, httpServer.URL+"/v1/keys/key", "", func(r *http.Request) {
+		r.SetBasicAuth("reader", "secret")
+	})
+	require.Equal(t, http.StatusTooManyRequests, status)
+}
@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const metricsPath = "/metrics"
+
+// MetricsServer отдает метрики в формате Prometheus, а если задан checker,
+// то и состояние узла для оркестратора: /healthz и /readyz
+type MetricsServer struct {
+	server *http.Server
+	logger *zap.Logger
+}
+
+func NewMetricsServer(
+	address string,
+	gatherer prometheus.Gatherer,
+	checker HealthChecker,
+	logger *zap.Logger,
+	options ...HTTPOption,
+) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+		ErrorLog: zap.NewStdLog(logger),
+	}))
+	if checker != nil {
+		registerHealth(mux, checker, logger)
+	}
+
+	s := &MetricsServer{
+		server: &http.Server{
+			Addr:              address,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+			ErrorLog:          zap.NewStdLog(logger),
+		},
+		logger: logger,
+	}
+	for _, option := range options {
+		option(s.server)
+	}
+
+	return s
+}
+
+// Handler возвращает обработчик запросов, например для тестов
+func (s *MetricsServer) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Start обслуживает запросы, пока не отменен ctx
+func (s *MetricsServer) Start(ctx context.Context, shutdownTimeout time.Duration) error {
+	return serveHTTP(ctx, s.server, shutdownTimeout, s.logger)
+}
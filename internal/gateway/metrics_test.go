@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service"
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsServer(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	service.RegisterMetrics(registry)
+
+	db := newTestDatabase(t, nil)
+	ctx := network.WithSession(context.Background(), network.NewSession())
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "SET key value"))
+	require.Equal(t, "[error] not found", db.HandleQuery(ctx, "GET missing"))
+
+	server := httptest.NewServer(NewMetricsServer(":0", registry, nil, zap.NewNop()).Handler())
+	t.Cleanup(server.Close)
+
+	response, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	// счетчики общие для всех тестов пакета, поэтому проверяется только наличие серий
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `antdb_commands_total{command="SET",result="ok"}`)
+	require.Contains(t, string(body), `antdb_command_duration_seconds_count{command="GET",result="not_found"}`)
+}
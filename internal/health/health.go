@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// Check возвращает ошибку, если узел не готов обслуживать запросы
+type Check func(ctx context.Context) error
+
+// Result - результат одной проверки, Err == nil - проверка пройдена
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Checker собирает проверки готовности узла. Проверки можно добавлять
+// во время работы: например, проверку журнала - после его восстановления
+type Checker struct {
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		checks: make(map[string]Check),
+	}
+}
+
+// Add добавляет проверку или заменяет проверку с тем же именем
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Check выполняет проверки в порядке добавления
+func (c *Checker) Check(ctx context.Context) []Result {
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, 0, len(names))
+	for _, name := range names {
+		checks = append(checks, c.checks[name])
+	}
+	c.mu.RUnlock()
+
+	results := make([]Result, 0, len(names))
+	for i, check := range checks {
+		results = append(results, Result{Name: names[i], Err: check(ctx)})
+	}
+	return results
+}
+
+// Flag - проверка, которая не проходит, пока не вызван Done. Подходит для
+// событий вроде завершения восстановления журнала
+type Flag struct {
+	done    atomic.Bool
+	pending error
+}
+
+// NewFlag создает флаг, который до вызова Done возвращает ошибку с текстом pending
+func NewFlag(pending string) *Flag {
+	return &Flag{
+		pending: errors.New(pending),
+	}
+}
+
+func (f *Flag) Done() {
+	f.done.Store(true)
+}
+
+func (f *Flag) Check(_ context.Context) error {
+	if f.done.Load() {
+		return nil
+	}
+	return f.pending
+}
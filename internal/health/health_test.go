@@ -0,0 +1,33 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	t.Parallel()
+
+	checker := NewChecker()
+	require.Empty(t, checker.Check(context.Background()))
+
+	flag := NewFlag("recovery is in progress")
+	failed := errors.New("disk is full")
+	checker.Add("recovery", flag.Check)
+	checker.Add("wal", func(context.Context) error { return failed })
+
+	require.Equal(t, []Result{
+		{Name: "recovery", Err: errors.New("recovery is in progress")},
+		{Name: "wal", Err: failed},
+	}, checker.Check(context.Background()))
+
+	// замена проверки сохраняет ее место
+	flag.Done()
+	checker.Add("wal", func(context.Context) error { return nil })
+	require.Equal(t, []Result{
+		{Name: "recovery"},
+		{Name: "wal"},
+	}, checker.Check(context.Background()))
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixScheme - префикс адреса unix-сокета: unix:///run/antdb.sock
+const unixScheme = "unix://"
+
+// SplitAddress возвращает сеть и адрес для net.Dial и net.Listen
+func SplitAddress(address string) (string, string) {
+	if path, ok := strings.CutPrefix(address, unixScheme); ok {
+		return "unix", path
+	}
+	return "tcp", address
+}
+
+// Listen открывает TCP-порт или unix-сокет. Оставшийся от упавшего процесса
+// файл сокета удаляется, права на новый сокет выставляются в socketMode
+// (0 - по umask)
+func Listen(address string, socketMode os.FileMode) (net.Listener, error) {
+	network, addr := SplitAddress(address)
+	if network != "unix" {
+		return net.Listen(network, addr)
+	}
+
+	if err := removeStaleSocket(addr); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if socketMode != 0 {
+		if err = os.Chmod(addr, socketMode); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("can't set socket permissions: %w", err)
+		}
+	}
+
+	return listener, nil
+}
+
+// removeStaleSocket удаляет файл сокета, если его никто не слушает
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+
+	return os.Remove(path)
+}
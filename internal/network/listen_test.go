@@ -0,0 +1,93 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitAddress(t *testing.T) {
+	tests := map[string]struct {
+		address string
+		network string
+		addr    string
+	}{
+		"tcp":       {address: "localhost:3223", network: "tcp", addr: "localhost:3223"},
+		"tcp port":  {address: ":3223", network: "tcp", addr: ":3223"},
+		"unix":      {address: "unix:///run/antdb.sock", network: "unix", addr: "/run/antdb.sock"},
+		"unix path": {address: "unix://antdb.sock", network: "unix", addr: "antdb.sock"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			network, addr := SplitAddress(test.address)
+			require.Equal(t, test.network, network)
+			require.Equal(t, test.addr, addr)
+		})
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "antdb.sock")
+
+	// файл от упавшего процесса: сокет есть, но его никто не слушает
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server, err := NewServer("unix://"+path, 1, 1024, zap.NewNop(), WithSocketMode(0o600))
+	require.NoError(t, err)
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte("ok\n")
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Mode().Perm() == 0o600
+	}, time.Second, 10*time.Millisecond)
+
+	// второй сервер не должен удалить сокет работающего
+	_, err = Listen("unix://"+path, 0)
+	require.ErrorContains(t, err, "in use")
+
+	connection, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	_, err = connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+	response, err := bufio.NewReader(connection).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", response)
+	require.NoError(t, connection.Close())
+
+	cancel()
+	require.NoError(t, <-stopped)
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestListen_NotSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "antdb.sock")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	_, err := Listen("unix://"+path, 0)
+	require.ErrorContains(t, err, "not a socket")
+}
@@ -0,0 +1,41 @@
+package network
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	activeConnectionsDesc = prometheus.NewDesc("antdb_connections_active",
+		"Number of open client connections.", []string{"address"}, nil)
+	maxConnectionsDesc = prometheus.NewDesc("antdb_connections_max",
+		"Maximum number of client connections.", []string{"address"}, nil)
+	saturationDesc = prometheus.NewDesc("antdb_connections_saturation",
+		"Share of the connection semaphore in use, from 0 to 1.", []string{"address"}, nil)
+	overflowedDesc = prometheus.NewDesc("antdb_connections_overflowed_total",
+		"Connections rejected because of the connection limit.", []string{"address"}, nil)
+	rejectedDesc = prometheus.NewDesc("antdb_connections_rejected_total",
+		"Connections that failed the TLS handshake.", []string{"address"}, nil)
+)
+
+// Describe и Collect позволяют зарегистрировать сервер как коллектор
+// метрик соединений
+func (s *Server) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeConnectionsDesc
+	ch <- maxConnectionsDesc
+	ch <- saturationDesc
+	ch <- overflowedDesc
+	ch <- rejectedDesc
+}
+
+func (s *Server) Collect(ch chan<- prometheus.Metric) {
+	acquired := float64(s.ActiveConnections())
+	capacity := float64(s.MaxConnections())
+
+	ch <- prometheus.MustNewConstMetric(activeConnectionsDesc, prometheus.GaugeValue, acquired, s.address)
+	ch <- prometheus.MustNewConstMetric(maxConnectionsDesc, prometheus.GaugeValue, capacity, s.address)
+	ch <- prometheus.MustNewConstMetric(saturationDesc, prometheus.GaugeValue, acquired/capacity, s.address)
+	ch <- prometheus.MustNewConstMetric(overflowedDesc, prometheus.CounterValue,
+		float64(s.OverflowedConnections()), s.address)
+	ch <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.CounterValue,
+		float64(s.RejectedConnections()), s.address)
+}
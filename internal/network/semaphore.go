@@ -16,10 +16,29 @@ func (s *Semaphore) Acquire() {
 	s.channel <- struct{}{}
 }
 
+// TryAcquire занимает место, если оно есть, и не ждет
+func (s *Semaphore) TryAcquire() bool {
+	select {
+	case s.channel <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Semaphore) Release() {
 	<-s.channel
 }
 
+// Acquired возвращает число занятых мест
+func (s *Semaphore) Acquired() int {
+	return len(s.channel)
+}
+
+func (s *Semaphore) Capacity() int {
+	return s.concurrency
+}
+
 func (s *Semaphore) IsFull() bool {
 	return len(s.channel) >= s.concurrency
 }
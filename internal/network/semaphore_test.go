@@ -29,3 +29,13 @@ func TestSemaphore_WithSemaphore(t *testing.T) {
 	})
 	require.Equal(t, sem.IsFull(), false)
 }
+
+func TestSemaphore_TryAcquire(t *testing.T) {
+	t.Parallel()
+	sem := NewSemaphore(1)
+	require.True(t, sem.TryAcquire())
+	require.False(t, sem.TryAcquire())
+
+	sem.Release()
+	require.True(t, sem.TryAcquire())
+}
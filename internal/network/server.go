@@ -2,22 +2,130 @@ package network
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
+	"io"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	handshakeTimeout       = 5 * time.Second
+	defaultShutdownTimeout = 5 * time.Second
 )
 
 type Server struct {
-	address     string
-	messageSize int
-	semaphore   *Semaphore
-	logger      *zap.Logger
+	address         string
+	messageSize     int
+	semaphore       *Semaphore
+	tlsConfig       *tls.Config
+	shutdownTimeout time.Duration
+	idleTimeout     time.Duration
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	socketMode      os.FileMode
+	rejected        atomic.Uint64
+
+	// разделитель запросов, nil - запрос приходит одним чтением
+	delimiter *byte
+
+	// ответ клиенту, пришедшему сверх лимита соединений. Если не задан,
+	// соединение ждет, пока освободится место
+	overflowResponse []byte
+	overflowed       atomic.Uint64
+
+	// открытые соединения, чтобы при остановке дождаться их запросов
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+type ServerOption func(*Server)
+
+// WithShutdownTimeout задает, сколько при остановке ждать выполняющиеся запросы
+func WithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// WithTimeouts ограничивает ожидание нового запроса (idle), чтение начатого
+// запроса (read) и запись ответа (write). Нулевое значение - без ограничения
+func WithTimeouts(idle, read, write time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idleTimeout = idle
+		s.readTimeout = read
+		s.writeTimeout = write
+	}
+}
+
+// WithOverflowResponse включает отказ соединениям сверх лимита: клиент получает
+// response, и соединение закрывается
+func WithOverflowResponse(response []byte) ServerOption {
+	return func(s *Server) {
+		s.overflowResponse = response
+	}
+}
+
+// WithDelimiter разбивает поток на запросы по разделителю. Клиент может
+// отправлять запросы, не дожидаясь ответов: они выполняются по очереди,
+// ответы возвращаются в том же порядке. Разделитель в запрос не входит
+func WithDelimiter(delimiter byte) ServerOption {
+	return func(s *Server) {
+		s.delimiter = &delimiter
+	}
+}
+
+// WithSocketMode задает права на файл сокета, если сервер слушает unix-сокет
+func WithSocketMode(mode os.FileMode) ServerOption {
+	return func(s *Server) {
+		s.socketMode = mode
+	}
+}
+
+// WithTLS включает шифрование входящих соединений
+func WithTLS(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+	}
 }
 
 type TCPHandler = func(context.Context, []byte) []byte
 
-func NewServer(address string, maxConnectionsNumber int, messageSize int, logger *zap.Logger) (*Server, error) {
+type contextKey int
+
+const (
+	clientAddrKey contextKey = iota
+	sessionKey
+)
+
+// ClientAddr возвращает адрес клиента, чей запрос обрабатывается
+func ClientAddr(ctx context.Context) string {
+	addr, _ := ctx.Value(clientAddrKey).(string)
+	return addr
+}
+
+// WithClientAddr сохраняет адрес клиента в контексте запроса
+func WithClientAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientAddrKey, addr)
+}
+
+func NewServer(
+	address string,
+	maxConnectionsNumber int,
+	messageSize int,
+	logger *zap.Logger,
+	options ...ServerOption,
+) (*Server, error) {
 	if maxConnectionsNumber < 1 {
 		return nil, errors.New("invalid max connections")
 	}
@@ -26,61 +134,410 @@ func NewServer(address string, maxConnectionsNumber int, messageSize int, logger
 		return nil, errors.New("invalid message size")
 	}
 
-	return &Server{
-		address:     address,
-		semaphore:   NewSemaphore(maxConnectionsNumber),
-		messageSize: messageSize,
-		logger:      logger,
-	}, nil
+	server := &Server{
+		address:         address,
+		semaphore:       NewSemaphore(maxConnectionsNumber),
+		messageSize:     messageSize,
+		shutdownTimeout: defaultShutdownTimeout,
+		conns:           make(map[net.Conn]struct{}),
+		logger:          logger,
+	}
+	for _, option := range options {
+		option(server)
+	}
+
+	return server, nil
+}
+
+// RejectedConnections возвращает число соединений, не прошедших TLS handshake
+func (s *Server) RejectedConnections() uint64 {
+	return s.rejected.Load()
+}
+
+// ActiveConnections возвращает число открытых соединений
+func (s *Server) ActiveConnections() int {
+	return s.semaphore.Acquired()
+}
+
+func (s *Server) MaxConnections() int {
+	return s.semaphore.Capacity()
+}
+
+// OverflowedConnections возвращает число соединений, отклоненных из-за лимита
+func (s *Server) OverflowedConnections() uint64 {
+	return s.overflowed.Load()
 }
 
+// Start принимает соединения, пока не отменен ctx. После отмены новые
+// соединения не принимаются, а Start возвращается, когда выполняющиеся запросы
+// завершатся, но не позже чем через shutdownTimeout
 func (s *Server) Start(ctx context.Context, handler TCPHandler) error {
-	listener, err := net.Listen("tcp", s.address)
+	listener, err := Listen(s.address, s.socketMode)
 	if err != nil {
-		return errors.New("can't start server")
+		return fmt.Errorf("can't start server: %w", err)
 	}
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := listener.Close(); err != nil {
+			s.logger.Warn("failed to close listener", zap.Error(err))
+		}
+	}()
 
 	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			conn, err := listener.Accept()
-			if err != nil {
-				s.logger.Error("can't accept connection", zap.Error(err))
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
 			}
+			s.logger.Error("can't accept connection", zap.Error(err))
+			continue
+		}
 
+		if s.overflowResponse != nil && !s.semaphore.TryAcquire() {
+			s.wg.Add(1)
 			go func(connection net.Conn) {
-				s.semaphore.WithSemaphore(func() {
-					s.handleConnection(ctx, connection, handler)
-				})
+				defer s.wg.Done()
+				s.reject(connection)
 			}(conn)
+			continue
 		}
+
+		s.wg.Add(1)
+		go func(connection net.Conn) {
+			defer s.wg.Done()
+			if s.overflowResponse == nil {
+				s.semaphore.Acquire()
+			}
+			defer s.semaphore.Release()
+
+			s.handleConnection(ctx, connection, handler)
+		}(conn)
 	}
+
+	s.drain()
+	return nil
 }
 
-func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler TCPHandler) {
+// drain прерывает ожидание новых запросов и ждет ответов на уже полученные
+func (s *Server) drain() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		if err := conn.SetReadDeadline(time.Now()); err != nil {
+			s.logger.Warn("failed to interrupt connection", zap.Error(err))
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		s.mu.Lock()
+		s.logger.Warn("shutdown timeout, closing connections", zap.Int("connections", len(s.conns)))
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// reject отвечает клиенту сверх лимита соединений и закрывает соединение
+func (s *Server) reject(conn net.Conn) {
+	s.overflowed.Add(1)
+	s.logger.Warn("too many connections, rejecting client",
+		zap.String("address", conn.RemoteAddr().String()))
+
 	defer func() {
 		if err := conn.Close(); err != nil {
 			s.logger.Warn("failed to close connection", zap.Error(err))
 		}
 	}()
 
+	// для TLS запись включает handshake, поэтому ограничиваем ее по времени
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return
+	}
+	if _, err := conn.Write(s.overflowResponse); err != nil {
+		s.logger.Debug("can't write overflow response", zap.Error(err))
+	}
+}
+
+func (s *Server) track(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[conn] = struct{}{}
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+func (s *Server) handleConnection(ctx context.Context, conn net.Conn, handler TCPHandler) {
+	defer func() {
+		if err := conn.Close(); err != nil && ctx.Err() == nil {
+			s.logger.Warn("failed to close connection", zap.Error(err))
+		}
+	}()
+
 	if handler == nil {
 		return
 	}
 
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := s.handshake(ctx, tlsConn); err != nil {
+			s.rejected.Add(1)
+			s.logger.Warn("tls handshake failed",
+				zap.String("address", conn.RemoteAddr().String()),
+				zap.Error(err))
+			return
+		}
+	}
+
+	s.track(conn)
+	defer s.untrack(conn)
+
+	// соединение дождалось очереди уже после начала остановки
+	if ctx.Err() != nil {
+		return
+	}
+
+	// контекст соединения отменяется, когда клиент уходит, и завершает
+	// подписки, созданные его запросами
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	session := NewSession()
+	session.pushable = true
+	ctx = WithClientAddr(ctx, conn.RemoteAddr().String())
+	ctx = WithSession(ctx, session)
+
+	reader := bufio.NewReaderSize(conn, s.messageSize)
+	writer := bufio.NewWriter(conn)
+	defer func() {
+		// ответы на уже выполненные запросы отправляем, даже если чтение прервалось
+		if err := s.flush(conn, writer); err != nil && ctx.Err() == nil {
+			s.logger.Debug("can't write response", zap.Error(err))
+		}
+	}()
+
 	buf := make([]byte, s.messageSize)
-	reader := bufio.NewReader(conn)
 	for {
-		count, err := reader.Read(buf)
+		// ответы копятся, пока клиент присылает запросы пачкой, и уходят, когда
+		// очередь запросов пуста
+		if reader.Buffered() == 0 {
+			if err := s.flush(conn, writer); err != nil {
+				s.logger.Warn("can't write response", zap.Error(err))
+				return
+			}
+
+			if err := setDeadline(conn.SetReadDeadline, s.idleTimeout); err != nil {
+				s.logger.Warn("can't set idle timeout", zap.Error(err))
+				return
+			}
+			// остановка могла начаться до установки таймаута и не прервать чтение
+			if ctx.Err() != nil {
+				return
+			}
+
+			if _, err := reader.Peek(1); err != nil {
+				s.logReadError(ctx, conn, err)
+				return
+			}
+		}
+
+		if err := setDeadline(conn.SetReadDeadline, s.readTimeout); err != nil {
+			s.logger.Warn("can't set read timeout", zap.Error(err))
+			return
+		}
+		request, err := s.readRequest(reader, buf)
 		if err != nil {
-			s.logger.Warn("can't read response", zap.Error(err))
+			s.logReadError(ctx, conn, err)
 			return
 		}
 
-		if _, err = conn.Write(handler(ctx, buf[:count])); err != nil {
+		response := handler(ctx, request)
+		if err = setDeadline(conn.SetWriteDeadline, s.writeTimeout); err != nil {
+			s.logger.Warn("can't set write timeout", zap.Error(err))
+			return
+		}
+		// если клиент не читает ответы, запись блокируется и следующие
+		// запросы не читаются
+		if _, err = writer.Write(response); err != nil {
 			s.logger.Warn("can't write response", zap.Error(err))
+			return
 		}
+
+		if push := session.pushStream(); push != nil {
+			s.handlePush(ctx, conn, reader, writer, buf, handler, push)
+			return
+		}
+	}
+}
+
+// handlePush отправляет клиенту сообщения из push и отвечает на его запросы,
+// пока канал не закроется или клиент не уйдет. Таймаут простоя не действует:
+// клиент может только слушать
+func (s *Server) handlePush(
+	ctx context.Context,
+	conn net.Conn,
+	reader *bufio.Reader,
+	writer *bufio.Writer,
+	buf []byte,
+	handler TCPHandler,
+	push <-chan []byte,
+) {
+	// ответ на запрос, включивший отправку, и ответы до него
+	if err := s.flush(conn, writer); err != nil {
+		s.logger.Warn("can't write response", zap.Error(err))
+		return
+	}
+
+	requests := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			if err := conn.SetReadDeadline(time.Time{}); err != nil {
+				readErr <- err
+				return
+			}
+			// остановка могла начаться до снятия таймаута и не прервать чтение
+			if ctx.Err() != nil {
+				readErr <- ctx.Err()
+				return
+			}
+
+			request, err := s.readRequest(reader, buf)
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			// буфер чтения переиспользуется, поэтому запрос копируется
+			case requests <- bytes.Clone(request):
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var data [][]byte
+		select {
+		case message, ok := <-push:
+			if !ok {
+				s.logger.Debug("push stream closed", zap.String("address", conn.RemoteAddr().String()))
+				return
+			}
+			data = append(data, message)
+			if s.delimiter != nil {
+				data = append(data, []byte{*s.delimiter})
+			}
+		case request := <-requests:
+			data = append(data, handler(ctx, request))
+		case err := <-readErr:
+			s.logReadError(ctx, conn, err)
+			return
+		}
+
+		if err := setDeadline(conn.SetWriteDeadline, s.writeTimeout); err != nil {
+			s.logger.Warn("can't set write timeout", zap.Error(err))
+			return
+		}
+		for _, chunk := range data {
+			if _, err := writer.Write(chunk); err != nil {
+				s.logger.Warn("can't write push message", zap.Error(err))
+				return
+			}
+		}
+
+		// сообщения, пришедшие пачкой, уходят одной записью
+		if len(push) == 0 {
+			if err := s.flush(conn, writer); err != nil {
+				s.logger.Warn("can't write push message", zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// readRequest читает следующий запрос. С разделителем запросы можно слать
+// пачкой, без него запросом считается то, что пришло за одно чтение
+func (s *Server) readRequest(reader *bufio.Reader, buf []byte) ([]byte, error) {
+	if s.delimiter == nil {
+		count, err := reader.Read(buf)
+		return buf[:count], err
+	}
+
+	request, err := reader.ReadSlice(*s.delimiter)
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("request is larger than %d bytes", s.messageSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	request = request[:len(request)-1]
+	if *s.delimiter == '\n' {
+		request = bytes.TrimSuffix(request, []byte{'\r'})
+	}
+	return request, nil
+}
+
+func (s *Server) flush(conn net.Conn, writer *bufio.Writer) error {
+	if writer.Buffered() == 0 {
+		return nil
+	}
+	if err := setDeadline(conn.SetWriteDeadline, s.writeTimeout); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+func (s *Server) logReadError(ctx context.Context, conn net.Conn, err error) {
+	var netErr net.Error
+	switch {
+	case ctx.Err() != nil, errors.Is(err, io.EOF):
+	case errors.As(err, &netErr) && netErr.Timeout():
+		s.logger.Debug("closing inactive connection", zap.String("address", conn.RemoteAddr().String()))
+	default:
+		s.logger.Warn("can't read request", zap.Error(err))
+	}
+}
+
+// setDeadline ставит срок операции через timeout или снимает его, если timeout нулевой
+func setDeadline(set func(time.Time) error, timeout time.Duration) error {
+	if timeout == 0 {
+		return set(time.Time{})
+	}
+	return set(time.Now().Add(timeout))
+}
+
+func (s *Server) handshake(ctx context.Context, conn *tls.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return err
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
 	}
+	return conn.SetDeadline(time.Time{})
 }
@@ -1,11 +1,16 @@
 package network
 
 import (
+	"antdb/internal/network/tlstest"
 	"bufio"
 	"context"
+	"crypto/tls"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"io"
 	"net"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -41,3 +46,424 @@ func TestServer(t *testing.T) {
 	err = connection.Close()
 	require.NoError(t, err)
 }
+
+func TestServer_ClientAddr(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3224", 10, 1024, zap.NewNop())
+	require.NoError(t, err)
+
+	go func() {
+		err = server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte(ClientAddr(ctx) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	connection, err := net.Dial("tcp", ":3224")
+	require.NoError(t, err)
+	_, err = connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+
+	connReader := bufio.NewReader(connection)
+	response, err := connReader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, connection.LocalAddr().String()+"\n", response)
+	err = connection.Close()
+	require.NoError(t, err)
+}
+
+func TestServer_TLS(t *testing.T) {
+	t.Parallel()
+
+	certs := tlstest.Generate(t)
+	serverTLS, err := NewServerTLSConfig(certs.ServerCertFile, certs.ServerKeyFile, certs.CAFile)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3225", 10, 1024, zap.NewNop(), WithTLS(serverTLS))
+	require.NoError(t, err)
+
+	go func() {
+		err = server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte("ok\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	clientTLS, err := NewClientTLSConfig(certs.ClientCertFile, certs.ClientKeyFile, certs.CAFile, "localhost")
+	require.NoError(t, err)
+	connection, err := tls.Dial("tcp", "localhost:3225", clientTLS)
+	require.NoError(t, err)
+	_, err = connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+
+	response, err := bufio.NewReader(connection).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", response)
+	require.NoError(t, connection.Close())
+
+	// сертификат, выпущенный чужим CA, сервер не принимает
+	other := tlstest.Generate(t)
+	untrustedTLS, err := NewClientTLSConfig(other.ClientCertFile, other.ClientKeyFile, certs.CAFile, "localhost")
+	require.NoError(t, err)
+	connection, err = tls.Dial("tcp", "localhost:3225", untrustedTLS)
+	if err == nil {
+		_, err = connection.Write([]byte("send\n"))
+		if err == nil {
+			_, err = bufio.NewReader(connection).ReadString('\n')
+		}
+		_ = connection.Close()
+	}
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		return server.RejectedConnections() == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Session(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3227", 10, 1024, zap.NewNop())
+	require.NoError(t, err)
+
+	go func() {
+		err = server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			session, ok := SessionFromContext(ctx)
+			require.True(t, ok)
+
+			count, _ := session.Get("count").(int)
+			session.Set("count", count+1)
+			return []byte(strconv.Itoa(count+1) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		connection, err := net.Dial("tcp", ":3227")
+		require.NoError(t, err)
+		connReader := bufio.NewReader(connection)
+
+		// сессия живет, пока открыто соединение
+		for _, expected := range []string{"1\n", "2\n"} {
+			_, err = connection.Write([]byte("send\n"))
+			require.NoError(t, err)
+			response, err := connReader.ReadString('\n')
+			require.NoError(t, err)
+			require.Equal(t, expected, response)
+		}
+		require.NoError(t, connection.Close())
+	}
+}
+
+func TestServer_GracefulShutdown(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3228", 10, 1024, zap.NewNop())
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	stopped := make(chan error)
+	go func() {
+		stopped <- server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			return []byte("ok\n")
+		})
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	idle, err := net.Dial("tcp", ":3228")
+	require.NoError(t, err)
+	defer idle.Close()
+
+	connection, err := net.Dial("tcp", ":3228")
+	require.NoError(t, err)
+	defer connection.Close()
+	_, err = connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+
+	<-started
+	cancel()
+
+	// запрос, который уже выполняется, получает ответ
+	response, err := bufio.NewReader(connection).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", response)
+
+	select {
+	case err = <-stopped:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("server is not stopped")
+	}
+
+	// новые соединения не принимаются, простаивающие закрыты
+	_, err = net.Dial("tcp", ":3228")
+	require.Error(t, err)
+	_, err = bufio.NewReader(idle).ReadString('\n')
+	require.Error(t, err)
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3229", 10, 1024, zap.NewNop(), WithShutdownTimeout(100*time.Millisecond))
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	stopped := make(chan error)
+	go func() {
+		stopped <- server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			close(started)
+			time.Sleep(5 * time.Second)
+			return []byte("ok\n")
+		})
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	connection, err := net.Dial("tcp", ":3229")
+	require.NoError(t, err)
+	defer connection.Close()
+	_, err = connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+
+	<-started
+	cancel()
+
+	select {
+	case err = <-stopped:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("server is not stopped")
+	}
+
+	_, err = bufio.NewReader(connection).ReadString('\n')
+	require.Error(t, err)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3230", 1, 1024, zap.NewNop(),
+		WithTimeouts(200*time.Millisecond, time.Second, time.Second))
+	require.NoError(t, err)
+
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte("ok\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	idle, err := net.Dial("tcp", ":3230")
+	require.NoError(t, err)
+	defer idle.Close()
+
+	// неактивное соединение закрывается сервером и освобождает место
+	require.NoError(t, idle.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = bufio.NewReader(idle).ReadString('\n')
+	require.ErrorIs(t, err, io.EOF)
+
+	connection, err := net.Dial("tcp", ":3230")
+	require.NoError(t, err)
+	defer connection.Close()
+
+	_, err = connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+	require.NoError(t, connection.SetReadDeadline(time.Now().Add(time.Second)))
+	response, err := bufio.NewReader(connection).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", response)
+}
+
+func TestServer_TooManyClients(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3231", 1, 1024, zap.NewNop(),
+		WithOverflowResponse([]byte("too many clients\n")))
+	require.NoError(t, err)
+
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte("ok\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	first, err := net.Dial("tcp", ":3231")
+	require.NoError(t, err)
+	_, err = first.Write([]byte("send\n"))
+	require.NoError(t, err)
+	firstReader := bufio.NewReader(first)
+	response, err := firstReader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", response)
+
+	second, err := net.Dial("tcp", ":3231")
+	require.NoError(t, err)
+	defer second.Close()
+
+	secondReader := bufio.NewReader(second)
+	response, err = secondReader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "too many clients\n", response)
+	_, err = secondReader.ReadString('\n')
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, uint64(1), server.OverflowedConnections())
+
+	// после закрытия первого соединения место освобождается
+	require.NoError(t, first.Close())
+	require.Eventually(t, func() bool {
+		connection, err := net.Dial("tcp", ":3231")
+		if err != nil {
+			return false
+		}
+		defer connection.Close()
+
+		if _, err = connection.Write([]byte("send\n")); err != nil {
+			return false
+		}
+		response, err := bufio.NewReader(connection).ReadString('\n')
+		return err == nil && response == "ok\n"
+	}, time.Second, 50*time.Millisecond)
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3233", 1, 16, zap.NewNop(), WithDelimiter('\n'))
+	require.NoError(t, err)
+
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			// медленная обработка, чтобы запросы успели скопиться
+			time.Sleep(10 * time.Millisecond)
+			return []byte("re:" + string(s) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connection, err := net.Dial("tcp", ":3233")
+	require.NoError(t, err)
+	defer connection.Close()
+
+	// несколько запросов одной пачкой, последний приходит по частям
+	_, err = connection.Write([]byte("first\nsecond\r\nthi"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = connection.Write([]byte("rd\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(connection)
+	for _, expected := range []string{"re:first\n", "re:second\n", "re:third\n"} {
+		response, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, expected, response)
+	}
+
+	// запрос больше message size закрывает соединение, непрочитанный остаток
+	// может дать RST вместо EOF
+	_, err = connection.Write([]byte(strings.Repeat("a", 32) + "\n"))
+	require.NoError(t, err)
+	_, err = reader.ReadString('\n')
+	require.Error(t, err)
+}
+
+func TestServer_Push(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3234", 1, 1024, zap.NewNop(), WithDelimiter('\n'))
+	require.NoError(t, err)
+
+	messages := make(chan []byte, 1)
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			if string(s) != "subscribe" {
+				return []byte("re:" + string(s) + "\n")
+			}
+
+			session, _ := SessionFromContext(ctx)
+			if err := session.StartPush(messages); err != nil {
+				return []byte(err.Error() + "\n")
+			}
+			return []byte("subscribed\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connection, err := net.Dial("tcp", ":3234")
+	require.NoError(t, err)
+	defer connection.Close()
+	reader := bufio.NewReader(connection)
+
+	_, err = connection.Write([]byte("subscribe\n"))
+	require.NoError(t, err)
+	response, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "subscribed\n", response)
+
+	// сообщения приходят без запроса, а на запросы по-прежнему есть ответы
+	messages <- []byte("event 1")
+	response, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "event 1\n", response)
+
+	_, err = connection.Write([]byte("subscribe\n"))
+	require.NoError(t, err)
+	response, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "connection is already in push mode\n", response)
+
+	// закрытый поток закрывает соединение
+	close(messages)
+	_, err = reader.ReadString('\n')
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSession_StartPush(t *testing.T) {
+	t.Parallel()
+
+	// сессии шлюзов не поддерживают отправку без запроса
+	err := NewSession().StartPush(make(chan []byte))
+	require.EqualError(t, err, "push is not supported by connection")
+}
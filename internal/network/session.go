@@ -0,0 +1,75 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Session хранит состояние клиента, пока открыто его соединение
+type Session struct {
+	mu     sync.Mutex
+	values map[any]any
+
+	// pushable - соединение может отправлять клиенту сообщения без запроса,
+	// push - поток таких сообщений, см. StartPush
+	pushable bool
+	push     <-chan []byte
+}
+
+func NewSession() *Session {
+	return &Session{
+		values: make(map[any]any),
+	}
+}
+
+func (s *Session) Get(key any) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.values[key]
+}
+
+func (s *Session) Set(key, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+}
+
+// StartPush переводит соединение в режим отправки сообщений без запроса:
+// после ответа на текущий запрос сервер пишет клиенту сообщения из messages,
+// дописывая к каждому разделитель, и продолжает отвечать на запросы. Когда
+// канал закрывается, соединение закрывается
+func (s *Session) StartPush(messages <-chan []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.pushable {
+		return errors.New("push is not supported by connection")
+	}
+	if s.push != nil {
+		return errors.New("connection is already in push mode")
+	}
+
+	s.push = messages
+	return nil
+}
+
+func (s *Session) pushStream() <-chan []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.push
+}
+
+// WithSession привязывает сессию к контексту запроса
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey, session)
+}
+
+// SessionFromContext возвращает сессию соединения, в котором пришел запрос
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionKey).(*Session)
+	return session, ok
+}
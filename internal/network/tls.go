@@ -0,0 +1,124 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// NewServerTLSConfig собирает настройки TLS для сервера. Если задан caFile,
+// клиент обязан предъявить сертификат, подписанный этим CA (mTLS)
+func NewServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls certificate and key are required")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(filepath.Clean(certFile), filepath.Clean(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("can't load tls certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// NewClientTLSConfig собирает настройки TLS для клиента. Без caFile сертификат
+// сервера проверяется по системным CA, certFile и keyFile нужны для mTLS
+func NewClientTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(filepath.Clean(certFile), filepath.Clean(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("can't load tls certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{certificate}
+	}
+
+	return cfg, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filepath.Clean(caFile))
+	if err != nil {
+		return nil, fmt.Errorf("can't read ca file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("can't parse ca file")
+	}
+
+	return pool, nil
+}
+
+// ReloadableTLSConfig - настройки TLS сервера, которые можно перечитать с диска
+// на ходу: новые соединения получают новые сертификаты, открытые не рвутся
+type ReloadableTLSConfig struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	current  atomic.Pointer[tls.Config]
+}
+
+func NewReloadableTLSConfig(certFile, keyFile, caFile string) (*ReloadableTLSConfig, error) {
+	cfg := &ReloadableTLSConfig{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := cfg.Reload(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Reload перечитывает сертификаты. При ошибке остаются прежние
+func (c *ReloadableTLSConfig) Reload() error {
+	cfg, err := NewServerTLSConfig(c.certFile, c.keyFile, c.caFile)
+	if err != nil {
+		return err
+	}
+
+	c.current.Store(cfg)
+	return nil
+}
+
+// Config возвращает настройки для сервера, которые при каждом handshake
+// берут последние загруженные сертификаты
+func (c *ReloadableTLSConfig) Config() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current.Load(), nil
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package network
+
+import (
+	"antdb/internal/network/tlstest"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadableTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	oldCerts := tlstest.Generate(t)
+	newCerts := tlstest.Generate(t)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server-key.pem")
+	copyFile(t, oldCerts.ServerCertFile, certFile)
+	copyFile(t, oldCerts.ServerKeyFile, keyFile)
+
+	reloadable, err := NewReloadableTLSConfig(certFile, keyFile, "")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := NewServer(":3226", 10, 1024, zap.NewNop(), WithTLS(reloadable.Config()))
+	require.NoError(t, err)
+
+	go func() {
+		err = server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte("ok\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	oldClientTLS, err := NewClientTLSConfig("", "", oldCerts.CAFile, "localhost")
+	require.NoError(t, err)
+	newClientTLS, err := NewClientTLSConfig("", "", newCerts.CAFile, "localhost")
+	require.NoError(t, err)
+
+	connection, err := tls.Dial("tcp", "localhost:3226", oldClientTLS)
+	require.NoError(t, err)
+	defer connection.Close()
+	requestOK(t, connection)
+
+	copyFile(t, newCerts.ServerCertFile, certFile)
+	copyFile(t, newCerts.ServerKeyFile, keyFile)
+	require.NoError(t, reloadable.Reload())
+
+	// открытое соединение продолжает работать
+	requestOK(t, connection)
+
+	_, err = tls.Dial("tcp", "localhost:3226", oldClientTLS)
+	require.Error(t, err)
+
+	newConnection, err := tls.Dial("tcp", "localhost:3226", newClientTLS)
+	require.NoError(t, err)
+	defer newConnection.Close()
+	requestOK(t, newConnection)
+
+	// битый сертификат не заменяет рабочий
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	require.Error(t, reloadable.Reload())
+	newConnection, err = tls.Dial("tcp", "localhost:3226", newClientTLS)
+	require.NoError(t, err)
+	require.NoError(t, newConnection.Close())
+}
+
+func requestOK(t *testing.T, connection *tls.Conn) {
+	t.Helper()
+
+	_, err := connection.Write([]byte("send\n"))
+	require.NoError(t, err)
+	response, err := bufio.NewReader(connection).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ok\n", response)
+}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+
+	data, err := os.ReadFile(from)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(to, data, 0o600))
+}
@@ -0,0 +1,35 @@
+package prepare
+
+import (
+	"antdb/config"
+	"antdb/internal/audit"
+	"antdb/internal/tools"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+// CreateAuditLog возвращает nil, если журнал аудита не настроен
+func CreateAuditLog(auditCfg *config.AuditConfig, logger *zap.Logger) (*audit.Log, error) {
+	if auditCfg == nil {
+		return nil, nil
+	}
+	if auditCfg.File == "" {
+		return nil, errors.New("file is required for audit log")
+	}
+
+	maxSize, err := tools.ParseSize(auditCfg.MaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse audit max size: %w", err)
+	}
+	file, err := audit.NewRotatingFile(auditCfg.File, int64(maxSize), auditCfg.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	var options []audit.LogOption
+	if auditCfg.LogValues {
+		options = append(options, audit.WithValues())
+	}
+	return audit.NewLog(file, logger, options...), nil
+}
@@ -0,0 +1,25 @@
+package prepare
+
+import (
+	"antdb/config"
+	"antdb/internal/service/auth"
+)
+
+// CreateACL возвращает nil, если пользователи не заданы: аутентификация отключена
+func CreateACL(securityCfg *config.SecurityConfig) (*auth.ACL, error) {
+	if securityCfg == nil || len(securityCfg.Users) == 0 {
+		return nil, nil
+	}
+
+	rules := make([]auth.UserRule, 0, len(securityCfg.Users))
+	for _, user := range securityCfg.Users {
+		rules = append(rules, auth.UserRule{
+			Name:         user.Name,
+			PasswordHash: user.PasswordHash,
+			Commands:     user.Commands,
+			Keys:         user.Keys,
+		})
+	}
+
+	return auth.NewACL(rules)
+}
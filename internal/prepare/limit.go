@@ -0,0 +1,46 @@
+package prepare
+
+import (
+	"antdb/config"
+	"antdb/internal/service/limit"
+	"antdb/internal/tools"
+	"fmt"
+)
+
+// CreateRateLimiter возвращает nil, если лимиты не заданы
+func CreateRateLimiter(limitsCfg *config.LimitsConfig) (*limit.Limiter, error) {
+	if limitsCfg == nil {
+		return nil, nil
+	}
+
+	defaults, err := createLimits(limitsCfg.RateLimitConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[string]limit.Limits, len(limitsCfg.Users)+len(limitsCfg.Clients))
+	for name, limitCfg := range limitsCfg.Users {
+		if overrides[limit.UserKey(name)], err = createLimits(limitCfg); err != nil {
+			return nil, fmt.Errorf("can't create limits for user %s: %w", name, err)
+		}
+	}
+	for ip, limitCfg := range limitsCfg.Clients {
+		if overrides[limit.ClientKey(ip)], err = createLimits(limitCfg); err != nil {
+			return nil, fmt.Errorf("can't create limits for client %s: %w", ip, err)
+		}
+	}
+
+	return limit.NewLimiter(defaults, overrides), nil
+}
+
+func createLimits(limitCfg config.RateLimitConfig) (limit.Limits, error) {
+	limits := limit.Limits{CommandsPerSecond: limitCfg.CommandsPerSecond}
+	if limitCfg.BytesPerSecond != "" {
+		bytes, err := tools.ParseSize(limitCfg.BytesPerSecond)
+		if err != nil {
+			return limit.Limits{}, fmt.Errorf("can't parse bytes per second: %w", err)
+		}
+		limits.BytesPerSecond = float64(bytes)
+	}
+	return limits, nil
+}
@@ -3,8 +3,12 @@ package prepare
 import (
 	"antdb/config"
 	"antdb/internal/network"
+	"antdb/internal/service/storage/raft"
 	"antdb/internal/service/storage/replication"
 	"antdb/internal/service/storage/wal"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
 )
 
@@ -16,29 +20,122 @@ const (
 func CreateMasterReplication(
 	replicationCfg *config.ReplicationConfig,
 	walCfg *config.WALConfig,
+	journal replication.Journal,
 	log *zap.Logger,
 ) (*replication.Master, error) {
-	replicaServer, err := network.NewServer(
-		replicationCfg.MasterAddress,
-		maxMasterConnections,
-		messageSize,
-		log)
+	replicaServer, err := createReplicaServer(replicationCfg.MasterAddress, replicationCfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("can't create replica server: %w", err)
+	}
+	return replication.NewMaster(
+		replicaServer,
+		replicationCfg.ReplicaID,
+		walCfg.DataDirectory,
+		journal,
+		replicationCfg.MinReplicasToAck,
+		replicationCfg.AckTimeout,
+		replicationCfg.AuthToken,
+		log), nil
+}
+
+// CreateRelayReplication запускает раздачу журнала реплики на relay_address
+func CreateRelayReplication(
+	replicationCfg *config.ReplicationConfig,
+	walCfg *config.WALConfig,
+	slave *replication.Slave,
+	log *zap.Logger,
+) (*replication.Relay, error) {
+	relayServer, err := createReplicaServer(replicationCfg.RelayAddress, replicationCfg, log)
 	if err != nil {
-		log.Fatal("can't create replica server", zap.Error(err))
+		return nil, fmt.Errorf("can't create relay server: %w", err)
+	}
+
+	master := replication.NewMaster(
+		relayServer,
+		replicationCfg.ReplicaID,
+		walCfg.DataDirectory,
+		slave.Journal(),
+		0,
+		replicationCfg.AckTimeout,
+		replicationCfg.AuthToken,
+		log)
+	return replication.NewRelay(slave, master), nil
+}
+
+func createReplicaServer(
+	address string,
+	replicationCfg *config.ReplicationConfig,
+	log *zap.Logger,
+) (*network.Server, error) {
+	var options []network.ServerOption
+	if tlsCfg := replicationCfg.TLS; tlsCfg != nil {
+		serverTLS, err := network.NewServerTLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't configure replication tls: %w", err)
+		}
+		options = append(options, network.WithTLS(serverTLS))
+	}
+
+	if replicationCfg.AuthToken == "" && replicationCfg.TLS == nil {
+		log.Warn("replication is not authenticated: set auth_token or tls")
 	}
-	return replication.NewMaster(replicaServer, walCfg.DataDirectory, log), nil
+
+	return network.NewServer(address, maxMasterConnections, messageSize, log, options...)
 }
 
 func CreateSlaveReplication(
 	replicationCfg *config.ReplicationConfig,
 	walCfg *config.WALConfig,
+	maxSegmentSize int,
 	streamCh chan []*wal.Unit,
 	log *zap.Logger,
 ) (*replication.Slave, error) {
+	var clientTLS *tls.Config
+	if tlsCfg := replicationCfg.TLS; tlsCfg != nil {
+		var err error
+		clientTLS, err = network.NewClientTLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile, tlsCfg.ServerName)
+		if err != nil {
+			return nil, fmt.Errorf("can't configure replication tls: %w", err)
+		}
+	}
+
 	return replication.NewSlave(
 		replicationCfg.MasterAddress,
 		replicationCfg.SyncInterval,
 		walCfg.DataDirectory,
+		maxSegmentSize,
+		replicationCfg.ReplicaID,
+		replicationCfg.AuthToken,
+		clientTLS,
 		streamCh,
 		log)
 }
+
+func CreateRaftReplication(
+	raftCfg *config.RaftConfig,
+	walCfg *config.WALConfig,
+	maxSegmentSize int,
+	stateMachine raft.StateMachine,
+	log *zap.Logger,
+) (*raft.Node, error) {
+	if raftCfg == nil {
+		return nil, errors.New("raft config is empty")
+	}
+
+	peers := make([]string, 0, len(raftCfg.Peers))
+	for id := range raftCfg.Peers {
+		peers = append(peers, id)
+	}
+
+	return raft.NewNode(
+		raft.Config{
+			ID:                raftCfg.NodeID,
+			Peers:             peers,
+			ElectionTimeout:   raftCfg.ElectionTimeout,
+			HeartbeatInterval: raftCfg.HeartbeatInterval,
+		},
+		raft.NewTCPTransport(raftCfg.Address, raftCfg.Peers, log),
+		raft.NewWALStore(walCfg.DataDirectory, maxSegmentSize, log),
+		stateMachine,
+		log)
+}
@@ -0,0 +1,37 @@
+package prepare
+
+import (
+	"antdb/config"
+	"antdb/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"os"
+)
+
+// CreateTracerProvider возвращает nil, если трассировка не настроена
+func CreateTracerProvider(ctx context.Context, tracingCfg *config.TracingConfig) (*sdktrace.TracerProvider, error) {
+	if tracingCfg == nil {
+		return nil, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch tracingCfg.Exporter {
+	case config.TracingExporterStdout:
+		exporter, err = tracing.NewStdoutExporter(os.Stdout)
+	case config.TracingExporterOTLPFile:
+		if tracingCfg.File == "" {
+			return nil, errors.New("file is required for otlp_file exporter")
+		}
+		exporter, err = tracing.NewFileExporter(ctx, tracingCfg.File)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %s", tracingCfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tracing.NewProvider(exporter, tracingCfg.SampleRatio), nil
+}
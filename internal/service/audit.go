@@ -0,0 +1,83 @@
+package service
+
+import (
+	"antdb/internal/audit"
+	"antdb/internal/network"
+	"antdb/internal/service/compute"
+	"context"
+	"time"
+)
+
+// auditedCommands - команды, которые попадают в журнал аудита: изменения
+// данных и администрирование. Вход пользователей записывает Authenticate,
+// чтобы в журнал попадали и входы через шлюзы
+var auditedCommands = map[compute.Command]bool{
+	compute.SetCommand:     true,
+	compute.DelCommand:     true,
+	compute.InfoCommand:    true,
+	compute.SlowLogCommand: true,
+	compute.MonitorCommand: true,
+}
+
+// WithAuditLog включает журнал аудита
+func WithAuditLog(log *audit.Log) DatabaseOption {
+	return func(d *Database) {
+		d.auditLog = log
+	}
+}
+
+// audit записывает выполненный запрос в журнал аудита. Отказы в доступе
+// тоже записываются, неразобранные запросы - нет
+func (d *Database) audit(ctx context.Context, query *compute.Query, result Result, err error, start time.Time) {
+	if d.auditLog == nil || query == nil || !auditedCommands[query.GetCommand()] {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:       start.UTC(),
+		ClientAddr: network.ClientAddr(ctx),
+		Command:    string(query.GetCommand()),
+		LSN:        result.LSN,
+		Result:     commandResult(err),
+	}
+	if user := sessionUser(ctx); user != nil {
+		entry.User = user.Name()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	arguments := query.GetArguments()
+	switch query.GetCommand() {
+	case compute.SetCommand:
+		entry.Key = arguments[0]
+		entry.Value = arguments[1]
+	case compute.DelCommand:
+		entry.Key = arguments[0]
+	default:
+		entry.Arguments = arguments
+	}
+
+	d.auditLog.Record(entry)
+}
+
+// auditAuth записывает попытку входа. При неудачном входе пользователя в
+// сессии нет, поэтому записывается переданное имя, пароль не записывается
+func (d *Database) auditAuth(ctx context.Context, name string, err error, start time.Time) {
+	if d.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:       start.UTC(),
+		User:       name,
+		ClientAddr: network.ClientAddr(ctx),
+		Command:    string(compute.AuthCommand),
+		Result:     commandResult(err),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	d.auditLog.Record(entry)
+}
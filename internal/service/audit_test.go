@@ -0,0 +1,95 @@
+package service
+
+import (
+	"antdb/internal/audit"
+	"antdb/internal/network"
+	"antdb/internal/service/auth"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+type auditBuffer struct {
+	bytes.Buffer
+}
+
+func (b *auditBuffer) Close() error {
+	return nil
+}
+
+func (b *auditBuffer) entries(t *testing.T) []audit.Entry {
+	t.Helper()
+
+	var entries []audit.Entry
+	decoder := json.NewDecoder(&b.Buffer)
+	for decoder.More() {
+		var entry audit.Entry
+		require.NoError(t, decoder.Decode(&entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestDatabase_Audit(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	buffer := &auditBuffer{}
+	db := newTestDatabase(t, acl, WithAuditLog(audit.NewLog(buffer, zap.NewNop())))
+	admin := network.WithClientAddr(network.WithSession(context.Background(), network.NewSession()), "127.0.0.1:5000")
+	reader := network.WithClientAddr(network.WithSession(context.Background(), network.NewSession()), "127.0.0.1:5001")
+
+	require.Equal(t, "[error] invalid username or password", db.HandleQuery(admin, "AUTH admin wrong"))
+	require.Equal(t, "[ok]", db.HandleQuery(admin, "AUTH admin secret"))
+	require.Equal(t, "[ok]", db.HandleQuery(admin, "SET key value"))
+	require.Equal(t, "[ok]", db.HandleQuery(admin, "DEL key"))
+	require.Equal(t, "[error] slowlog is not enabled", db.HandleQuery(admin, "SLOWLOG LEN"))
+	require.Equal(t, "[ok] PONG", db.HandleQuery(admin, "PING"))
+	require.Equal(t, "[error] not found", db.HandleQuery(admin, "GET key"))
+
+	require.Equal(t, "[ok]", db.HandleQuery(reader, "AUTH reader secret"))
+	require.Equal(t, "[error] command SET is not allowed", db.HandleQuery(reader, "SET key value"))
+
+	// чтение и PING не записываются, значения и пароли тоже
+	entries := buffer.entries(t)
+	require.Len(t, entries, 7)
+	for i := range entries {
+		require.False(t, entries[i].Time.IsZero())
+		entries[i].Time = entries[0].Time
+	}
+	start := entries[0].Time
+	require.Equal(t, []audit.Entry{
+		{Time: start, User: "admin", ClientAddr: "127.0.0.1:5000", Command: "AUTH", Result: "denied", Error: "invalid username or password"},
+		{Time: start, User: "admin", ClientAddr: "127.0.0.1:5000", Command: "AUTH", Result: "ok"},
+		{Time: start, User: "admin", ClientAddr: "127.0.0.1:5000", Command: "SET", Key: "key", Result: "ok"},
+		{Time: start, User: "admin", ClientAddr: "127.0.0.1:5000", Command: "DEL", Key: "key", Result: "ok"},
+		{Time: start, User: "admin", ClientAddr: "127.0.0.1:5000", Command: "SLOWLOG", Arguments: []string{"LEN"}, Result: "error", Error: "slowlog is not enabled"},
+		{Time: start, User: "reader", ClientAddr: "127.0.0.1:5001", Command: "AUTH", Result: "ok"},
+		{Time: start, User: "reader", ClientAddr: "127.0.0.1:5001", Command: "SET", Key: "key", Result: "denied", Error: "command SET is not allowed"},
+	}, entries)
+
+	// шлюзы входят через Authenticate, минуя разбор запроса
+	gateway := network.WithClientAddr(network.WithSession(context.Background(), network.NewSession()), "127.0.0.1:5002")
+	require.Error(t, db.Authenticate(gateway, "reader", "wrong"))
+	require.NoError(t, db.Authenticate(gateway, "reader", "secret"))
+
+	entries = buffer.entries(t)
+	require.Len(t, entries, 2)
+	require.Equal(t, "AUTH", entries[0].Command)
+	require.Equal(t, "reader", entries[0].User)
+	require.Equal(t, "127.0.0.1:5002", entries[0].ClientAddr)
+	require.Equal(t, "denied", entries[0].Result)
+	require.Equal(t, "AUTH", entries[1].Command)
+	require.Equal(t, "ok", entries[1].Result)
+}
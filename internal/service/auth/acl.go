@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/tools"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+var ErrAuthFailed = errors.New("invalid username or password")
+
+// Категории команд, которые можно указывать в правах пользователя вместо
+// отдельных команд
+const (
+	CategoryRead  = "read"
+	CategoryWrite = "write"
+	CategoryAdmin = "admin"
+	CategoryAll   = "all"
+)
+
+var categories = map[string][]compute.Command{
+	CategoryRead: {compute.GetCommand, compute.SubscribeCommand, compute.PSubscribeCommand,
+		compute.UnsubscribeCommand, compute.PUnsubscribeCommand, compute.PubSubCommand},
+	CategoryWrite: {compute.SetCommand, compute.DelCommand, compute.PublishCommand},
+	CategoryAdmin: {compute.InfoCommand, compute.SlowLogCommand, compute.MonitorCommand},
+}
+
+// dummyHash сравнивается с паролем неизвестного пользователя, чтобы по времени
+// ответа нельзя было узнать, существует ли он
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// UserRule - пользователь и его права: команды (или категории) и шаблоны
+// ключей, где * заменяет любую последовательность символов
+type UserRule struct {
+	Name         string
+	PasswordHash string
+	Commands     []string
+	Keys         []string
+}
+
+type User struct {
+	name         string
+	passwordHash []byte
+	commands     map[compute.Command]bool
+	keys         []string
+}
+
+func (u *User) Name() string {
+	return u.name
+}
+
+// CanExecute проверяет, разрешена ли пользователю команда
+func (u *User) CanExecute(command compute.Command) bool {
+	return u.commands[command]
+}
+
+// CanAccess проверяет, подходит ли ключ под один из разрешенных шаблонов
+func (u *User) CanAccess(key string) bool {
+	for _, pattern := range u.keys {
+		if tools.MatchPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+type ACL struct {
+	users map[string]*User
+	cache *credentialsCache
+}
+
+func NewACL(rules []UserRule) (*ACL, error) {
+	acl := &ACL{
+		users: make(map[string]*User, len(rules)),
+		cache: newCredentialsCache(),
+	}
+
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("empty user name")
+		}
+		if _, ok := acl.users[rule.Name]; ok {
+			return nil, fmt.Errorf("duplicate user %s", rule.Name)
+		}
+		if _, err := bcrypt.Cost([]byte(rule.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("invalid password hash for user %s: %w", rule.Name, err)
+		}
+
+		commands, err := parseCommands(rule.Commands)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commands for user %s: %w", rule.Name, err)
+		}
+
+		acl.users[rule.Name] = &User{
+			name:         rule.Name,
+			passwordHash: []byte(rule.PasswordHash),
+			commands:     commands,
+			keys:         rule.Keys,
+		}
+	}
+
+	return acl, nil
+}
+
+// Authenticate проверяет пароль и возвращает пользователя. Успешный вход
+// запоминается на credentialsTTL, чтобы запросы шлюзов с тем же паролем не
+// проверяли bcrypt каждый раз
+func (a *ACL) Authenticate(name, password string) (*User, error) {
+	if user, ok := a.cache.get(name, password); ok {
+		return user, nil
+	}
+
+	user, ok := a.users[name]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrAuthFailed
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)); err != nil {
+		return nil, ErrAuthFailed
+	}
+
+	a.cache.put(name, password, user)
+	return user, nil
+}
+
+func parseCommands(names []string) (map[compute.Command]bool, error) {
+	commands := make(map[compute.Command]bool)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == CategoryAll {
+			for _, category := range categories {
+				for _, command := range category {
+					commands[command] = true
+				}
+			}
+			continue
+		}
+
+		if category, ok := categories[name]; ok {
+			for _, command := range category {
+				commands[command] = true
+			}
+			continue
+		}
+
+		command := compute.Command(strings.ToUpper(name))
+		if !isKnownCommand(command) {
+			return nil, fmt.Errorf("unknown command or category %s", name)
+		}
+		commands[command] = true
+	}
+
+	return commands, nil
+}
+
+func isKnownCommand(command compute.Command) bool {
+	for _, category := range categories {
+		for _, known := range category {
+			if known == command {
+				return true
+			}
+		}
+	}
+	return false
+}
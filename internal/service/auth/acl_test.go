@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"antdb/internal/service/compute"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func hashPassword(t *testing.T, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func TestACL_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	acl, err := NewACL([]UserRule{
+		{Name: "admin", PasswordHash: hashPassword(t, "secret"), Commands: []string{"all"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	user, err := acl.Authenticate("admin", "secret")
+	require.NoError(t, err)
+	require.Equal(t, "admin", user.Name())
+
+	_, err = acl.Authenticate("admin", "wrong")
+	require.ErrorIs(t, err, ErrAuthFailed)
+
+	_, err = acl.Authenticate("unknown", "secret")
+	require.ErrorIs(t, err, ErrAuthFailed)
+}
+
+func TestACL_AuthenticateCache(t *testing.T) {
+	t.Parallel()
+
+	acl, err := NewACL([]UserRule{
+		{Name: "admin", PasswordHash: hashPassword(t, "secret"), Commands: []string{"all"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	acl.cache.now = func() time.Time { return now }
+
+	user, err := acl.Authenticate("admin", "secret")
+	require.NoError(t, err)
+
+	// проверенный пароль не сверяется с хэшем повторно
+	acl.users["admin"].passwordHash = []byte(hashPassword(t, "changed"))
+	cached, err := acl.Authenticate("admin", "secret")
+	require.NoError(t, err)
+	require.Same(t, user, cached)
+
+	// неверный пароль не попадает в кэш и не пользуется чужой записью
+	_, err = acl.Authenticate("admin", "wrong")
+	require.ErrorIs(t, err, ErrAuthFailed)
+
+	now = now.Add(credentialsTTL)
+	_, err = acl.Authenticate("admin", "secret")
+	require.ErrorIs(t, err, ErrAuthFailed)
+}
+
+func TestCredentialsCache_Limit(t *testing.T) {
+	t.Parallel()
+
+	cache := newCredentialsCache()
+	user := &User{name: "admin"}
+	for i := 0; i < maxCachedCredentials+1; i++ {
+		cache.put("admin", strconv.Itoa(i), user)
+	}
+	require.LessOrEqual(t, len(cache.entries), maxCachedCredentials)
+
+	_, ok := cache.get("admin", strconv.Itoa(maxCachedCredentials))
+	require.True(t, ok)
+}
+
+func TestNewACL_InvalidRules(t *testing.T) {
+	tests := map[string][]UserRule{
+		"empty name": {
+			{PasswordHash: hashPassword(t, "secret")},
+		},
+		"plain password": {
+			{Name: "user", PasswordHash: "secret"},
+		},
+		"unknown command": {
+			{Name: "user", PasswordHash: hashPassword(t, "secret"), Commands: []string{"truncate"}},
+		},
+		"duplicate user": {
+			{Name: "user", PasswordHash: hashPassword(t, "secret")},
+			{Name: "user", PasswordHash: hashPassword(t, "secret")},
+		},
+	}
+
+	for name, rules := range tests {
+		rules := rules
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewACL(rules)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestUser_CanExecute(t *testing.T) {
+	t.Parallel()
+
+	acl, err := NewACL([]UserRule{
+		{Name: "reader", PasswordHash: hashPassword(t, "secret"), Commands: []string{"read"}},
+		{Name: "writer", PasswordHash: hashPassword(t, "secret"), Commands: []string{"read", "write"}},
+		{Name: "deleter", PasswordHash: hashPassword(t, "secret"), Commands: []string{"del"}},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		user    string
+		command compute.Command
+		allowed bool
+	}{
+		"reader can get":       {user: "reader", command: compute.GetCommand, allowed: true},
+		"reader can't set":     {user: "reader", command: compute.SetCommand},
+		"reader can't info":    {user: "reader", command: compute.InfoCommand},
+		"writer can del":       {user: "writer", command: compute.DelCommand, allowed: true},
+		"writer can't info":    {user: "writer", command: compute.InfoCommand},
+		"single command":       {user: "deleter", command: compute.DelCommand, allowed: true},
+		"other command denied": {user: "deleter", command: compute.SetCommand},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			user, err := acl.Authenticate(test.user, "secret")
+			require.NoError(t, err)
+			require.Equal(t, test.allowed, user.CanExecute(test.command))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const (
+	// credentialsTTL - сколько проверенный пароль не сверяется с bcrypt
+	// повторно. Шлюзы проверяют пароль на каждый запрос
+	credentialsTTL = 30 * time.Second
+	// maxCachedCredentials ограничивает память при переборе пользователей
+	maxCachedCredentials = 1024
+)
+
+// credentialsCache запоминает успешные входы. Ключ - хэш имени и пароля,
+// сам пароль не хранится. Неудачные входы не запоминаются
+type credentialsCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]cachedCredentials
+	now     func() time.Time
+}
+
+type cachedCredentials struct {
+	user    *User
+	expires time.Time
+}
+
+func newCredentialsCache() *credentialsCache {
+	return &credentialsCache{
+		entries: make(map[[sha256.Size]byte]cachedCredentials),
+		now:     time.Now,
+	}
+}
+
+func credentialsKey(name, password string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(name + "\x00" + password))
+}
+
+func (c *credentialsCache) get(name, password string) (*User, bool) {
+	key := credentialsKey(name, password)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.user, true
+}
+
+func (c *credentialsCache) put(name, password string, user *User) {
+	key := credentialsKey(name, password)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxCachedCredentials {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	// все записи еще действуют - проще начать заново, чем искать старейшую
+	if len(c.entries) >= maxCachedCredentials {
+		clear(c.entries)
+	}
+
+	c.entries[key] = cachedCredentials{user: user, expires: now.Add(credentialsTTL)}
+}
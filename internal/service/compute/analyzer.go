@@ -28,10 +28,33 @@ func (a *Analyzer) Analyze(tokens []string) (*Query, error) {
 		return nil, errInvalidCommand
 	}
 
-	if len(tokens) != queryMap[command] {
+	argumentsNumber := queryMap[command]
+	if len(tokens) < argumentsNumber {
 		logAnalyzer.Debug("invalid query attributes")
 		return nil, errInvalidArguments
 	}
 
-	return NewQuery(command, tokens[1:]), nil
+	// необязательный аргумент не может совпадать с общим модификатором
+	for optional := optionalArgumentsMap[command]; optional > 0 && argumentsNumber < len(tokens); optional-- {
+		if _, ok := commonModifierMap[tokens[argumentsNumber]]; ok {
+			break
+		}
+		argumentsNumber++
+	}
+
+	query := NewQuery(command, tokens[1:argumentsNumber])
+	for modifiers := tokens[argumentsNumber:]; len(modifiers) > 0; {
+		number, ok := modifierMap[command][modifiers[0]]
+		if !ok {
+			number, ok = commonModifierMap[modifiers[0]]
+		}
+		if !ok || len(modifiers) <= number {
+			logAnalyzer.Debug("invalid query modifiers")
+			return nil, errInvalidArguments
+		}
+		query.SetModifier(modifiers[0], modifiers[1:number+1])
+		modifiers = modifiers[number+1:]
+	}
+
+	return query, nil
 }
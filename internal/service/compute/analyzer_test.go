@@ -32,6 +32,18 @@ func TestAnalyzer_Analyze(t *testing.T) {
 			tokens: []string{"GET", "key", "value"},
 			err:    errInvalidArguments,
 		},
+		"valid slowlog query": {
+			tokens: []string{"SLOWLOG", "GET", "10"},
+			query:  NewQuery(SlowLogCommand, []string{"GET", "10"}),
+		},
+		"invalid number arguments for slowlog query": {
+			tokens: []string{"SLOWLOG"},
+			err:    errInvalidArguments,
+		},
+		"invalid number arguments for monitor query": {
+			tokens: []string{"MONITOR", "all"},
+			err:    errInvalidArguments,
+		},
 		"valid set query": {
 			tokens: []string{"SET", "key", "value"},
 			query:  NewQuery(SetCommand, []string{"key", "value"}),
@@ -44,6 +56,121 @@ func TestAnalyzer_Analyze(t *testing.T) {
 			tokens: []string{"DEL", "key"},
 			query:  NewQuery(DelCommand, []string{"key"}),
 		},
+		"valid set query with wait": {
+			tokens: []string{"SET", "key", "value", "WAIT", "2", "100"},
+			query: &Query{
+				command:   SetCommand,
+				arguments: []string{"key", "value"},
+				modifiers: map[string][]string{WaitModifier: {"2", "100"}},
+			},
+		},
+		"valid get query with min lsn": {
+			tokens: []string{"GET", "key", "MINLSN", "42"},
+			query: &Query{
+				command:   GetCommand,
+				arguments: []string{"key"},
+				modifiers: map[string][]string{MinLSNModifier: {"42"}},
+			},
+		},
+		"valid set query with wait and trace parent": {
+			tokens: []string{"SET", "key", "value", "TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "WAIT", "1", "100"},
+			query: &Query{
+				command:   SetCommand,
+				arguments: []string{"key", "value"},
+				modifiers: map[string][]string{
+					TraceParentModifier: {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+					WaitModifier:        {"1", "100"},
+				},
+			},
+		},
+		"valid info query with trace parent": {
+			tokens: []string{"INFO", "TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			query: &Query{
+				command:   InfoCommand,
+				arguments: []string{},
+				modifiers: map[string][]string{
+					TraceParentModifier: {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+				},
+			},
+		},
+		"invalid number arguments for wait modifier": {
+			tokens: []string{"DEL", "key", "WAIT", "2"},
+			err:    errInvalidArguments,
+		},
+		"valid info query": {
+			tokens: []string{"INFO"},
+			query:  NewQuery(InfoCommand, []string{}),
+		},
+		"valid info query with section": {
+			tokens: []string{"INFO", "replication"},
+			query:  NewQuery(InfoCommand, []string{"replication"}),
+		},
+		"invalid number arguments for info query": {
+			tokens: []string{"INFO", "replication", "server"},
+			err:    errInvalidArguments,
+		},
+		"valid ping query": {
+			tokens: []string{"PING"},
+			query:  NewQuery(PingCommand, []string{}),
+		},
+		"valid ping query with message": {
+			tokens: []string{"PING", "hello"},
+			query:  NewQuery(PingCommand, []string{"hello"}),
+		},
+		"invalid number arguments for ping query": {
+			tokens: []string{"PING", "hello", "world"},
+			err:    errInvalidArguments,
+		},
+		"valid subscribe query": {
+			tokens: []string{"SUBSCRIBE", "__keyspace__/a", "__keyspace__/b"},
+			query:  NewQuery(SubscribeCommand, []string{"__keyspace__/a", "__keyspace__/b"}),
+		},
+		"valid psubscribe query with trace parent": {
+			tokens: []string{"PSUBSCRIBE", "__keyspace__/*", "TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			query: &Query{
+				command:   PSubscribeCommand,
+				arguments: []string{"__keyspace__/*"},
+				modifiers: map[string][]string{
+					TraceParentModifier: {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+				},
+			},
+		},
+		"invalid number arguments for subscribe query": {
+			tokens: []string{"SUBSCRIBE"},
+			err:    errInvalidArguments,
+		},
+		"valid unsubscribe query without channels": {
+			tokens: []string{"UNSUBSCRIBE"},
+			query:  NewQuery(UnsubscribeCommand, []string{}),
+		},
+		"valid punsubscribe query": {
+			tokens: []string{"PUNSUBSCRIBE", "news*", "weather*"},
+			query:  NewQuery(PUnsubscribeCommand, []string{"news*", "weather*"}),
+		},
+		"valid publish query": {
+			tokens: []string{"PUBLISH", "news", "hello"},
+			query:  NewQuery(PublishCommand, []string{"news", "hello"}),
+		},
+		"invalid number arguments for publish query": {
+			tokens: []string{"PUBLISH", "news", "hello", "world"},
+			err:    errInvalidArguments,
+		},
+		"valid pubsub query": {
+			tokens: []string{"PUBSUB", "CHANNELS", "news*"},
+			query:  NewQuery(PubSubCommand, []string{"CHANNELS", "news*"}),
+		},
+		"valid auth query": {
+			tokens: []string{"AUTH", "user", "password"},
+			query:  NewQuery(AuthCommand, []string{"user", "password"}),
+		},
+		"invalid number arguments for auth query": {
+			tokens: []string{"AUTH", "user"},
+			err:    errInvalidArguments,
+		},
+		"unsupported modifier": {
+			tokens: []string{"GET", "key", "WAIT", "2", "100"},
+			err:    errInvalidArguments,
+		},
 	}
 
 	analyzer := NewAnalyzer(zap.NewNop())
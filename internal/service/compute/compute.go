@@ -28,15 +28,20 @@ func NewCompute(parser parser, analyzer analyzer, logger *zap.Logger) *Compute {
 }
 
 func (d *Compute) HandleQuery(_ context.Context, queryStr string) (*Query, error) {
-	tokens, err := d.parser.Parse(queryStr)
+	tokens, err := d.Parse(queryStr)
 	if err != nil {
 		return nil, err
 	}
 
-	query, err := d.analyzer.Analyze(tokens)
-	if err != nil {
-		return nil, err
-	}
+	return d.Analyze(tokens)
+}
+
+// Parse и Analyze - шаги HandleQuery по отдельности, чтобы вызывающий мог
+// измерить каждый из них
+func (d *Compute) Parse(queryStr string) ([]string, error) {
+	return d.parser.Parse(queryStr)
+}
 
-	return query, nil
+func (d *Compute) Analyze(tokens []string) (*Query, error) {
+	return d.analyzer.Analyze(tokens)
 }
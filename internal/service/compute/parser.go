@@ -77,6 +77,20 @@ func (p *Parser) Parse(query string) ([]string, error) {
 	return tokens, nil
 }
 
+// IsValidArgument проверяет, что аргумент можно передать в текстовом
+// протоколе: он не пуст и состоит из тех же символов, что разбирает Parser
+func IsValidArgument(argument string) bool {
+	if argument == "" {
+		return false
+	}
+	for i := 0; i < len(argument); i++ {
+		if !isLetter(argument[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func isSpaceSymbol(symbol byte) bool {
 	return symbol == '\t' || symbol == '\n' || symbol == ' '
 }
@@ -87,5 +101,6 @@ func isLetter(symbol byte) bool {
 		(symbol >= '0' && symbol <= '9') ||
 		(symbol == '*') ||
 		(symbol == '/') ||
-		(symbol == '_')
+		(symbol == '_') ||
+		(symbol == '-')
 }
@@ -39,6 +39,10 @@ func TestParser_Parse(t *testing.T) {
 			query:  "_set__",
 			tokens: []string{"_set__"},
 		},
+		"query with trace parent": {
+			query:  "get key TRACEPARENT 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			tokens: []string{"get", "key", "TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		},
 		"query with one token with invalid symbols": {
 			query: ".set#",
 			err:   ErrInvalidSymbol,
@@ -2,20 +2,71 @@ package compute
 
 import (
 	"errors"
+	"math"
 )
 
 type Command string
 
 const (
-	SetCommand Command = "SET"
-	GetCommand Command = "GET"
-	DelCommand Command = "DEL"
+	SetCommand  Command = "SET"
+	GetCommand  Command = "GET"
+	DelCommand  Command = "DEL"
+	InfoCommand Command = "INFO"
+	AuthCommand Command = "AUTH"
+	// SLOWLOG GET [n] | LEN | RESET
+	SlowLogCommand Command = "SLOWLOG"
+	MonitorCommand Command = "MONITOR"
+	// PING [message]
+	PingCommand Command = "PING"
+	// SUBSCRIBE channel [channel ...]
+	SubscribeCommand Command = "SUBSCRIBE"
+	// PSUBSCRIBE pattern [pattern ...]
+	PSubscribeCommand Command = "PSUBSCRIBE"
+	// UNSUBSCRIBE [channel ...]
+	UnsubscribeCommand Command = "UNSUBSCRIBE"
+	// PUNSUBSCRIBE [pattern ...]
+	PUnsubscribeCommand Command = "PUNSUBSCRIBE"
+	// PUBLISH channel message
+	PublishCommand Command = "PUBLISH"
+	// PUBSUB CHANNELS [pattern]
+	PubSubCommand Command = "PUBSUB"
 )
 
 const (
 	setArgumentsNumber = 3
 	getArgumentsNumber = 2
 	delArgumentsNumber = 2
+	// INFO [section]
+	infoArgumentsNumber = 1
+	authArgumentsNumber = 3
+	// SLOWLOG subcommand [n]
+	slowLogArgumentsNumber      = 2
+	monitorArgumentsNumber      = 1
+	pingArgumentsNumber         = 1
+	subscribeArgumentsNumber    = 2
+	psubscribeArgumentsNumber   = 2
+	unsubscribeArgumentsNumber  = 1
+	punsubscribeArgumentsNumber = 1
+	publishArgumentsNumber      = 3
+	// PUBSUB subcommand [pattern]
+	pubSubArgumentsNumber = 2
+)
+
+// manyArguments - необязательных аргументов может быть сколько угодно
+const manyArguments = math.MaxInt
+
+// Модификаторы дописываются после аргументов команды, например SET key value WAIT 1 100
+const (
+	WaitModifier   = "WAIT"
+	MinLSNModifier = "MINLSN"
+	// TRACEPARENT 00-<trace-id>-<span-id>-<flags> продолжает трассировку клиента
+	TraceParentModifier = "TRACEPARENT"
+)
+
+const (
+	waitArgumentsNumber        = 2
+	minLSNArgumentsNumber      = 1
+	traceParentArgumentsNumber = 1
 )
 
 var (
@@ -24,20 +75,73 @@ var (
 )
 
 var commandMap = map[string]Command{
-	"SET": SetCommand,
-	"GET": GetCommand,
-	"DEL": DelCommand,
+	"SET":          SetCommand,
+	"GET":          GetCommand,
+	"DEL":          DelCommand,
+	"INFO":         InfoCommand,
+	"AUTH":         AuthCommand,
+	"SLOWLOG":      SlowLogCommand,
+	"MONITOR":      MonitorCommand,
+	"PING":         PingCommand,
+	"SUBSCRIBE":    SubscribeCommand,
+	"PSUBSCRIBE":   PSubscribeCommand,
+	"UNSUBSCRIBE":  UnsubscribeCommand,
+	"PUNSUBSCRIBE": PUnsubscribeCommand,
+	"PUBLISH":      PublishCommand,
+	"PUBSUB":       PubSubCommand,
 }
 
 var queryMap = map[Command]int{
-	SetCommand: setArgumentsNumber,
-	GetCommand: getArgumentsNumber,
-	DelCommand: delArgumentsNumber,
+	SetCommand:          setArgumentsNumber,
+	GetCommand:          getArgumentsNumber,
+	DelCommand:          delArgumentsNumber,
+	InfoCommand:         infoArgumentsNumber,
+	AuthCommand:         authArgumentsNumber,
+	SlowLogCommand:      slowLogArgumentsNumber,
+	MonitorCommand:      monitorArgumentsNumber,
+	PingCommand:         pingArgumentsNumber,
+	SubscribeCommand:    subscribeArgumentsNumber,
+	PSubscribeCommand:   psubscribeArgumentsNumber,
+	UnsubscribeCommand:  unsubscribeArgumentsNumber,
+	PUnsubscribeCommand: punsubscribeArgumentsNumber,
+	PublishCommand:      publishArgumentsNumber,
+	PubSubCommand:       pubSubArgumentsNumber,
+}
+
+// keyArgumentsMap - сколько первых аргументов команды являются ключами
+var keyArgumentsMap = map[Command]int{
+	SetCommand: 1,
+	GetCommand: 1,
+	DelCommand: 1,
+}
+
+// optionalArgumentsMap - сколько необязательных аргументов может идти после обязательных
+var optionalArgumentsMap = map[Command]int{
+	InfoCommand:         1,
+	SlowLogCommand:      1,
+	PingCommand:         1,
+	SubscribeCommand:    manyArguments,
+	PSubscribeCommand:   manyArguments,
+	UnsubscribeCommand:  manyArguments,
+	PUnsubscribeCommand: manyArguments,
+	PubSubCommand:       1,
+}
+
+var modifierMap = map[Command]map[string]int{
+	GetCommand: {MinLSNModifier: minLSNArgumentsNumber},
+	SetCommand: {WaitModifier: waitArgumentsNumber},
+	DelCommand: {WaitModifier: waitArgumentsNumber},
+}
+
+// commonModifierMap - модификаторы, допустимые для любой команды
+var commonModifierMap = map[string]int{
+	TraceParentModifier: traceParentArgumentsNumber,
 }
 
 type Query struct {
 	command   Command
 	arguments []string
+	modifiers map[string][]string
 }
 
 func NewQuery(command Command, arguments []string) *Query {
@@ -55,6 +159,25 @@ func (q *Query) GetArguments() []string {
 	return q.arguments
 }
 
+// GetKeys возвращает ключи, к которым обращается запрос
+func (q *Query) GetKeys() []string {
+	return q.arguments[:min(keyArgumentsMap[q.command], len(q.arguments))]
+}
+
+// GetModifier возвращает аргументы модификатора, если он был указан
+func (q *Query) GetModifier(name string) ([]string, bool) {
+	arguments, ok := q.modifiers[name]
+	return arguments, ok
+}
+
+// SetModifier добавляет модификатор к запросу, например WAIT для записи
+func (q *Query) SetModifier(name string, arguments []string) {
+	if q.modifiers == nil {
+		q.modifiers = make(map[string][]string)
+	}
+	q.modifiers[name] = arguments
+}
+
 func mapCommand(word string) (Command, error) {
 	command, ok := commandMap[word]
 	if !ok {
@@ -107,3 +107,32 @@ func TestQueryArgumentNumber(t *testing.T) {
 		})
 	}
 }
+
+func TestQuery_GetKeys(t *testing.T) {
+	tests := map[string]struct {
+		query *Query
+		keys  []string
+	}{
+		"set command": {
+			query: NewQuery(SetCommand, []string{"key", "value"}),
+			keys:  []string{"key"},
+		},
+		"del command": {
+			query: NewQuery(DelCommand, []string{"key"}),
+			keys:  []string{"key"},
+		},
+		"command without keys": {
+			query: NewQuery(AuthCommand, []string{"user", "password"}),
+			keys:  []string{},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, test.keys, test.query.GetKeys())
+		})
+	}
+}
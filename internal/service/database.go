@@ -1,39 +1,243 @@
 package service
 
 import (
+	"antdb/internal/audit"
+	"antdb/internal/network"
+	"antdb/internal/service/auth"
 	"antdb/internal/service/compute"
+	"antdb/internal/service/limit"
+	"antdb/internal/service/pubsub"
 	"antdb/internal/service/storage"
+	"antdb/internal/service/storage/replication"
+	"antdb/internal/service/storage/wal"
 	"context"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Database struct {
 	compute *compute.Compute
 	storage *storage.Storage
-	logger  *zap.Logger
+	// чтение с MINLSN ждет не дольше readWaitTimeout, затем клиента
+	// отправляют на redirectAddress (обычно адрес мастера)
+	readWaitTimeout time.Duration
+	redirectAddress string
+	// acl == nil - аутентификация отключена
+	acl *auth.ACL
+	// limiter == nil - частота запросов не ограничена
+	limiter  *limit.Limiter
+	slowLog  *SlowLog
+	monitors monitors
+	// auditLog == nil - журнал аудита отключен
+	auditLog *audit.Log
+	// pubsub == nil - PUBLISH и подписки отключены
+	pubsub *pubsub.Hub
+	// сведения для INFO, см. info.go
+	started    time.Time
+	version    string
+	config     map[string]string
+	clients    Clients
+	walDir     string
+	compaction *wal.Compaction
+	logger     *zap.Logger
 }
 
-func NewDatabase(compute *compute.Compute, storage *storage.Storage, logger *zap.Logger) *Database {
-	return &Database{
-		compute: compute,
-		storage: storage,
-		logger:  logger,
+type DatabaseOption func(*Database)
+
+// WithSlowLog включает журнал медленных запросов, доступный по SLOWLOG
+func WithSlowLog(slowLog *SlowLog) DatabaseOption {
+	return func(d *Database) {
+		d.slowLog = slowLog
+	}
+}
+
+// WithRateLimiter ограничивает частоту запросов: аутентифицированных клиентов
+// по имени пользователя, остальных по IP-адресу
+func WithRateLimiter(limiter *limit.Limiter) DatabaseOption {
+	return func(d *Database) {
+		d.limiter = limiter
+	}
+}
+
+// WithServerInfo задает версию сервера и сводку конфигурации для INFO server
+func WithServerInfo(version string, config map[string]string) DatabaseOption {
+	return func(d *Database) {
+		d.version = version
+		d.config = config
+	}
+}
+
+// Clients - счетчики соединений сервера для INFO clients
+type Clients interface {
+	ActiveConnections() int
+	MaxConnections() int
+	OverflowedConnections() uint64
+}
+
+func WithClients(clients Clients) DatabaseOption {
+	return func(d *Database) {
+		d.clients = clients
 	}
 }
 
+// WithPersistence задает каталог журнала и сжатие для INFO persistence,
+// compaction == nil - сжатие отключено
+func WithPersistence(directory string, compaction *wal.Compaction) DatabaseOption {
+	return func(d *Database) {
+		d.walDir = directory
+		d.compaction = compaction
+	}
+}
+
+type sessionKey int
+
+const (
+	userKey sessionKey = iota
+	subscriberKey
+)
+
+func NewDatabase(
+	compute *compute.Compute,
+	storage *storage.Storage,
+	readWaitTimeout time.Duration,
+	redirectAddress string,
+	acl *auth.ACL,
+	logger *zap.Logger,
+	options ...DatabaseOption,
+) *Database {
+	d := &Database{
+		compute:         compute,
+		storage:         storage,
+		readWaitTimeout: readWaitTimeout,
+		redirectAddress: redirectAddress,
+		acl:             acl,
+		started:         time.Now(),
+		logger:          logger,
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	return d
+}
+
+// Ошибки запросов. Текст ошибки складывается из сентинела и подробностей,
+// например "command DEL is not allowed", а шлюзы выбирают по ним код ответа
+var (
+	ErrAuthRequired    = errors.New("authentication required")
+	ErrAuthDisabled    = errors.New("authentication is not enabled")
+	ErrForbidden       = errors.New("not allowed")
+	ErrInvalidArgument = errors.New("invalid")
+	ErrMoved           = errors.New("MOVED")
+	ErrRateLimited     = limit.ErrLimited
+)
+
+// Result - ответ на запрос: значение для чтения и LSN для записи
+type Result struct {
+	Value string
+	LSN   uint64
+}
+
 type QueryHandler interface {
 	HandleQuery(ctx context.Context, queryStr string) string
 }
 
 func (d *Database) HandleQuery(ctx context.Context, queryStr string) string {
-	d.logger.Debug("handling query", zap.String("query", queryStr))
-
-	query, err := d.compute.HandleQuery(ctx, queryStr)
+	start := time.Now()
+	query, result, err := d.handleQuery(ctx, queryStr)
+	d.logQuery(query, err)
+	d.observe(ctx, query, err, start)
+	d.audit(ctx, query, result, err, start)
 	if err != nil {
 		return fmt.Sprintf("[error] %s", err.Error())
 	}
 
+	switch {
+	case query.GetCommand() == compute.SetCommand, query.GetCommand() == compute.DelCommand:
+		return writeResponse(result.LSN)
+	case result.Value == "":
+		return "[ok]"
+	default:
+		return fmt.Sprintf("[ok] %s", result.Value)
+	}
+}
+
+// handleQuery разбирает и выполняет запрос. Если запрос не разобран, query == nil
+func (d *Database) handleQuery(ctx context.Context, queryStr string) (query *compute.Query, result Result, err error) {
+	ctx, span, query, err := d.parseQuery(ctx, queryStr)
+	defer func() {
+		endQuerySpan(span, err)
+	}()
+	if err != nil {
+		return nil, Result{}, err
+	}
+
+	// AUTH и PING доступны без аутентификации
+	switch query.GetCommand() {
+	case compute.AuthCommand:
+		err = d.Authenticate(ctx, query.GetArguments()[0], query.GetArguments()[1])
+		if !errors.Is(err, ErrRateLimited) {
+			d.monitors.publish(ctx, query)
+		}
+		return query, Result{}, err
+	case compute.PingCommand:
+		if err = d.limit(ctx, query); err != nil {
+			return query, Result{}, err
+		}
+		d.monitors.publish(ctx, query)
+		return query, handlePing(query), nil
+	}
+
+	result, err = d.execute(ctx, query)
+	return query, result, err
+}
+
+// Execute проверяет права пользователя сессии и выполняет разобранный запрос
+func (d *Database) Execute(ctx context.Context, query *compute.Query) (Result, error) {
+	start := time.Now()
+	ctx, span := startQuerySpan(ctx, query, start)
+	var result Result
+	err := validateArguments(query)
+	if err == nil {
+		result, err = d.execute(ctx, query)
+	}
+	endQuerySpan(span, err)
+	d.observe(ctx, query, err, start)
+	d.audit(ctx, query, result, err, start)
+	return result, err
+}
+
+// validateArguments не пропускает из шлюзов ключи и значения, которые нельзя
+// записать в текстовом протоколе: их нельзя было бы прочитать по TCP, а
+// перевод строки в значении сломал бы разбор ответов
+func validateArguments(query *compute.Query) error {
+	for _, argument := range query.GetArguments() {
+		if !compute.IsValidArgument(argument) {
+			return fmt.Errorf("%w argument %q", ErrInvalidArgument, argument)
+		}
+	}
+	return nil
+}
+
+func (d *Database) execute(ctx context.Context, query *compute.Query) (Result, error) {
+	if err := d.limit(ctx, query); err != nil {
+		return Result{}, err
+	}
+
+	if err := d.authorize(ctx, query); err != nil {
+		return Result{}, err
+	}
+
+	// мониторы видят только разрешенные команды. Команда отправляется до
+	// выполнения, чтобы MONITOR не попадал в собственный поток
+	d.monitors.publish(ctx, query)
+
 	switch query.GetCommand() {
 	case compute.SetCommand:
 		return d.handleSet(ctx, query)
@@ -41,33 +245,288 @@ func (d *Database) HandleQuery(ctx context.Context, queryStr string) string {
 		return d.handleGet(ctx, query)
 	case compute.DelCommand:
 		return d.handleDel(ctx, query)
+	case compute.InfoCommand:
+		return d.handleInfo(ctx, query)
+	case compute.SlowLogCommand:
+		return d.handleSlowLog(ctx, query)
+	case compute.MonitorCommand:
+		return d.handleMonitor(ctx, query)
+	case compute.SubscribeCommand, compute.PSubscribeCommand:
+		return d.handleSubscribe(ctx, query)
+	case compute.UnsubscribeCommand, compute.PUnsubscribeCommand:
+		return d.handleUnsubscribe(ctx, query)
+	case compute.PublishCommand:
+		return d.handlePublish(ctx, query)
+	case compute.PubSubCommand:
+		return d.handlePubSub(ctx, query)
 	}
 
-	d.logger.Error("can't handle query", zap.String("query", queryStr))
-	return "[error] internal error"
+	d.logger.Error("can't execute query", zap.String("command", string(query.GetCommand())))
+	return Result{}, errors.New("internal error")
 }
 
-func (d *Database) handleSet(ctx context.Context, query *compute.Query) string {
-	err := d.storage.Set(ctx, query.GetArguments()[0], query.GetArguments()[1])
+// logQuery пишет запрос в отладочный лог с теми же сокрытиями, что в
+// SLOWLOG и MONITOR. Текст неразобранного запроса не пишется: в нем может
+// быть пароль
+func (d *Database) logQuery(query *compute.Query, err error) {
+	if query == nil {
+		d.logger.Debug("can't parse query", zap.Error(err))
+		return
+	}
+
+	d.logger.Debug("handled query", zap.Strings("query", loggedArguments(query)), zap.Error(err))
+}
+
+// Authenticate проверяет пароль и запоминает пользователя в сессии соединения.
+// Попытки входа списываются со счета клиента и пишутся в журнал аудита по
+// всем протоколам одинаково
+func (d *Database) Authenticate(ctx context.Context, name, password string) (err error) {
+	start := time.Now()
+	defer func() {
+		d.auditAuth(ctx, name, err, start)
+	}()
+
+	if d.acl == nil {
+		return ErrAuthDisabled
+	}
+
+	if err = d.limit(ctx, compute.NewQuery(compute.AuthCommand, []string{name, password})); err != nil {
+		return err
+	}
+
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return errors.New("authentication is not supported by connection")
+	}
+
+	user, err := d.acl.Authenticate(name, password)
 	if err != nil {
-		return fmt.Sprintf("[error] %s", err.Error())
+		d.logger.Warn("authentication failed",
+			zap.String("user", name),
+			zap.String("address", network.ClientAddr(ctx)))
+		return err
+	}
+
+	session.Set(userKey, user)
+	return nil
+}
+
+// handlePing отвечает PONG или переданным сообщением: так клиент проверяет,
+// что соединение живо
+func handlePing(query *compute.Query) Result {
+	if arguments := query.GetArguments(); len(arguments) > 0 {
+		return Result{Value: arguments[0]}
+	}
+	return Result{Value: "PONG"}
+}
+
+// authorize проверяет, что пользователь соединения может выполнить запрос
+func (d *Database) authorize(ctx context.Context, query *compute.Query) error {
+	if d.acl == nil {
+		return nil
 	}
 
-	return "[ok]"
+	user := sessionUser(ctx)
+	if user == nil {
+		d.logger.Warn("access denied: not authenticated",
+			zap.String("command", string(query.GetCommand())),
+			zap.String("address", network.ClientAddr(ctx)))
+		return ErrAuthRequired
+	}
+
+	if !user.CanExecute(query.GetCommand()) {
+		d.logger.Warn("access denied: command is not allowed",
+			zap.String("user", user.Name()),
+			zap.String("command", string(query.GetCommand())),
+			zap.String("address", network.ClientAddr(ctx)))
+		return fmt.Errorf("command %s is %w", query.GetCommand(), ErrForbidden)
+	}
+
+	for _, key := range query.GetKeys() {
+		if !user.CanAccess(key) {
+			d.logger.Warn("access denied: key is not allowed",
+				zap.String("user", user.Name()),
+				zap.String("command", string(query.GetCommand())),
+				zap.String("key", key),
+				zap.String("address", network.ClientAddr(ctx)))
+			return fmt.Errorf("key %s is %w", key, ErrForbidden)
+		}
+	}
+
+	return nil
+}
+
+// limit списывает запрос со счета клиента. Запросы до аутентификации
+// учитываются по IP-адресу, поэтому подбор паролей тоже ограничен
+func (d *Database) limit(ctx context.Context, query *compute.Query) error {
+	if d.limiter == nil {
+		return nil
+	}
+
+	key := limit.ClientKey(clientIP(network.ClientAddr(ctx)))
+	if user := sessionUser(ctx); user != nil {
+		key = limit.UserKey(user.Name())
+	}
+
+	size := len(query.GetCommand())
+	for _, argument := range query.GetArguments() {
+		size += len(argument)
+	}
+
+	if err := d.limiter.Allow(key, size); err != nil {
+		d.logger.Debug("rate limit exceeded",
+			zap.String("client", key),
+			zap.String("command", string(query.GetCommand())),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// clientIP отбрасывает порт из адреса клиента. У клиентов unix-сокета
+// адреса нет, они делят общий лимит
+func clientIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Scan возвращает ключи с префиксом, доступные пользователю сессии. Ключи,
+// к которым у пользователя нет доступа, пропускаются
+func (d *Database) Scan(ctx context.Context, prefix, after string, limit int) ([]storage.KeyValue, error) {
+	match, err := d.readFilter(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.storage.Scan(ctx, prefix, after, limit, match), nil
+}
+
+// Watch подписывает на изменения доступных пользователю ключей с префиксом
+func (d *Database) Watch(ctx context.Context, prefix string) (<-chan storage.Event, error) {
+	match, err := d.readFilter(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.storage.Watch(ctx, match), nil
+}
+
+// readFilter проверяет право на чтение и возвращает фильтр доступных ключей
+func (d *Database) readFilter(ctx context.Context, prefix string) (func(string) bool, error) {
+	query := compute.NewQuery(compute.GetCommand, []string{prefix})
+	if err := d.limit(ctx, query); err != nil {
+		return nil, err
+	}
+	if err := d.authorize(ctx, compute.NewQuery(compute.GetCommand, nil)); err != nil {
+		return nil, err
+	}
+
+	user := sessionUser(ctx)
+	return func(key string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		return user == nil || user.CanAccess(key)
+	}, nil
+}
+
+func sessionUser(ctx context.Context) *auth.User {
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	user, _ := session.Get(userKey).(*auth.User)
+	return user
+}
+
+func (d *Database) handleSet(ctx context.Context, query *compute.Query) (Result, error) {
+	replicas, timeout, err := parseWait(query)
+	if err != nil {
+		return Result{}, err
+	}
+
+	lsn, err := d.storage.Set(ctx, query.GetArguments()[0], query.GetArguments()[1])
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err = d.storage.WaitReplicas(ctx, lsn, replicas, timeout); err != nil {
+		return Result{}, err
+	}
+
+	return Result{LSN: lsn}, nil
 }
 
-func (d *Database) handleGet(ctx context.Context, query *compute.Query) string {
+func (d *Database) handleGet(ctx context.Context, query *compute.Query) (Result, error) {
+	if arguments, ok := query.GetModifier(compute.MinLSNModifier); ok {
+		lsn, err := strconv.ParseUint(arguments[0], 10, 64)
+		if err != nil {
+			return Result{}, fmt.Errorf("%w lsn", ErrInvalidArgument)
+		}
+
+		err = d.storage.WaitApplied(ctx, lsn, d.readWaitTimeout)
+		if errors.Is(err, replication.ErrNotApplied) && d.redirectAddress != "" {
+			return Result{}, fmt.Errorf("%w %s", ErrMoved, d.redirectAddress)
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
 	val, err := d.storage.Get(ctx, query.GetArguments()[0])
 	if err != nil {
-		return fmt.Sprintf("[error] %s", err.Error())
+		return Result{}, err
 	}
-	return fmt.Sprintf("[ok] %s", val)
+	return Result{Value: val}, nil
 }
 
-func (d *Database) handleDel(ctx context.Context, query *compute.Query) string {
-	if err := d.storage.Del(ctx, query.GetArguments()[0]); err != nil {
-		return fmt.Sprintf("[error] %s", err.Error())
+func (d *Database) handleDel(ctx context.Context, query *compute.Query) (Result, error) {
+	replicas, timeout, err := parseWait(query)
+	if err != nil {
+		return Result{}, err
+	}
+
+	lsn, err := d.storage.Del(ctx, query.GetArguments()[0])
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err = d.storage.WaitReplicas(ctx, lsn, replicas, timeout); err != nil {
+		return Result{}, err
+	}
+
+	return Result{LSN: lsn}, nil
+}
+
+// writeResponse возвращает клиенту LSN записи: передав его в GET ... MINLSN,
+// клиент прочитает с реплики данные не старше своей записи
+func writeResponse(lsn uint64) string {
+	if lsn == 0 {
+		return "[ok]"
+	}
+	return fmt.Sprintf("[ok] lsn:%d", lsn)
+}
+
+// parseWait разбирает модификатор WAIT numreplicas timeout, таймаут в миллисекундах
+func parseWait(query *compute.Query) (int, time.Duration, error) {
+	arguments, ok := query.GetModifier(compute.WaitModifier)
+	if !ok {
+		return 0, 0, nil
+	}
+
+	replicas, err := strconv.Atoi(arguments[0])
+	if err != nil || replicas < 0 {
+		return 0, 0, fmt.Errorf("%w number of replicas", ErrInvalidArgument)
+	}
+
+	timeout, err := strconv.Atoi(arguments[1])
+	if err != nil || timeout <= 0 {
+		return 0, 0, fmt.Errorf("%w timeout", ErrInvalidArgument)
 	}
 
-	return "[ok]"
+	return replicas, time.Duration(timeout) * time.Millisecond, nil
 }
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/limit"
+	"antdb/internal/service/storage"
+	"antdb/internal/service/storage/engine"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDatabase(t *testing.T, acl *auth.ACL, options ...DatabaseOption) *Database {
+	t.Helper()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := storage.NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+	cmp := compute.NewCompute(compute.NewParser(), compute.NewAnalyzer(zap.NewNop()), zap.NewNop())
+	return NewDatabase(cmp, st, time.Second, "", acl, zap.NewNop(), options...)
+}
+
+func TestDatabase_ACL(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"public_*"}},
+	})
+	require.NoError(t, err)
+	db := newTestDatabase(t, acl)
+
+	admin := network.WithSession(context.Background(), network.NewSession())
+	reader := network.WithSession(context.Background(), network.NewSession())
+
+	require.Equal(t, "[error] authentication required", db.HandleQuery(admin, "SET public_key value"))
+	require.Equal(t, "[error] invalid username or password", db.HandleQuery(admin, "AUTH admin wrong"))
+	require.Equal(t, "[ok]", db.HandleQuery(admin, "AUTH admin secret"))
+	require.Equal(t, "[ok]", db.HandleQuery(admin, "SET public_key value"))
+	require.Equal(t, "[ok]", db.HandleQuery(admin, "SET private_key value"))
+
+	require.Equal(t, "[ok]", db.HandleQuery(reader, "AUTH reader secret"))
+	require.Equal(t, "[ok] value", db.HandleQuery(reader, "GET public_key"))
+	require.Equal(t, "[error] key private_key is not allowed", db.HandleQuery(reader, "GET private_key"))
+	require.Equal(t, "[error] command DEL is not allowed", db.HandleQuery(reader, "DEL public_key"))
+	require.Equal(t, "[error] command INFO is not allowed", db.HandleQuery(reader, "INFO"))
+}
+
+func TestDatabase_AuthDisabled(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDatabase(t, nil)
+	ctx := network.WithSession(context.Background(), network.NewSession())
+
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "SET key value"))
+	require.Equal(t, "[error] authentication is not enabled", db.HandleQuery(ctx, "AUTH admin secret"))
+}
+
+func TestDatabase_DebugLogRedactsPassword(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := storage.NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+	cmp := compute.NewCompute(compute.NewParser(), compute.NewAnalyzer(zap.NewNop()), zap.NewNop())
+	db := NewDatabase(cmp, st, time.Second, "", acl, zap.New(core))
+
+	ctx := network.WithSession(context.Background(), network.NewSession())
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "AUTH admin secret"))
+	require.Equal(t, "[error] invalid username or password", db.HandleQuery(ctx, "AUTH admin wrong"))
+	db.HandleQuery(ctx, "AUTH admin secret extra")
+
+	entries := logs.FilterMessage("handled query").All()
+	require.Len(t, entries, 2)
+	require.Equal(t, []any{"AUTH", "admin", "(redacted)"}, entries[0].ContextMap()["query"])
+	for _, entry := range logs.All() {
+		for _, value := range entry.ContextMap() {
+			require.NotContains(t, fmt.Sprint(value), "secret")
+			require.NotContains(t, fmt.Sprint(value), "wrong")
+		}
+	}
+}
+
+func TestDatabase_Ping(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+	db := newTestDatabase(t, acl)
+	ctx := network.WithSession(context.Background(), network.NewSession())
+
+	// PING отвечает и до аутентификации
+	require.Equal(t, "[ok] PONG", db.HandleQuery(ctx, "PING"))
+	require.Equal(t, "[ok] hello", db.HandleQuery(ctx, "PING hello"))
+	require.Equal(t, "[error] authentication required", db.HandleQuery(ctx, "GET key"))
+}
+
+func TestDatabase_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	limiter := limit.NewLimiter(limit.Limits{CommandsPerSecond: 2}, map[string]limit.Limits{
+		limit.UserKey("admin"): {CommandsPerSecond: 3},
+	})
+	db := newTestDatabase(t, acl, WithRateLimiter(limiter))
+
+	session := network.NewSession()
+	client := network.WithClientAddr(network.WithSession(context.Background(), session), "127.0.0.1:50000")
+	// до аутентификации запросы считаются по IP-адресу, порт не учитывается
+	other := network.WithClientAddr(network.WithSession(context.Background(), network.NewSession()), "127.0.0.1:50001")
+
+	require.Equal(t, "[error] authentication required", db.HandleQuery(client, "GET key"))
+	require.Equal(t, "[ok]", db.HandleQuery(client, "AUTH admin secret"))
+	require.Equal(t, "[error] rate limit exceeded: commands per second", db.HandleQuery(other, "GET key"))
+
+	// после аутентификации действует лимит пользователя
+	require.Equal(t, "[ok]", db.HandleQuery(client, "SET key value"))
+	require.Equal(t, "[ok] value", db.HandleQuery(client, "GET key"))
+	require.Equal(t, "[ok] value", db.HandleQuery(client, "GET key"))
+	require.Equal(t, "[error] rate limit exceeded: commands per second", db.HandleQuery(client, "GET key"))
+
+	require.Equal(t, []string{"rate_limited_commands:2", "rate_limited_bytes:0"}, db.statsInfo(client))
+}
+
+type testClients struct{}
+
+func (testClients) ActiveConnections() int        { return 3 }
+func (testClients) MaxConnections() int           { return 100 }
+func (testClients) OverflowedConnections() uint64 { return 7 }
+
+func TestDatabase_Info(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal-1.gob"), make([]byte, 100), 0o644))
+	db := newTestDatabase(t, nil,
+		WithServerInfo("1.2.3", map[string]string{"tcp_address": ":3223", "engine_type": "in_memory"}),
+		WithClients(testClients{}),
+		WithPersistence(dir, wal.NewCompaction(dir, time.Second, zap.NewNop())))
+	ctx := network.WithSession(context.Background(), network.NewSession())
+
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "SET key value"))
+
+	server := db.HandleQuery(ctx, "INFO server")
+	require.True(t, strings.HasPrefix(server, "[ok] # Server version:1.2.3 go_version:"), server)
+	require.True(t, strings.HasSuffix(server, "engine_type:in_memory tcp_address::3223"), server)
+
+	tests := map[string]struct {
+		section  string
+		expected string
+	}{
+		"clients": {
+			section:  "clients",
+			expected: "[ok] # Clients connected_clients:3 max_clients:100 rejected_clients:7 monitors:0",
+		},
+		"persistence": {
+			section: "PERSISTENCE",
+			expected: "[ok] # Persistence wal_enabled:1 wal_directory:" + dir + " wal_segments:1 wal_segment_bytes:100" +
+				" compaction_enabled:1 last_compaction:-1 last_compaction_status:none",
+		},
+		"replication": {
+			section:  "replication",
+			expected: "[ok] # Replication role:standalone",
+		},
+		"unknown": {
+			section:  "keyspace",
+			expected: "[error] unknown info section keyspace",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, test.expected, db.HandleQuery(ctx, "INFO "+test.section))
+		})
+	}
+
+	memory := db.HandleQuery(ctx, "INFO memory")
+	require.True(t, strings.HasPrefix(memory, "[ok] # Memory keys:1 data_bytes:8 used_memory:"), memory)
+
+	// без аргумента выводятся все разделы по порядку
+	all := db.HandleQuery(ctx, "INFO")
+	var sections []string
+	for _, part := range strings.Split(all, "# ")[1:] {
+		sections = append(sections, strings.Fields(part)[0])
+	}
+	require.Equal(t, []string{"Server", "Clients", "Memory", "Persistence", "Replication", "Stats"}, sections)
+}
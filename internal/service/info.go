@@ -0,0 +1,203 @@
+package service
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage/replication"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ответ INFO - одна строка: "# Section key:value key:value # Section ..."
+type infoSection struct {
+	name   string
+	handle func(d *Database, ctx context.Context) []string
+}
+
+var infoSections = []infoSection{
+	{name: "server", handle: (*Database).serverInfo},
+	{name: "clients", handle: (*Database).clientsInfo},
+	{name: "memory", handle: (*Database).memoryInfo},
+	{name: "persistence", handle: (*Database).persistenceInfo},
+	{name: "replication", handle: (*Database).replicationInfo},
+	{name: "stats", handle: (*Database).statsInfo},
+}
+
+func (d *Database) handleInfo(ctx context.Context, query *compute.Query) (Result, error) {
+	var section string
+	if len(query.GetArguments()) > 0 {
+		section = strings.ToLower(query.GetArguments()[0])
+	}
+
+	var result []string
+	for _, info := range infoSections {
+		if section != "" && section != info.name {
+			continue
+		}
+		result = append(result, "# "+strings.ToUpper(info.name[:1])+info.name[1:])
+		result = append(result, info.handle(d, ctx)...)
+	}
+
+	if len(result) == 0 {
+		return Result{}, fmt.Errorf("unknown info section %s", section)
+	}
+
+	return Result{Value: strings.Join(result, " ")}, nil
+}
+
+func (d *Database) serverInfo(_ context.Context) []string {
+	version := d.version
+	if version == "" {
+		version = "unknown"
+	}
+
+	result := []string{
+		"version:" + version,
+		"go_version:" + runtime.Version(),
+		"os:" + runtime.GOOS + "/" + runtime.GOARCH,
+		fmt.Sprintf("process_id:%d", os.Getpid()),
+		fmt.Sprintf("uptime_seconds:%d", int64(time.Since(d.started).Seconds())),
+	}
+
+	// значения конфигурации не должны содержать пробелов, иначе ответ не разобрать
+	keys := make([]string, 0, len(d.config))
+	for key := range d.config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result = append(result, key+":"+d.config[key])
+	}
+
+	return result
+}
+
+func (d *Database) clientsInfo(_ context.Context) []string {
+	var result []string
+	if d.clients != nil {
+		result = append(result,
+			fmt.Sprintf("connected_clients:%d", d.clients.ActiveConnections()),
+			fmt.Sprintf("max_clients:%d", d.clients.MaxConnections()),
+			fmt.Sprintf("rejected_clients:%d", d.clients.OverflowedConnections()))
+	}
+
+	return append(result, fmt.Sprintf("monitors:%d", d.monitors.count.Load()))
+}
+
+// memoryInfo оценивает объем данных по длине ключей и значений, а память
+// процесса берет из статистики рантайма
+func (d *Database) memoryInfo(_ context.Context) []string {
+	keys, size := d.storage.Stats()
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return []string{
+		fmt.Sprintf("keys:%d", keys),
+		fmt.Sprintf("data_bytes:%d", size),
+		fmt.Sprintf("used_memory:%d", stats.HeapAlloc),
+		fmt.Sprintf("used_memory_sys:%d", stats.Sys),
+		fmt.Sprintf("gc_runs:%d", stats.NumGC),
+	}
+}
+
+func (d *Database) persistenceInfo(_ context.Context) []string {
+	if d.walDir == "" {
+		return []string{"wal_enabled:0"}
+	}
+
+	result := []string{"wal_enabled:1", "wal_directory:" + d.walDir}
+	if segments, size, err := wal.SegmentStats(d.walDir); err == nil {
+		result = append(result,
+			fmt.Sprintf("wal_segments:%d", segments),
+			fmt.Sprintf("wal_segment_bytes:%d", size))
+	} else {
+		d.logger.Warn("can't get wal segment stats", zap.Error(err))
+	}
+
+	if d.compaction == nil {
+		return append(result, "compaction_enabled:0")
+	}
+
+	lastRun, err := d.compaction.LastRun()
+	status := "ok"
+	if lastRun.IsZero() {
+		status = "none"
+	} else if err != nil {
+		status = "error"
+	}
+	return append(result,
+		"compaction_enabled:1",
+		"last_compaction:"+formatSince(lastRun),
+		"last_compaction_status:"+status)
+}
+
+func (d *Database) replicationInfo(_ context.Context) []string {
+	status, ok := d.storage.ReplicationStatus()
+	if !ok {
+		return []string{"role:standalone"}
+	}
+
+	result := []string{
+		"role:" + status.Role,
+		fmt.Sprintf("lsn:%d", status.LSN),
+	}
+
+	if link := status.Link; link != nil {
+		linkStatus := "down"
+		if link.Up {
+			linkStatus = "up"
+		}
+		result = append(result,
+			"master_address:"+link.MasterAddress,
+			"master_link_status:"+linkStatus,
+			"master_last_contact:"+formatSince(link.LastContact),
+			fmt.Sprintf("master_lsn:%d", link.MasterLSN),
+			fmt.Sprintf("lag_records:%d", link.LagRecords),
+			fmt.Sprintf("lag_seconds:%.3f", link.LagSeconds),
+		)
+	}
+
+	// список реплик есть у мастера и у промежуточного узла каскада
+	if status.Role == replication.RoleMaster || status.Replicas != nil {
+		result = append(result,
+			fmt.Sprintf("connected_replicas:%d", len(status.Replicas)),
+			fmt.Sprintf("rejected_replicas:%d", status.RejectedReplicas))
+	}
+	for i, replica := range status.Replicas {
+		var lag uint64
+		if status.LSN > replica.AckLSN {
+			lag = status.LSN - replica.AckLSN
+		}
+		result = append(result, fmt.Sprintf("replica%d:id=%s,address=%s,ack_lsn=%d,lag=%d,last_contact=%s",
+			i, replica.ID, replica.Address, replica.AckLSN, lag, formatSince(replica.LastContact)))
+	}
+
+	return result
+}
+
+func (d *Database) statsInfo(_ context.Context) []string {
+	var commandHits, bytesHits uint64
+	if d.limiter != nil {
+		commandHits, bytesHits = d.limiter.Hits()
+	}
+
+	return []string{
+		fmt.Sprintf("rate_limited_commands:%d", commandHits),
+		fmt.Sprintf("rate_limited_bytes:%d", bytesHits),
+	}
+}
+
+// formatSince возвращает число секунд, прошедших с момента t, или -1, если момента не было
+func formatSince(t time.Time) string {
+	if t.IsZero() {
+		return "-1"
+	}
+	return fmt.Sprintf("%.3f", time.Since(t).Seconds())
+}
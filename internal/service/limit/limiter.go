@@ -0,0 +1,153 @@
+package limit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrLimited = errors.New("rate limit exceeded")
+
+// sweepInterval - как часто удалять корзины клиентов, которые давно не приходили
+const sweepInterval = time.Minute
+
+// Limits - допустимая частота запросов клиента. Запас корзины равен
+// секундному лимиту, 0 - без ограничения
+type Limits struct {
+	CommandsPerSecond float64
+	BytesPerSecond    float64
+}
+
+func (l Limits) unlimited() bool {
+	return l.CommandsPerSecond <= 0 && l.BytesPerSecond <= 0
+}
+
+// bucket - корзина токенов, которая пополняется со скоростью rate до rate токенов
+type bucket struct {
+	rate   float64
+	tokens float64
+}
+
+func (b *bucket) refill(elapsed time.Duration) {
+	b.tokens = min(b.rate, b.tokens+elapsed.Seconds()*b.rate)
+}
+
+// allow разрешает запрос, если в корзине хватает токенов. Запрос дороже
+// всего запаса проходит при полной корзине и уводит ее в минус
+func (b *bucket) allow(cost float64) bool {
+	return b.rate <= 0 || b.tokens >= min(cost, b.rate)
+}
+
+func (b *bucket) full() bool {
+	return b.rate <= 0 || b.tokens >= b.rate
+}
+
+type client struct {
+	commands bucket
+	bytes    bucket
+	updated  time.Time
+}
+
+// UserKey - ключ аутентифицированного клиента
+func UserKey(name string) string {
+	return "user:" + name
+}
+
+// ClientKey - ключ клиента без аутентификации
+func ClientKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Limiter ограничивает частоту команд и объем данных по ключу клиента:
+// имени пользователя или IP-адресу. Для отдельных ключей лимиты можно
+// переопределить
+type Limiter struct {
+	mu        sync.Mutex
+	defaults  Limits
+	overrides map[string]Limits
+	clients   map[string]*client
+	lastSweep time.Time
+	now       func() time.Time
+
+	commandHits atomic.Uint64
+	bytesHits   atomic.Uint64
+}
+
+func NewLimiter(defaults Limits, overrides map[string]Limits) *Limiter {
+	return &Limiter{
+		defaults:  defaults,
+		overrides: overrides,
+		clients:   make(map[string]*client),
+		now:       time.Now,
+	}
+}
+
+// Allow списывает команду размером size байт со счета клиента key
+func (l *Limiter) Allow(key string, size int) error {
+	limits, ok := l.overrides[key]
+	if !ok {
+		limits = l.defaults
+	}
+	if limits.unlimited() {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{
+			commands: bucket{rate: limits.CommandsPerSecond, tokens: limits.CommandsPerSecond},
+			bytes:    bucket{rate: limits.BytesPerSecond, tokens: limits.BytesPerSecond},
+		}
+		l.clients[key] = c
+	} else {
+		elapsed := now.Sub(c.updated)
+		c.commands.refill(elapsed)
+		c.bytes.refill(elapsed)
+	}
+	c.updated = now
+
+	if !c.commands.allow(1) {
+		l.commandHits.Add(1)
+		return fmt.Errorf("%w: commands per second", ErrLimited)
+	}
+	if !c.bytes.allow(float64(size)) {
+		l.bytesHits.Add(1)
+		return fmt.Errorf("%w: bytes per second", ErrLimited)
+	}
+
+	c.commands.tokens--
+	c.bytes.tokens -= float64(size)
+	return nil
+}
+
+// Hits возвращает число запросов, отклоненных по лимиту команд и по лимиту байт
+func (l *Limiter) Hits() (uint64, uint64) {
+	return l.commandHits.Load(), l.bytesHits.Load()
+}
+
+// sweep удаляет клиентов, чьи корзины успели наполниться: новая корзина
+// для них ничем не отличается от старой
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, c := range l.clients {
+		elapsed := now.Sub(c.updated)
+		c.commands.refill(elapsed)
+		c.bytes.refill(elapsed)
+		c.updated = now
+		if c.commands.full() && c.bytes.full() {
+			delete(l.clients, key)
+		}
+	}
+}
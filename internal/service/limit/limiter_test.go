@@ -0,0 +1,82 @@
+package limit
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(defaults Limits, overrides map[string]Limits) (*Limiter, *time.Time) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(defaults, overrides)
+	limiter.now = func() time.Time {
+		return now
+	}
+	return limiter, &now
+}
+
+func TestLimiter_Commands(t *testing.T) {
+	t.Parallel()
+
+	limiter, now := newTestLimiter(Limits{CommandsPerSecond: 2}, nil)
+
+	require.NoError(t, limiter.Allow("user:alice", 10))
+	require.NoError(t, limiter.Allow("user:alice", 10))
+	require.ErrorIs(t, limiter.Allow("user:alice", 10), ErrLimited)
+	// у других клиентов свои корзины
+	require.NoError(t, limiter.Allow("user:bob", 10))
+
+	*now = now.Add(500 * time.Millisecond)
+	require.NoError(t, limiter.Allow("user:alice", 10))
+	require.ErrorIs(t, limiter.Allow("user:alice", 10), ErrLimited)
+
+	commands, bytes := limiter.Hits()
+	require.Equal(t, uint64(2), commands)
+	require.Equal(t, uint64(0), bytes)
+}
+
+func TestLimiter_Bytes(t *testing.T) {
+	t.Parallel()
+
+	limiter, now := newTestLimiter(Limits{BytesPerSecond: 100}, nil)
+
+	require.NoError(t, limiter.Allow("ip:127.0.0.1", 60))
+	require.ErrorContains(t, limiter.Allow("ip:127.0.0.1", 60), "bytes per second")
+
+	// запрос больше запаса проходит при полной корзине
+	*now = now.Add(time.Second)
+	require.NoError(t, limiter.Allow("ip:127.0.0.1", 250))
+	*now = now.Add(time.Second)
+	require.ErrorIs(t, limiter.Allow("ip:127.0.0.1", 1), ErrLimited)
+
+	_, bytes := limiter.Hits()
+	require.Equal(t, uint64(2), bytes)
+}
+
+func TestLimiter_Overrides(t *testing.T) {
+	t.Parallel()
+
+	limiter, _ := newTestLimiter(Limits{CommandsPerSecond: 1}, map[string]Limits{
+		"user:admin":  {},
+		"ip:10.0.0.1": {CommandsPerSecond: 3},
+	})
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, limiter.Allow("user:admin", 1))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow("ip:10.0.0.1", 1))
+	}
+	require.ErrorIs(t, limiter.Allow("ip:10.0.0.1", 1), ErrLimited)
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	t.Parallel()
+
+	limiter, now := newTestLimiter(Limits{CommandsPerSecond: 1}, nil)
+	require.NoError(t, limiter.Allow("user:alice", 1))
+
+	*now = now.Add(sweepInterval)
+	require.NoError(t, limiter.Allow("user:bob", 1))
+	require.Len(t, limiter.clients, 1)
+}
@@ -0,0 +1,20 @@
+package limit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var hitsDesc = prometheus.NewDesc("antdb_rate_limit_hits_total",
+	"Requests rejected by rate limits.", []string{"limit"}, nil)
+
+// Describe и Collect позволяют зарегистрировать лимитер как коллектор
+// числа отклоненных запросов
+func (l *Limiter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hitsDesc
+}
+
+func (l *Limiter) Collect(ch chan<- prometheus.Metric) {
+	commands, bytes := l.Hits()
+	ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(commands), "commands")
+	ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(bytes), "bytes")
+}
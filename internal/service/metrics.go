@@ -0,0 +1,59 @@
+package service
+
+import (
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// unknownCommand - метка запросов, которые не удалось разобрать
+const unknownCommand = "unknown"
+
+var (
+	commandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "antdb",
+		Name:      "commands_total",
+		Help:      "Number of processed commands by command and result.",
+	}, []string{"command", "result"})
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "antdb",
+		Name:      "command_duration_seconds",
+		Help:      "Command latency including parsing, WAL and replica waits.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"command", "result"})
+)
+
+// RegisterMetrics регистрирует метрики выполнения команд
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(commandsTotal, commandDuration)
+}
+
+// observeCommand учитывает запрос, который выполнялся duration
+func observeCommand(query *compute.Query, err error, duration time.Duration) {
+	command := unknownCommand
+	if query != nil {
+		command = string(query.GetCommand())
+	}
+
+	result := commandResult(err)
+	commandsTotal.WithLabelValues(command, result).Inc()
+	commandDuration.WithLabelValues(command, result).Observe(duration.Seconds())
+}
+
+func commandResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, storage.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrAuthRequired), errors.Is(err, auth.ErrAuthFailed), errors.Is(err, ErrForbidden):
+		return "denied"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/compute"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBufferSize - сколько команд может накопить монитор. Отстающего
+// сильнее отключают, чтобы он не задерживал остальных клиентов
+const monitorBufferSize = 1024
+
+// monitors - соединения, которые получают все выполняемые команды
+type monitors struct {
+	mu   sync.Mutex
+	list map[chan []byte]struct{}
+	// count позволяет не блокироваться, когда мониторов нет
+	count atomic.Int32
+}
+
+func (m *monitors) add(ctx context.Context, messages chan []byte) {
+	m.mu.Lock()
+	if m.list == nil {
+		m.list = make(map[chan []byte]struct{})
+	}
+	m.list[messages] = struct{}{}
+	m.count.Add(1)
+	m.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.remove(messages)
+	})
+}
+
+// remove вызывается под m.mu
+func (m *monitors) remove(messages chan []byte) {
+	if _, ok := m.list[messages]; ok {
+		delete(m.list, messages)
+		m.count.Add(-1)
+		close(messages)
+	}
+}
+
+// publish отправляет команду всем мониторам в формате
+// "1700000000.123456 [127.0.0.1:5000] "SET" "key" "value""
+func (m *monitors) publish(ctx context.Context, query *compute.Query) {
+	if m.count.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+	arguments := loggedArguments(query)
+	quoted := make([]string, 0, len(arguments))
+	for _, argument := range arguments {
+		quoted = append(quoted, strconv.Quote(argument))
+	}
+	message := []byte(fmt.Sprintf("%d.%06d [%s] %s",
+		now.Unix(), now.Nanosecond()/1000, network.ClientAddr(ctx), strings.Join(quoted, " ")))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for messages := range m.list {
+		select {
+		case messages <- message:
+		default:
+			m.remove(messages)
+		}
+	}
+}
+
+// handleMonitor переводит соединение в режим, в котором клиент получает
+// все команды, выполняемые базой
+func (d *Database) handleMonitor(ctx context.Context, _ *compute.Query) (Result, error) {
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return Result{}, errors.New("monitor is not supported by connection")
+	}
+
+	messages := make(chan []byte, monitorBufferSize)
+	if err := session.StartPush(messages); err != nil {
+		return Result{}, err
+	}
+
+	d.monitors.add(ctx, messages)
+	return Result{}, nil
+}
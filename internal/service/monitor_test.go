@@ -0,0 +1,135 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMonitors_SlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	var m monitors
+	fast := make(chan []byte, monitorBufferSize)
+	slow := make(chan []byte, 1)
+	m.add(context.Background(), fast)
+	m.add(context.Background(), slow)
+
+	query := compute.NewQuery(compute.GetCommand, []string{"key"})
+	m.publish(context.Background(), query)
+	m.publish(context.Background(), query)
+
+	// отстающий монитор отключается, остальные получают все команды
+	require.Len(t, fast, 2)
+	<-slow
+	_, ok := <-slow
+	require.False(t, ok)
+	require.Equal(t, int32(1), m.count.Load())
+}
+
+func TestDatabase_Monitor(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDatabase(t, nil)
+	require.Equal(t, "[error] push is not supported by connection",
+		db.HandleQuery(network.WithSession(context.Background(), network.NewSession()), "MONITOR"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := network.NewServer(":3235", 2, 1024, zap.NewNop(), network.WithDelimiter('\n'))
+	require.NoError(t, err)
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte(db.HandleQuery(ctx, string(s)) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	monitor, err := net.Dial("tcp", ":3235")
+	require.NoError(t, err)
+	defer monitor.Close()
+	events := bufio.NewReader(monitor)
+	_, err = monitor.Write([]byte("MONITOR\n"))
+	require.NoError(t, err)
+	response, err := events.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "[ok]\n", response)
+
+	client, err := net.Dial("tcp", ":3235")
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("SET key value\nGET key\n"))
+	require.NoError(t, err)
+
+	for _, command := range []string{`"SET" "key" "value"`, `"GET" "key"`} {
+		event, err := events.ReadString('\n')
+		require.NoError(t, err)
+		require.Regexp(t, `^\d+\.\d{6} \[127\.0\.0\.1:\d+\] `+command+"\n$", event)
+	}
+}
+
+func TestDatabase_MonitorForbidden(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"public_*"}},
+	})
+	require.NoError(t, err)
+	db := newTestDatabase(t, acl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := network.NewServer(":3238", 2, 1024, zap.NewNop(), network.WithDelimiter('\n'))
+	require.NoError(t, err)
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte(db.HandleQuery(ctx, string(s)) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	monitor, err := net.Dial("tcp", ":3238")
+	require.NoError(t, err)
+	defer monitor.Close()
+	events := bufio.NewReader(monitor)
+	_, err = monitor.Write([]byte("AUTH admin secret\nMONITOR\n"))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		response, err := events.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "[ok]\n", response)
+	}
+
+	client, err := net.Dial("tcp", ":3238")
+	require.NoError(t, err)
+	defer client.Close()
+	replies := bufio.NewReader(client)
+	for _, query := range []string{"GET public_key", "AUTH reader secret", "SET public_key value", "GET private_key", "GET public_key"} {
+		_, err = client.Write([]byte(query + "\n"))
+		require.NoError(t, err)
+		_, err = replies.ReadString('\n')
+		require.NoError(t, err)
+	}
+
+	// запросы без прав не попадают к мониторам, пароль скрыт
+	for _, command := range []string{`"AUTH" "reader" "\(redacted\)"`, `"GET" "public_key"`} {
+		event, err := events.ReadString('\n')
+		require.NoError(t, err)
+		require.Regexp(t, `^\d+\.\d{6} \[127\.0\.0\.1:\d+\] `+command+"\n$", event)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/pubsub"
+	"antdb/internal/service/storage"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WithPubSub включает PUBLISH и подписки на каналы
+func WithPubSub(hub *pubsub.Hub) DatabaseOption {
+	return func(d *Database) {
+		d.pubsub = hub
+	}
+}
+
+// handleSubscribe подписывает соединение на каналы или шаблоны каналов и
+// отвечает числом его подписок. После первой подписки соединение переходит
+// в режим, в котором клиент получает сообщения без запроса
+func (d *Database) handleSubscribe(ctx context.Context, query *compute.Query) (Result, error) {
+	if d.pubsub == nil {
+		return Result{}, errors.New("pubsub is not enabled")
+	}
+
+	subscriber, err := d.subscriber(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var count int
+	if query.GetCommand() == compute.PSubscribeCommand {
+		count = subscriber.PSubscribe(query.GetArguments()...)
+	} else {
+		count = subscriber.Subscribe(query.GetArguments()...)
+	}
+	return Result{Value: strconv.Itoa(count)}, nil
+}
+
+// handleUnsubscribe отменяет подписки соединения и отвечает числом
+// оставшихся. Соединение остается в режиме отправки сообщений
+func (d *Database) handleUnsubscribe(ctx context.Context, query *compute.Query) (Result, error) {
+	if d.pubsub == nil {
+		return Result{}, errors.New("pubsub is not enabled")
+	}
+
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return Result{}, errors.New("subscribe is not supported by connection")
+	}
+	subscriber, ok := session.Get(subscriberKey).(*pubsub.Subscriber)
+	if !ok {
+		return Result{Value: "0"}, nil
+	}
+
+	var count int
+	if query.GetCommand() == compute.PUnsubscribeCommand {
+		count = subscriber.PUnsubscribe(query.GetArguments()...)
+	} else {
+		count = subscriber.Unsubscribe(query.GetArguments()...)
+	}
+	return Result{Value: strconv.Itoa(count)}, nil
+}
+
+// handlePublish отправляет сообщение в канал и отвечает числом получателей.
+// В каналы событий ключей публикует только хранилище
+func (d *Database) handlePublish(_ context.Context, query *compute.Query) (Result, error) {
+	if d.pubsub == nil {
+		return Result{}, errors.New("pubsub is not enabled")
+	}
+
+	channel := query.GetArguments()[0]
+	if _, ok := storage.KeyFromChannel(channel); ok {
+		return Result{}, fmt.Errorf("channel %s is %w", channel, ErrForbidden)
+	}
+
+	received := d.pubsub.Publish(channel, query.GetArguments()[1])
+	return Result{Value: strconv.Itoa(received)}, nil
+}
+
+// Ответ PUBSUB CHANNELS [pattern] - каналы с подписчиками через пробел.
+// Каналы событий недоступных пользователю ключей не показываются
+func (d *Database) handlePubSub(ctx context.Context, query *compute.Query) (Result, error) {
+	if d.pubsub == nil {
+		return Result{}, errors.New("pubsub is not enabled")
+	}
+
+	arguments := query.GetArguments()
+	if !strings.EqualFold(arguments[0], "CHANNELS") {
+		return Result{}, fmt.Errorf("%w pubsub subcommand %s", ErrInvalidArgument, arguments[0])
+	}
+
+	pattern := "*"
+	if len(arguments) > 1 {
+		pattern = arguments[1]
+	}
+
+	allow := keyspaceFilter(ctx)
+	var channels []string
+	for _, channel := range d.pubsub.Channels(pattern) {
+		if allow == nil || allow(channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return Result{Value: strings.Join(channels, " ")}, nil
+}
+
+// subscriber возвращает подписчика соединения, при первом обращении создает
+// его и переводит соединение в режим отправки сообщений
+func (d *Database) subscriber(ctx context.Context) (*pubsub.Subscriber, error) {
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return nil, errors.New("subscribe is not supported by connection")
+	}
+	if subscriber, ok := session.Get(subscriberKey).(*pubsub.Subscriber); ok {
+		return subscriber, nil
+	}
+
+	subscriber := d.pubsub.NewSubscriber(keyspaceFilter(ctx))
+	if err := session.StartPush(subscriber.Messages()); err != nil {
+		subscriber.Close()
+		return nil, err
+	}
+	session.Set(subscriberKey, subscriber)
+
+	context.AfterFunc(ctx, subscriber.Close)
+	return subscriber, nil
+}
+
+// keyspaceFilter не пропускает события ключей, к которым у пользователя
+// сессии нет доступа
+func keyspaceFilter(ctx context.Context) func(channel string) bool {
+	user := sessionUser(ctx)
+	if user == nil {
+		return nil
+	}
+
+	return func(channel string) bool {
+		key, ok := storage.KeyFromChannel(channel)
+		return !ok || user.CanAccess(key)
+	}
+}
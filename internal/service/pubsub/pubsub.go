@@ -0,0 +1,223 @@
+package pubsub
+
+import (
+	"antdb/internal/tools"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Hub рассылает сообщения подписчикам каналов и шаблонов каналов
+type Hub struct {
+	mu       sync.Mutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+	// bufferSize - сколько сообщений может накопить подписчик. Отстающего
+	// сильнее отключают, чтобы публикация не ждала медленного клиента
+	bufferSize int
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		channels:   make(map[string]map[*Subscriber]struct{}),
+		patterns:   make(map[string]map[*Subscriber]struct{}),
+		bufferSize: max(bufferSize, 1),
+	}
+}
+
+// Subscriber - подписки одного клиента. Сообщения приходят в Messages уже
+// в виде строк ответа, канал закрывается после Close или если подписчик
+// не успевает их читать
+type Subscriber struct {
+	hub      *Hub
+	messages chan []byte
+	// allow == nil - подписчику доступны все каналы
+	allow func(channel string) bool
+
+	// поля ниже защищены hub.mu
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	closed   bool
+}
+
+// NewSubscriber создает подписчика. allow отбирает каналы, сообщения из
+// которых подписчику можно получать, nil - любые
+func (h *Hub) NewSubscriber(allow func(channel string) bool) *Subscriber {
+	return &Subscriber{
+		hub:      h,
+		messages: make(chan []byte, h.bufferSize),
+		allow:    allow,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+func (s *Subscriber) Messages() <-chan []byte {
+	return s.messages
+}
+
+// Subscribe подписывает на каналы и возвращает число подписок
+func (s *Subscriber) Subscribe(channels ...string) int {
+	return s.add(s.hub.channels, s.channels, channels)
+}
+
+// PSubscribe подписывает на каналы, подходящие под шаблоны, в которых * -
+// любая последовательность символов, и возвращает число подписок
+func (s *Subscriber) PSubscribe(patterns ...string) int {
+	return s.add(s.hub.patterns, s.patterns, patterns)
+}
+
+func (s *Subscriber) add(index map[string]map[*Subscriber]struct{}, own map[string]struct{}, names []string) int {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if !s.closed {
+		for _, name := range names {
+			if index[name] == nil {
+				index[name] = make(map[*Subscriber]struct{})
+			}
+			index[name][s] = struct{}{}
+			own[name] = struct{}{}
+		}
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// Unsubscribe отписывает от каналов, без аргументов - от всех каналов, и
+// возвращает число оставшихся подписок
+func (s *Subscriber) Unsubscribe(channels ...string) int {
+	return s.remove(s.hub.channels, s.channels, channels)
+}
+
+// PUnsubscribe отписывает от шаблонов, без аргументов - от всех шаблонов, и
+// возвращает число оставшихся подписок
+func (s *Subscriber) PUnsubscribe(patterns ...string) int {
+	return s.remove(s.hub.patterns, s.patterns, patterns)
+}
+
+func (s *Subscriber) remove(index map[string]map[*Subscriber]struct{}, own map[string]struct{}, names []string) int {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := own[name]; ok {
+			s.hub.remove(index, name, s)
+			delete(own, name)
+		}
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// Close отменяет все подписки и закрывает Messages
+func (s *Subscriber) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.close()
+}
+
+// close вызывается под hub.mu
+func (s *Subscriber) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	for channel := range s.channels {
+		s.hub.remove(s.hub.channels, channel, s)
+	}
+	for pattern := range s.patterns {
+		s.hub.remove(s.hub.patterns, pattern, s)
+	}
+	clear(s.channels)
+	clear(s.patterns)
+	close(s.messages)
+}
+
+// remove вызывается под h.mu
+func (h *Hub) remove(index map[string]map[*Subscriber]struct{}, name string, s *Subscriber) {
+	delete(index[name], s)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+}
+
+// Channels возвращает в порядке возрастания каналы, на которые кто-то
+// подписан, подходящие под шаблон. Подписки по шаблонам не учитываются
+func (h *Hub) Channels(pattern string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var channels []string
+	for channel := range h.channels {
+		if tools.MatchPattern(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	slices.Sort(channels)
+	return channels
+}
+
+// Publish отправляет сообщение подписчикам канала и подходящих шаблонов и
+// возвращает, сколько подписчиков его получили
+func (h *Hub) Publish(channel, payload string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	received := 0
+	if subscribers, ok := h.channels[channel]; ok {
+		message := formatMessage(channel, payload)
+		for s := range subscribers {
+			if s.send(channel, message) {
+				received++
+			}
+		}
+	}
+
+	for pattern, subscribers := range h.patterns {
+		if !tools.MatchPattern(pattern, channel) {
+			continue
+		}
+		message := formatPatternMessage(pattern, channel, payload)
+		for s := range subscribers {
+			if s.send(channel, message) {
+				received++
+			}
+		}
+	}
+
+	return received
+}
+
+// send вызывается под hub.mu. Подписчика с полным буфером отключает
+func (s *Subscriber) send(channel string, message []byte) bool {
+	if s.closed || (s.allow != nil && !s.allow(channel)) {
+		return false
+	}
+
+	select {
+	case s.messages <- message:
+		return true
+	default:
+		s.close()
+		return false
+	}
+}
+
+// Сообщения в формате message "<канал>" "<данные>" и pmessage "<шаблон>"
+// "<канал>" "<данные>". Поля в кавычках, как в MONITOR: через шлюзы в них
+// могут попасть пробелы и переводы строк
+func formatMessage(channel, payload string) []byte {
+	return []byte("message " + strconv.Quote(channel) + " " + strconv.Quote(payload))
+}
+
+func formatPatternMessage(pattern, channel, payload string) []byte {
+	return []byte("pmessage " + strconv.Quote(pattern) + " " + strconv.Quote(channel) + " " + strconv.Quote(payload))
+}
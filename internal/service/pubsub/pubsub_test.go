@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHub_Publish(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub(16)
+	subscriber := hub.NewSubscriber(nil)
+	require.Equal(t, 1, subscriber.Subscribe("news"))
+	require.Equal(t, 3, subscriber.PSubscribe("news*", "n*s"))
+	// повторная подписка не добавляется
+	require.Equal(t, 3, subscriber.Subscribe("news"))
+
+	filtered := hub.NewSubscriber(func(channel string) bool {
+		return !strings.HasSuffix(channel, "_private")
+	})
+	require.Equal(t, 1, filtered.PSubscribe("news*"))
+
+	require.Equal(t, 4, hub.Publish("news", "hello"))
+	require.Equal(t, 1, hub.Publish("news_private", "secret"))
+	require.Equal(t, 0, hub.Publish("weather", "rain"))
+
+	var messages []string
+	for len(subscriber.Messages()) > 0 {
+		messages = append(messages, string(<-subscriber.Messages()))
+	}
+	require.ElementsMatch(t, []string{
+		`message "news" "hello"`,
+		`pmessage "news*" "news" "hello"`,
+		`pmessage "n*s" "news" "hello"`,
+		`pmessage "news*" "news_private" "secret"`,
+	}, messages)
+	require.Equal(t, `pmessage "news*" "news" "hello"`, string(<-filtered.Messages()))
+	require.Empty(t, filtered.Messages())
+
+	// после Close подписки удаляются
+	subscriber.Close()
+	_, ok := <-subscriber.Messages()
+	require.False(t, ok)
+	require.Equal(t, 0, subscriber.Subscribe("news"))
+	require.Equal(t, 1, hub.Publish("news", "hello"))
+	require.Empty(t, hub.channels)
+	require.Len(t, hub.patterns, 1)
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub(16)
+	slow := hub.NewSubscriber(nil)
+	slow.Subscribe("news")
+	fast := hub.NewSubscriber(nil)
+	fast.Subscribe("news")
+
+	for i := 0; i < 16; i++ {
+		require.Equal(t, 2, hub.Publish("news", "hello"))
+		<-fast.Messages()
+	}
+
+	// отстающий подписчик отключается, публикация не ждет его
+	require.Equal(t, 1, hub.Publish("news", "hello"))
+	require.Len(t, slow.Messages(), 16)
+	for range slow.Messages() {
+	}
+	require.Len(t, hub.channels["news"], 1)
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub(16)
+	subscriber := hub.NewSubscriber(nil)
+	other := hub.NewSubscriber(nil)
+	require.Equal(t, 3, subscriber.Subscribe("news", "weather", "sport"))
+	require.Equal(t, 4, subscriber.PSubscribe("n*"))
+	require.Equal(t, 1, other.Subscribe("sport"))
+	require.Equal(t, []string{"news", "sport", "weather"}, hub.Channels("*"))
+	require.Equal(t, []string{"news"}, hub.Channels("n*"))
+
+	// отписка от канала без подписки ничего не меняет
+	require.Equal(t, 3, subscriber.Unsubscribe("news", "music"))
+	require.Equal(t, 1, subscriber.Unsubscribe())
+	require.Equal(t, []string{"sport"}, hub.Channels("*"))
+	require.Equal(t, 1, hub.Publish("news", "hello"))
+	require.Equal(t, `pmessage "n*" "news" "hello"`, string(<-subscriber.Messages()))
+
+	require.Equal(t, 0, subscriber.PUnsubscribe())
+	require.Empty(t, hub.patterns)
+	require.Equal(t, 1, hub.Publish("sport", "goal"))
+	require.Empty(t, subscriber.Messages())
+}
+
+func TestHub_PublishQuoted(t *testing.T) {
+	t.Parallel()
+
+	hub := NewHub(16)
+	subscriber := hub.NewSubscriber(nil)
+	subscriber.Subscribe("breaking news")
+	subscriber.PSubscribe("breaking *")
+
+	// через шлюзы в канал и данные попадают пробелы и переводы строк
+	require.Equal(t, 2, hub.Publish("breaking news", "hello world\n"))
+	require.Equal(t, `message "breaking news" "hello world\n"`, string(<-subscriber.Messages()))
+	require.Equal(t, `pmessage "breaking *" "breaking news" "hello world\n"`, string(<-subscriber.Messages()))
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/auth"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/pubsub"
+	"antdb/internal/service/storage"
+	"antdb/internal/service/storage/engine"
+	"antdb/internal/service/storage/wal"
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDatabase_Subscribe(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	acl, err := auth.NewACL([]auth.UserRule{
+		{Name: "admin", PasswordHash: string(hash), Commands: []string{"all"}, Keys: []string{"*"}},
+		{Name: "reader", PasswordHash: string(hash), Commands: []string{"read"}, Keys: []string{"public_*"}},
+	})
+	require.NoError(t, err)
+
+	hub := pubsub.NewHub(16)
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := storage.NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop(),
+		storage.WithKeyspaceEvents(hub))
+	cmp := compute.NewCompute(compute.NewParser(), compute.NewAnalyzer(zap.NewNop()), zap.NewNop())
+	db := NewDatabase(cmp, st, time.Second, "", acl, zap.NewNop(), WithPubSub(hub))
+
+	session := network.WithSession(context.Background(), network.NewSession())
+	require.Equal(t, "[ok]", db.HandleQuery(session, "AUTH reader secret"))
+	require.Equal(t, "[error] push is not supported by connection", db.HandleQuery(session, "SUBSCRIBE __keyspace__/a"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := network.NewServer(":3236", 2, 1024, zap.NewNop(), network.WithDelimiter('\n'))
+	require.NoError(t, err)
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte(db.HandleQuery(ctx, string(s)) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	subscriber, err := net.Dial("tcp", ":3236")
+	require.NoError(t, err)
+	defer subscriber.Close()
+	messages := bufio.NewReader(subscriber)
+	// ответы и сообщения идут по одному соединению
+	_, err = subscriber.Write([]byte("AUTH reader secret\nSUBSCRIBE __keyspace__/public_a\nPSUBSCRIBE __keyspace__/*\n"))
+	require.NoError(t, err)
+	for _, expected := range []string{"[ok]\n", "[ok] 1\n", "[ok] 2\n"} {
+		response, err := messages.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, expected, response)
+	}
+
+	client, err := net.Dial("tcp", ":3236")
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("AUTH admin secret\nSET private_a 1\nSET public_a 1\nDEL public_a\n"))
+	require.NoError(t, err)
+
+	// события ключей, недоступных пользователю, не приходят
+	for _, expected := range []string{
+		`message "__keyspace__/public_a" "set"` + "\n",
+		`pmessage "__keyspace__/*" "__keyspace__/public_a" "set"` + "\n",
+		`message "__keyspace__/public_a" "del"` + "\n",
+		`pmessage "__keyspace__/*" "__keyspace__/public_a" "del"` + "\n",
+	} {
+		message, err := messages.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, expected, message)
+	}
+}
+
+func TestDatabase_Publish(t *testing.T) {
+	t.Parallel()
+
+	db := newTestDatabase(t, nil, WithPubSub(pubsub.NewHub(16)))
+	session := network.WithSession(context.Background(), network.NewSession())
+	require.Equal(t, "[ok] 0", db.HandleQuery(session, "PUBLISH news hello"))
+	require.Equal(t, "[ok] 0", db.HandleQuery(session, "UNSUBSCRIBE"))
+	require.Equal(t, "[error] channel __keyspace__/a is not allowed", db.HandleQuery(session, "PUBLISH __keyspace__/a set"))
+	require.Equal(t, "[error] invalid pubsub subcommand NUMSUB", db.HandleQuery(session, "PUBSUB NUMSUB"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, err := network.NewServer(":3237", 2, 1024, zap.NewNop(), network.WithDelimiter('\n'))
+	require.NoError(t, err)
+	go func() {
+		err := server.Start(ctx, func(ctx context.Context, s []byte) []byte {
+			return []byte(db.HandleQuery(ctx, string(s)) + "\n")
+		})
+		require.NoError(t, err)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	subscriber, err := net.Dial("tcp", ":3237")
+	require.NoError(t, err)
+	defer subscriber.Close()
+	messages := bufio.NewReader(subscriber)
+	read := func(expected string) {
+		t.Helper()
+
+		message, err := messages.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, expected, message)
+	}
+
+	_, err = subscriber.Write([]byte("SUBSCRIBE news weather\nPSUBSCRIBE n*\n"))
+	require.NoError(t, err)
+	read("[ok] 2\n")
+	read("[ok] 3\n")
+
+	require.Equal(t, "[ok] news weather", db.HandleQuery(session, "PUBSUB CHANNELS"))
+	require.Equal(t, "[ok] news", db.HandleQuery(session, "PUBSUB CHANNELS n*"))
+	require.Equal(t, "[ok] 2", db.HandleQuery(session, "PUBLISH news hello"))
+	read(`message "news" "hello"` + "\n")
+	read(`pmessage "n*" "news" "hello"` + "\n")
+
+	// после отписки соединение продолжает отвечать на запросы
+	_, err = subscriber.Write([]byte("UNSUBSCRIBE news\nPUNSUBSCRIBE\nPING\n"))
+	require.NoError(t, err)
+	read("[ok] 2\n")
+	read("[ok] 1\n")
+	read("[ok] PONG\n")
+
+	require.Equal(t, "[ok] 0", db.HandleQuery(session, "PUBLISH news hello"))
+	require.Equal(t, "[ok] 1", db.HandleQuery(session, "PUBLISH weather rain"))
+	read(`message "weather" "rain"` + "\n")
+	require.Equal(t, "[ok] weather", db.HandleQuery(session, "PUBSUB CHANNELS"))
+}
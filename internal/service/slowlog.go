@@ -0,0 +1,182 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/compute"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Аргументы запроса в SLOWLOG и MONITOR обрезаются, чтобы большие значения
+// не занимали память
+const (
+	maxLoggedArguments      = 32
+	maxLoggedArgumentLength = 128
+	// defaultSlowLogEntries - сколько записей вернуть по SLOWLOG GET без n
+	defaultSlowLogEntries = 10
+)
+
+// SlowLogEntry - запрос, который выполнялся дольше порога
+type SlowLogEntry struct {
+	ID         uint64
+	Time       time.Time
+	Duration   time.Duration
+	ClientAddr string
+	Arguments  []string
+}
+
+// SlowLog - кольцевой буфер последних медленных запросов
+type SlowLog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	entries   []SlowLogEntry
+	next      int
+	size      int
+	lastID    uint64
+}
+
+func NewSlowLog(threshold time.Duration, maxLen int) *SlowLog {
+	return &SlowLog{
+		threshold: threshold,
+		entries:   make([]SlowLogEntry, max(maxLen, 1)),
+	}
+}
+
+// Add записывает запрос, если он выполнялся не меньше порога
+func (l *SlowLog) Add(start time.Time, duration time.Duration, clientAddr string, arguments func() []string) {
+	if duration < l.threshold {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	l.entries[l.next] = SlowLogEntry{
+		ID:         l.lastID,
+		Time:       start,
+		Duration:   duration,
+		ClientAddr: clientAddr,
+		Arguments:  arguments(),
+	}
+	l.next = (l.next + 1) % len(l.entries)
+	l.size = min(l.size+1, len(l.entries))
+}
+
+// Get возвращает не больше n последних записей, начиная с самой новой
+func (l *SlowLog) Get(n int) []SlowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n = min(n, l.size)
+	result := make([]SlowLogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return result
+}
+
+func (l *SlowLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+func (l *SlowLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	clear(l.entries)
+	l.next = 0
+	l.size = 0
+}
+
+// loggedArguments возвращает команду с обрезанными аргументами и
+// модификаторами. Пароль AUTH не записывается
+func loggedArguments(query *compute.Query) []string {
+	arguments := append([]string{string(query.GetCommand())}, query.GetArguments()...)
+	if query.GetCommand() == compute.AuthCommand && len(arguments) > 2 {
+		arguments[2] = "(redacted)"
+	}
+
+	for _, name := range []string{compute.WaitModifier, compute.MinLSNModifier} {
+		if modifier, ok := query.GetModifier(name); ok {
+			arguments = append(append(arguments, name), modifier...)
+		}
+	}
+
+	if len(arguments) > maxLoggedArguments {
+		more := len(arguments) - maxLoggedArguments + 1
+		arguments = append(arguments[:maxLoggedArguments-1], fmt.Sprintf("... (%d more arguments)", more))
+	}
+	for i, argument := range arguments {
+		if len(argument) > maxLoggedArgumentLength {
+			arguments[i] = fmt.Sprintf("%s... (%d more bytes)",
+				argument[:maxLoggedArgumentLength], len(argument)-maxLoggedArgumentLength)
+		}
+	}
+
+	return arguments
+}
+
+// observe учитывает выполненный запрос в метриках и журнале медленных запросов
+func (d *Database) observe(ctx context.Context, query *compute.Query, err error, start time.Time) {
+	duration := time.Since(start)
+	observeCommand(query, err, duration)
+
+	if d.slowLog != nil && query != nil {
+		d.slowLog.Add(start, duration, network.ClientAddr(ctx), func() []string {
+			return loggedArguments(query)
+		})
+	}
+}
+
+// Ответ SLOWLOG GET - одна строка: записи от новых к старым через " # ",
+// аргументы каждой записи в кавычках
+func (d *Database) handleSlowLog(_ context.Context, query *compute.Query) (Result, error) {
+	if d.slowLog == nil {
+		return Result{}, errors.New("slowlog is not enabled")
+	}
+
+	arguments := query.GetArguments()
+	switch strings.ToUpper(arguments[0]) {
+	case "GET":
+		n := defaultSlowLogEntries
+		if len(arguments) > 1 {
+			var err error
+			if n, err = strconv.Atoi(arguments[1]); err != nil || n < 0 {
+				return Result{}, fmt.Errorf("%w number of entries", ErrInvalidArgument)
+			}
+		}
+
+		entries := d.slowLog.Get(n)
+		result := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			result = append(result, formatSlowLogEntry(entry))
+		}
+		return Result{Value: strings.Join(result, " # ")}, nil
+	case "LEN":
+		return Result{Value: strconv.Itoa(d.slowLog.Len())}, nil
+	case "RESET":
+		d.slowLog.Reset()
+		return Result{}, nil
+	}
+
+	return Result{}, fmt.Errorf("%w slowlog subcommand %s", ErrInvalidArgument, arguments[0])
+}
+
+func formatSlowLogEntry(entry SlowLogEntry) string {
+	quoted := make([]string, 0, len(entry.Arguments))
+	for _, argument := range entry.Arguments {
+		quoted = append(quoted, strconv.Quote(argument))
+	}
+
+	return fmt.Sprintf("id:%d time:%d duration_us:%d client:%s args:%s",
+		entry.ID, entry.Time.Unix(), entry.Duration.Microseconds(), entry.ClientAddr, strings.Join(quoted, " "))
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/compute"
+	"context"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowLog(t *testing.T) {
+	t.Parallel()
+
+	slowLog := NewSlowLog(10*time.Millisecond, 2)
+	add := func(duration time.Duration, key string) {
+		slowLog.Add(time.Now(), duration, "127.0.0.1:5000", func() []string {
+			return []string{"GET", key}
+		})
+	}
+
+	add(time.Millisecond, "fast")
+	require.Zero(t, slowLog.Len())
+
+	add(10*time.Millisecond, "first")
+	add(20*time.Millisecond, "second")
+	add(30*time.Millisecond, "third")
+	require.Equal(t, 2, slowLog.Len())
+
+	entries := slowLog.Get(10)
+	require.Len(t, entries, 2)
+	require.Equal(t, uint64(3), entries[0].ID)
+	require.Equal(t, []string{"GET", "third"}, entries[0].Arguments)
+	require.Equal(t, []string{"GET", "second"}, entries[1].Arguments)
+	require.Len(t, slowLog.Get(1), 1)
+
+	slowLog.Reset()
+	require.Zero(t, slowLog.Len())
+	require.Empty(t, slowLog.Get(10))
+}
+
+func TestLoggedArguments(t *testing.T) {
+	t.Parallel()
+
+	query := compute.NewQuery(compute.SetCommand, []string{"key", strings.Repeat("v", 200)})
+	query.SetModifier(compute.WaitModifier, []string{"1", "100"})
+	require.Equal(t, []string{
+		"SET", "key", strings.Repeat("v", 128) + "... (72 more bytes)", "WAIT", "1", "100",
+	}, loggedArguments(query))
+
+	auth := compute.NewQuery(compute.AuthCommand, []string{"admin", "secret"})
+	require.Equal(t, []string{"AUTH", "admin", "(redacted)"}, loggedArguments(auth))
+}
+
+func TestDatabase_SlowLog(t *testing.T) {
+	t.Parallel()
+
+	// нулевой порог записывает все запросы
+	db := newTestDatabase(t, nil, WithSlowLog(NewSlowLog(0, 10)))
+	ctx := network.WithClientAddr(network.WithSession(context.Background(), network.NewSession()), "127.0.0.1:5000")
+
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "SLOWLOG RESET"))
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "SET key value"))
+	require.Equal(t, "[ok] 2", db.HandleQuery(ctx, "SLOWLOG LEN"))
+
+	response := db.HandleQuery(ctx, "SLOWLOG GET 2")
+	entries := strings.Split(strings.TrimPrefix(response, "[ok] "), " # ")
+	require.Len(t, entries, 2)
+	require.Contains(t, entries[0], `client:127.0.0.1:5000 args:"SLOWLOG" "LEN"`)
+	require.Contains(t, entries[1], `args:"SET" "key" "value"`)
+
+	require.Equal(t, "[error] invalid number of entries", db.HandleQuery(ctx, "SLOWLOG GET x"))
+	require.Equal(t, "[error] invalid slowlog subcommand FLUSH", db.HandleQuery(ctx, "SLOWLOG FLUSH"))
+	require.Equal(t, "[error] slowlog is not enabled", newTestDatabase(t, nil).HandleQuery(ctx, "SLOWLOG LEN"))
+}
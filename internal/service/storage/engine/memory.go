@@ -1,12 +1,15 @@
 package engine
 
 import (
+	"strings"
 	"sync"
 )
 
 type MemoryTable struct {
 	mutex sync.RWMutex
 	data  map[string]string
+	// size - суммарная длина ключей и значений
+	size int
 }
 
 func NewMemoryTable() *MemoryTable {
@@ -19,7 +22,11 @@ func (s *MemoryTable) Set(key, value string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	if old, ok := s.data[key]; ok {
+		s.size -= len(key) + len(old)
+	}
 	s.data[key] = value
+	s.size += len(key) + len(value)
 }
 
 func (s *MemoryTable) Get(key string) (string, bool) {
@@ -34,5 +41,37 @@ func (s *MemoryTable) Del(key string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	delete(s.data, key)
+	if old, ok := s.data[key]; ok {
+		s.size -= len(key) + len(old)
+		delete(s.data, key)
+	}
+}
+
+// Scan вызывает fn для каждого ключа с префиксом prefix в произвольном порядке.
+// fn не должна обращаться к таблице
+func (s *MemoryTable) Scan(prefix string, fn func(key, value string)) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for key, value := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			fn(key, value)
+		}
+	}
+}
+
+func (s *MemoryTable) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data = make(map[string]string)
+	s.size = 0
+}
+
+// Stats возвращает число ключей и суммарную длину ключей и значений
+func (s *MemoryTable) Stats() (int, int) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.data), s.size
 }
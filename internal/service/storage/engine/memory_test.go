@@ -59,3 +59,51 @@ func TestMemoryTable_Del(t *testing.T) {
 		require.Empty(t, value)
 	})
 }
+
+func TestMemoryTable_Clear(t *testing.T) {
+	t.Run("should delete all keys", func(t *testing.T) {
+		table := NewMemoryTable()
+		table.Set("key1", "value1")
+		table.Set("key2", "value2")
+		table.Clear()
+		_, found := table.Get("key1")
+		require.False(t, found)
+		_, found = table.Get("key2")
+		require.False(t, found)
+	})
+}
+
+func TestMemoryTable_Scan(t *testing.T) {
+	t.Run("should return keys with prefix", func(t *testing.T) {
+		table := NewMemoryTable()
+		table.Set("user/1", "value1")
+		table.Set("user/2", "value2")
+		table.Set("order/1", "value3")
+
+		result := make(map[string]string)
+		table.Scan("user/", func(key, value string) {
+			result[key] = value
+		})
+		require.Equal(t, map[string]string{"user/1": "value1", "user/2": "value2"}, result)
+	})
+}
+
+func TestMemoryTable_Stats(t *testing.T) {
+	t.Run("should count keys and their size", func(t *testing.T) {
+		table := NewMemoryTable()
+		table.Set("key1", "value1")
+		table.Set("key2", "value2")
+		table.Set("key1", "v")
+		table.Del("key2")
+		table.Del("key3")
+
+		keys, size := table.Stats()
+		require.Equal(t, 1, keys)
+		require.Equal(t, len("key1")+len("v"), size)
+
+		table.Clear()
+		keys, size = table.Stats()
+		require.Zero(t, keys)
+		require.Zero(t, size)
+	})
+}
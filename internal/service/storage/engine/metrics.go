@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keysDesc = prometheus.NewDesc("antdb_keys",
+		"Number of keys in the table.", nil, nil)
+	dataBytesDesc = prometheus.NewDesc("antdb_data_bytes",
+		"Total length of keys and values, without map overhead.", nil, nil)
+)
+
+// Describe и Collect позволяют зарегистрировать таблицу как коллектор
+// метрик размера данных
+func (s *MemoryTable) Describe(ch chan<- *prometheus.Desc) {
+	ch <- keysDesc
+	ch <- dataBytesDesc
+}
+
+func (s *MemoryTable) Collect(ch chan<- prometheus.Metric) {
+	keys, size := s.Stats()
+	ch <- prometheus.MustNewConstMetric(keysDesc, prometheus.GaugeValue, float64(keys))
+	ch <- prometheus.MustNewConstMetric(dataBytesDesc, prometheus.GaugeValue, float64(size))
+}
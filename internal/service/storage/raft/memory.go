@@ -0,0 +1,126 @@
+package raft
+
+import (
+	"antdb/internal/service/storage/wal"
+	"context"
+	"math/rand"
+	"sync"
+)
+
+// MemoryNetwork - сеть узлов внутри одного процесса, с возможностью
+// отключать узлы и терять сообщения
+type MemoryNetwork struct {
+	mu           sync.RWMutex
+	handlers     map[string]Handler
+	disconnected map[string]bool
+	dropRate     float64
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		handlers:     make(map[string]Handler),
+		disconnected: make(map[string]bool),
+	}
+}
+
+func (n *MemoryNetwork) Transport(id string) *MemoryTransport {
+	return &MemoryTransport{
+		id:      id,
+		network: n,
+	}
+}
+
+// Disconnect изолирует узел: он не получает и не отправляет сообщения
+func (n *MemoryNetwork) Disconnect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.disconnected[id] = true
+}
+
+func (n *MemoryNetwork) Connect(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.disconnected, id)
+}
+
+// SetDropRate задает долю сообщений, которые будут потеряны (0..1)
+func (n *MemoryNetwork) SetDropRate(rate float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.dropRate = rate
+}
+
+func (n *MemoryNetwork) route(from, to string) (Handler, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.disconnected[from] || n.disconnected[to] {
+		return nil, ErrUnreachable
+	}
+	if n.dropRate > 0 && rand.Float64() < n.dropRate {
+		return nil, ErrUnreachable
+	}
+
+	handler, ok := n.handlers[to]
+	if !ok {
+		return nil, ErrUnreachable
+	}
+
+	return handler, nil
+}
+
+type MemoryTransport struct {
+	id      string
+	network *MemoryNetwork
+}
+
+func (t *MemoryTransport) Listen(ctx context.Context, handler Handler) error {
+	t.network.mu.Lock()
+	t.network.handlers[t.id] = handler
+	t.network.mu.Unlock()
+
+	<-ctx.Done()
+
+	t.network.mu.Lock()
+	if t.network.handlers[t.id] == handler {
+		delete(t.network.handlers, t.id)
+	}
+	t.network.mu.Unlock()
+	return nil
+}
+
+func (t *MemoryTransport) RequestVote(_ context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	handler, err := t.network.route(t.id, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	reqCopy := *req
+	return handler.HandleRequestVote(&reqCopy), nil
+}
+
+func (t *MemoryTransport) AppendEntries(_ context.Context, peer string, req *AppendRequest) (*AppendResponse, error) {
+	handler, err := t.network.route(t.id, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	// копируем записи, как если бы они прошли через сеть
+	reqCopy := *req
+	reqCopy.Entries = make([]*wal.Unit, 0, len(req.Entries))
+	for _, entry := range req.Entries {
+		entryCopy := *entry
+		reqCopy.Entries = append(reqCopy.Entries, &entryCopy)
+	}
+
+	resp := handler.HandleAppendEntries(&reqCopy)
+
+	// ответ тоже может потеряться
+	if _, err = t.network.route(peer, t.id); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,672 @@
+package raft
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage/replication"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	follower = iota
+	candidate
+	leader
+)
+
+var roleNames = map[int]string{
+	follower:  "follower",
+	candidate: replication.RoleCandidate,
+	leader:    "leader",
+}
+
+// noopCommand - пустая запись, которую новый лидер добавляет в свой срок,
+// чтобы закоммитить записи предыдущих сроков
+const noopCommand = "NOOP"
+
+const maxAppendEntries = 64
+
+var (
+	ErrNotLeader      = errors.New("not leader")
+	ErrLeadershipLost = errors.New("leadership lost before commit")
+)
+
+type StateMachine interface {
+	Set(string, string)
+	Del(string)
+}
+
+type Config struct {
+	ID                string
+	Peers             []string
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+}
+
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+type Node struct {
+	id                string
+	peers             []string
+	electionTimeout   time.Duration
+	heartbeatInterval time.Duration
+
+	mu           sync.Mutex
+	state        int
+	currentTerm  uint64
+	votedFor     string
+	leaderID     string
+	log          []*wal.Unit
+	commitIndex  uint64
+	lastApplied  uint64
+	applied      chan struct{}
+	nextIndex    map[string]uint64
+	matchIndex   map[string]uint64
+	replicating  map[string]bool
+	contacts     map[string]time.Time
+	electionAt   time.Time
+	waiters      map[uint64]*waiter
+	trigger      chan struct{}
+	stateMachine StateMachine
+	observer     func(*wal.Unit)
+	transport    Transport
+	store        LogStore
+	logger       *zap.Logger
+
+	// время и commitIndex последнего AppendEntries от лидера, по ним
+	// follower оценивает связь с лидером. Защищены mu
+	leaderContact time.Time
+	leaderCommit  uint64
+}
+
+func NewNode(cfg Config, transport Transport, store LogStore, stateMachine StateMachine, logger *zap.Logger) (*Node, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("empty node id")
+	}
+	if cfg.HeartbeatInterval <= 0 || cfg.ElectionTimeout <= cfg.HeartbeatInterval {
+		return nil, errors.New("election timeout must be greater than heartbeat interval")
+	}
+
+	state, log, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load raft log: %w", err)
+	}
+
+	node := &Node{
+		id:                cfg.ID,
+		peers:             cfg.Peers,
+		electionTimeout:   cfg.ElectionTimeout,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		state:             follower,
+		currentTerm:       state.Term,
+		votedFor:          state.VotedFor,
+		log:               log,
+		replicating:       make(map[string]bool),
+		contacts:          make(map[string]time.Time),
+		waiters:           make(map[uint64]*waiter),
+		trigger:           make(chan struct{}, 1),
+		applied:           make(chan struct{}),
+		stateMachine:      stateMachine,
+		transport:         transport,
+		store:             store,
+		logger:            logger.With(zap.String("node", cfg.ID)),
+	}
+	node.resetElectionTimer()
+
+	return node, nil
+}
+
+// Observe задает функцию, которая вызывается для каждой примененной записи
+func (n *Node) Observe(observer func(*wal.Unit)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.observer = observer
+}
+
+func (n *Node) Start(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- n.transport.Listen(ctx, n)
+	}()
+
+	ticker := time.NewTicker(n.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.stop()
+			return nil
+		case err := <-errCh:
+			return fmt.Errorf("raft transport stopped: %w", err)
+		case <-ticker.C:
+			n.tick(ctx)
+		case <-n.trigger:
+			n.mu.Lock()
+			if n.state == leader {
+				n.broadcastLocked(ctx)
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+func (n *Node) IsMaster() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.state == leader
+}
+
+// Leader возвращает идентификатор текущего лидера, если он известен
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.leaderID
+}
+
+// Propose добавляет запись в лог и ждет, пока она будет закоммичена
+// кворумом и применена к локальному состоянию
+func (n *Node) Propose(ctx context.Context, unit *wal.Unit) (uint64, error) {
+	n.mu.Lock()
+	if n.state != leader {
+		leaderID := n.leaderID
+		n.mu.Unlock()
+		if leaderID == "" {
+			return 0, ErrNotLeader
+		}
+		return 0, fmt.Errorf("%w, leader is %s", ErrNotLeader, leaderID)
+	}
+
+	entry := *unit
+	entry.LSN = n.lastIndex() + 1
+	entry.Term = n.currentTerm
+	if err := n.appendLocked([]*wal.Unit{&entry}); err != nil {
+		n.mu.Unlock()
+		return 0, fmt.Errorf("can't append to log: %w", err)
+	}
+
+	w := &waiter{term: entry.Term, done: make(chan error, 1)}
+	n.waiters[entry.LSN] = w
+	n.advanceCommitLocked()
+	n.mu.Unlock()
+
+	select {
+	case n.trigger <- struct{}{}:
+	default:
+	}
+
+	select {
+	case err := <-w.done:
+		if err != nil {
+			return 0, err
+		}
+		return entry.LSN, nil
+	case <-ctx.Done():
+		n.mu.Lock()
+		delete(n.waiters, entry.LSN)
+		n.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// WaitForApplied ждет, пока узел применит запись с индексом lsn
+func (n *Node) WaitForApplied(ctx context.Context, lsn uint64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		n.mu.Lock()
+		lastApplied := n.lastApplied
+		applied := n.applied
+		n.mu.Unlock()
+
+		if lastApplied >= lsn {
+			return nil
+		}
+
+		select {
+		case <-applied:
+		case <-timer.C:
+			return fmt.Errorf("%w: %d, applied %d", replication.ErrNotApplied, lsn, lastApplied)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Status возвращает роль узла, номер последней закоммиченной записи,
+// для follower - связь с лидером, для лидера - позиции остальных узлов.
+// Связь с лидером считается потерянной, если от него не было AppendEntries
+// дольше electionTimeout
+func (n *Node) Status() replication.Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	status := replication.Status{
+		Role: roleNames[n.state],
+		LSN:  n.commitIndex,
+	}
+	if n.state == follower {
+		status.Link = &replication.LinkStatus{
+			MasterAddress: n.leaderID,
+			Up:            n.leaderID != "" && time.Since(n.leaderContact) < n.electionTimeout,
+			LastContact:   n.leaderContact,
+			MasterLSN:     n.leaderCommit,
+			LagRecords:    n.leaderCommit - min(n.leaderCommit, n.commitIndex),
+		}
+	}
+	if n.state != leader {
+		return status
+	}
+
+	for _, peer := range n.peers {
+		status.Replicas = append(status.Replicas, replication.ReplicaStatus{
+			ID:          peer,
+			AckLSN:      n.matchIndex[peer],
+			LastContact: n.contacts[peer],
+		})
+	}
+	return status
+}
+
+func (n *Node) HandleRequestVote(req *VoteRequest) *VoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term > n.currentTerm {
+		n.becomeFollowerLocked(req.Term, "")
+	}
+
+	resp := &VoteResponse{Term: n.currentTerm}
+	if req.Term < n.currentTerm {
+		return resp
+	}
+
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+	if (n.votedFor == "" || n.votedFor == req.CandidateID) && upToDate {
+		n.votedFor = req.CandidateID
+		if err := n.persistStateLocked(); err != nil {
+			n.logger.Error("can't persist vote", zap.Error(err))
+			return resp
+		}
+		n.resetElectionTimer()
+		resp.Granted = true
+	}
+
+	return resp
+}
+
+func (n *Node) HandleAppendEntries(req *AppendRequest) *AppendResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	resp := &AppendResponse{Term: n.currentTerm}
+	if req.Term < n.currentTerm {
+		return resp
+	}
+
+	if req.Term > n.currentTerm || n.state != follower {
+		n.becomeFollowerLocked(req.Term, req.LeaderID)
+	}
+	n.leaderID = req.LeaderID
+	n.leaderContact = time.Now()
+	n.leaderCommit = max(n.leaderCommit, req.LeaderCommit)
+	n.resetElectionTimer()
+	resp.Term = n.currentTerm
+
+	if req.PrevLogIndex > n.lastIndex() {
+		resp.ConflictIndex = n.lastIndex() + 1
+		return resp
+	}
+	if req.PrevLogIndex > 0 && n.log[req.PrevLogIndex-1].Term != req.PrevLogTerm {
+		// откатываемся к началу конфликтующего срока
+		conflictTerm := n.log[req.PrevLogIndex-1].Term
+		index := req.PrevLogIndex
+		for index > 1 && n.log[index-2].Term == conflictTerm {
+			index--
+		}
+		resp.ConflictIndex = index
+		return resp
+	}
+
+	var newEntries []*wal.Unit
+	for i, entry := range req.Entries {
+		index := req.PrevLogIndex + uint64(i) + 1
+		if index <= n.lastIndex() && n.log[index-1].Term == entry.Term {
+			continue
+		}
+		newEntries = req.Entries[i:]
+		break
+	}
+	if len(newEntries) > 0 {
+		if err := n.appendLocked(newEntries); err != nil {
+			n.logger.Error("can't append entries", zap.Error(err))
+			return resp
+		}
+	}
+
+	lastNew := req.PrevLogIndex + uint64(len(req.Entries))
+	if req.LeaderCommit > n.commitIndex {
+		n.commitIndex = min(req.LeaderCommit, lastNew)
+		n.applyLocked()
+	}
+
+	resp.Success = true
+	return resp
+}
+
+func (n *Node) tick(ctx context.Context) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.state == leader {
+		n.broadcastLocked(ctx)
+		return
+	}
+
+	if time.Now().After(n.electionAt) {
+		n.startElectionLocked(ctx)
+	}
+}
+
+func (n *Node) startElectionLocked(ctx context.Context) {
+	n.state = candidate
+	n.currentTerm++
+	n.votedFor = n.id
+	n.leaderID = ""
+	n.resetElectionTimer()
+	if err := n.persistStateLocked(); err != nil {
+		n.logger.Error("can't persist term", zap.Error(err))
+		return
+	}
+
+	term := n.currentTerm
+	n.logger.Debug("start election", zap.Uint64("term", term))
+
+	if n.quorum() == 1 {
+		n.becomeLeaderLocked(ctx)
+		return
+	}
+
+	req := &VoteRequest{
+		Term:         term,
+		CandidateID:  n.id,
+		LastLogIndex: n.lastIndex(),
+		LastLogTerm:  n.lastTerm(),
+	}
+
+	votes := 1
+	for _, peer := range n.peers {
+		go func(peer string) {
+			reqCtx, cancel := context.WithTimeout(ctx, n.electionTimeout)
+			defer cancel()
+
+			resp, err := n.transport.RequestVote(reqCtx, peer, req)
+			if err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			if resp.Term > n.currentTerm {
+				n.becomeFollowerLocked(resp.Term, "")
+				return
+			}
+			if n.state != candidate || n.currentTerm != term || !resp.Granted {
+				return
+			}
+
+			votes++
+			if votes >= n.quorum() {
+				n.becomeLeaderLocked(ctx)
+			}
+		}(peer)
+	}
+}
+
+func (n *Node) becomeLeaderLocked(ctx context.Context) {
+	n.logger.Info("became leader", zap.Uint64("term", n.currentTerm))
+
+	n.state = leader
+	n.leaderID = n.id
+	n.nextIndex = make(map[string]uint64, len(n.peers))
+	n.matchIndex = make(map[string]uint64, len(n.peers))
+	for _, peer := range n.peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+
+	noop := &wal.Unit{Command: noopCommand, LSN: n.lastIndex() + 1, Term: n.currentTerm}
+	if err := n.appendLocked([]*wal.Unit{noop}); err != nil {
+		n.logger.Error("can't append noop entry", zap.Error(err))
+	}
+
+	n.advanceCommitLocked()
+	n.broadcastLocked(ctx)
+}
+
+func (n *Node) becomeFollowerLocked(term uint64, leaderID string) {
+	if n.state == leader {
+		n.logger.Info("step down", zap.Uint64("term", term))
+	}
+
+	n.state = follower
+	n.leaderID = leaderID
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		if err := n.persistStateLocked(); err != nil {
+			n.logger.Error("can't persist term", zap.Error(err))
+		}
+	}
+	n.resetElectionTimer()
+}
+
+func (n *Node) broadcastLocked(ctx context.Context) {
+	for _, peer := range n.peers {
+		if n.replicating[peer] {
+			continue
+		}
+		n.replicating[peer] = true
+		go n.replicate(ctx, peer)
+	}
+}
+
+func (n *Node) replicate(ctx context.Context, peer string) {
+	defer func() {
+		n.mu.Lock()
+		n.replicating[peer] = false
+		n.mu.Unlock()
+	}()
+
+	for {
+		n.mu.Lock()
+		if n.state != leader {
+			n.mu.Unlock()
+			return
+		}
+
+		term := n.currentTerm
+		next := n.nextIndex[peer]
+		prevIndex := next - 1
+		var prevTerm uint64
+		if prevIndex > 0 {
+			prevTerm = n.log[prevIndex-1].Term
+		}
+		last := min(n.lastIndex(), prevIndex+maxAppendEntries)
+		entries := make([]*wal.Unit, 0, last-prevIndex)
+		entries = append(entries, n.log[prevIndex:last]...)
+		req := &AppendRequest{
+			Term:         term,
+			LeaderID:     n.id,
+			PrevLogIndex: prevIndex,
+			PrevLogTerm:  prevTerm,
+			Entries:      entries,
+			LeaderCommit: n.commitIndex,
+		}
+		n.mu.Unlock()
+
+		reqCtx, cancel := context.WithTimeout(ctx, n.electionTimeout)
+		resp, err := n.transport.AppendEntries(reqCtx, peer, req)
+		cancel()
+		if err != nil {
+			return
+		}
+
+		n.mu.Lock()
+		n.contacts[peer] = time.Now()
+		if resp.Term > n.currentTerm {
+			n.becomeFollowerLocked(resp.Term, "")
+			n.mu.Unlock()
+			return
+		}
+		if n.state != leader || n.currentTerm != term {
+			n.mu.Unlock()
+			return
+		}
+
+		if resp.Success {
+			match := prevIndex + uint64(len(entries))
+			if match > n.matchIndex[peer] {
+				n.matchIndex[peer] = match
+			}
+			n.nextIndex[peer] = match + 1
+			n.advanceCommitLocked()
+		} else if resp.ConflictIndex > 0 {
+			n.nextIndex[peer] = resp.ConflictIndex
+		} else if n.nextIndex[peer] > 1 {
+			n.nextIndex[peer]--
+		}
+
+		// продолжаем, пока у узла есть что догонять
+		done := resp.Success && n.nextIndex[peer] > n.lastIndex()
+		n.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+func (n *Node) advanceCommitLocked() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		// коммитим только записи своего срока (раздел 5.4.2)
+		if n.log[index-1].Term != n.currentTerm {
+			break
+		}
+
+		count := 1
+		for _, peer := range n.peers {
+			if n.matchIndex[peer] >= index {
+				count++
+			}
+		}
+		if count >= n.quorum() {
+			n.commitIndex = index
+			n.applyLocked()
+			return
+		}
+	}
+}
+
+func (n *Node) applyLocked() {
+	if n.lastApplied < n.commitIndex {
+		defer func() {
+			close(n.applied)
+			n.applied = make(chan struct{})
+		}()
+	}
+
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		entry := n.log[n.lastApplied-1]
+
+		switch entry.Command {
+		case string(compute.SetCommand):
+			n.stateMachine.Set(entry.Arguments[0], entry.Arguments[1])
+		case string(compute.DelCommand):
+			n.stateMachine.Del(entry.Arguments[0])
+		}
+		if n.observer != nil && entry.Command != noopCommand {
+			n.observer(entry)
+		}
+
+		if w, ok := n.waiters[entry.LSN]; ok {
+			if w.term == entry.Term {
+				w.done <- nil
+			} else {
+				w.done <- ErrLeadershipLost
+			}
+			delete(n.waiters, entry.LSN)
+		}
+	}
+}
+
+func (n *Node) appendLocked(entries []*wal.Unit) error {
+	first := entries[0].LSN
+	if first == 0 || first > n.lastIndex()+1 {
+		return fmt.Errorf("invalid entry index %d", first)
+	}
+
+	if err := n.store.Append(entries); err != nil {
+		return err
+	}
+
+	// ожидающие записи, которые будут перезаписаны, уже не закоммитятся
+	for index := first; index <= n.lastIndex(); index++ {
+		if w, ok := n.waiters[index]; ok {
+			w.done <- ErrLeadershipLost
+			delete(n.waiters, index)
+		}
+	}
+
+	n.log = append(n.log[:first-1], entries...)
+	return nil
+}
+
+func (n *Node) stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.state = follower
+	for index, w := range n.waiters {
+		w.done <- ErrLeadershipLost
+		delete(n.waiters, index)
+	}
+}
+
+func (n *Node) persistStateLocked() error {
+	return n.store.SaveState(&HardState{Term: n.currentTerm, VotedFor: n.votedFor})
+}
+
+func (n *Node) resetElectionTimer() {
+	timeout := n.electionTimeout + time.Duration(rand.Int63n(int64(n.electionTimeout)))
+	n.electionAt = time.Now().Add(timeout)
+}
+
+func (n *Node) quorum() int {
+	return (len(n.peers)+1)/2 + 1
+}
+
+func (n *Node) lastIndex() uint64 {
+	return uint64(len(n.log))
+}
+
+func (n *Node) lastTerm() uint64 {
+	if len(n.log) == 0 {
+		return 0
+	}
+	return n.log[len(n.log)-1].Term
+}
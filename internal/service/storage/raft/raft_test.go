@@ -0,0 +1,295 @@
+package raft
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage/engine"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+type testNode struct {
+	node   *Node
+	store  *MemoryStore
+	table  *engine.MemoryTable
+	cancel context.CancelFunc
+}
+
+type testCluster struct {
+	t       *testing.T
+	network *MemoryNetwork
+	ids     []string
+	nodes   map[string]*testNode
+}
+
+func newTestCluster(t *testing.T, size int) *testCluster {
+	c := &testCluster{
+		t:       t,
+		network: NewMemoryNetwork(),
+		nodes:   make(map[string]*testNode, size),
+	}
+	for i := 1; i <= size; i++ {
+		c.ids = append(c.ids, fmt.Sprintf("node%d", i))
+	}
+	for _, id := range c.ids {
+		c.start(id, NewMemoryStore())
+	}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.cancel()
+		}
+	})
+	return c
+}
+
+func (c *testCluster) start(id string, store *MemoryStore) {
+	var peers []string
+	for _, peer := range c.ids {
+		if peer != id {
+			peers = append(peers, peer)
+		}
+	}
+
+	table := engine.NewMemoryTable()
+	node, err := NewNode(Config{
+		ID:                id,
+		Peers:             peers,
+		ElectionTimeout:   50 * time.Millisecond,
+		HeartbeatInterval: 10 * time.Millisecond,
+	}, c.network.Transport(id), store, table, zap.NewNop())
+	require.NoError(c.t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_ = node.Start(ctx)
+	}()
+	c.nodes[id] = &testNode{node: node, store: store, table: table, cancel: cancel}
+}
+
+func (c *testCluster) restart(id string) {
+	n := c.nodes[id]
+	n.cancel()
+	c.start(id, n.store)
+}
+
+func (c *testCluster) leader(except ...string) string {
+	var leaderID string
+	require.Eventually(c.t, func() bool {
+		leaders := 0
+		for id, n := range c.nodes {
+			if contains(except, id) || !n.node.IsMaster() {
+				continue
+			}
+			leaders++
+			leaderID = id
+		}
+		return leaders == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	return leaderID
+}
+
+func (c *testCluster) set(ctx context.Context, id, key, value string) error {
+	_, err := c.nodes[id].node.Propose(ctx, wal.NewUnit(compute.SetCommand, []string{key, value}))
+	return err
+}
+
+func (c *testCluster) requireValue(id, key, value string) {
+	require.Eventually(c.t, func() bool {
+		got, ok := c.nodes[id].table.Get(key)
+		return ok && got == value
+	}, 3*time.Second, 10*time.Millisecond, "node %s key %s", id, key)
+}
+
+func contains(ids []string, id string) bool {
+	for _, item := range ids {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNode_SingleNode(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 1)
+	leader := cluster.leader()
+
+	err := cluster.set(context.Background(), leader, "key", "value")
+	require.NoError(t, err)
+
+	value, ok := cluster.nodes[leader].table.Get("key")
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+}
+
+func TestNode_Replication(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 3)
+	leader := cluster.leader()
+
+	require.NoError(t, cluster.set(context.Background(), leader, "key1", "value1"))
+	_, err := cluster.nodes[leader].node.Propose(context.Background(),
+		wal.NewUnit(compute.DelCommand, []string{"key1"}))
+	require.NoError(t, err)
+	lsn, err := cluster.nodes[leader].node.Propose(context.Background(),
+		wal.NewUnit(compute.SetCommand, []string{"key2", "value2"}))
+	require.NoError(t, err)
+
+	for _, id := range cluster.ids {
+		require.NoError(t, cluster.nodes[id].node.WaitForApplied(context.Background(), lsn, time.Second))
+		cluster.requireValue(id, "key2", "value2")
+		_, ok := cluster.nodes[id].table.Get("key1")
+		require.False(t, ok)
+	}
+}
+
+func TestNode_ProposeOnFollower(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 3)
+	leader := cluster.leader()
+
+	for _, id := range cluster.ids {
+		if id == leader {
+			continue
+		}
+		require.Eventually(t, func() bool {
+			return cluster.nodes[id].node.Leader() == leader
+		}, time.Second, 10*time.Millisecond)
+
+		err := cluster.set(context.Background(), id, "key", "value")
+		require.True(t, errors.Is(err, ErrNotLeader))
+		require.Contains(t, err.Error(), leader)
+	}
+}
+
+func TestNode_LeaderFailover(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 3)
+	oldLeader := cluster.leader()
+	require.NoError(t, cluster.set(context.Background(), oldLeader, "key", "before"))
+
+	cluster.network.Disconnect(oldLeader)
+	newLeader := cluster.leader(oldLeader)
+	require.NotEqual(t, oldLeader, newLeader)
+
+	// изолированный лидер не может собрать кворум
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.Error(t, cluster.set(ctx, oldLeader, "key", "lost"))
+
+	require.NoError(t, cluster.set(context.Background(), newLeader, "key", "after"))
+
+	cluster.network.Connect(oldLeader)
+	for _, id := range cluster.ids {
+		cluster.requireValue(id, "key", "after")
+	}
+	require.Eventually(t, func() bool {
+		return !cluster.nodes[oldLeader].node.IsMaster()
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNode_MinorityPartition(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 5)
+	leader := cluster.leader()
+
+	var followers []string
+	for _, id := range cluster.ids {
+		if id != leader {
+			followers = append(followers, id)
+		}
+	}
+	cluster.network.Disconnect(followers[0])
+	cluster.network.Disconnect(followers[1])
+
+	require.NoError(t, cluster.set(context.Background(), leader, "key", "value"))
+	cluster.requireValue(followers[2], "key", "value")
+
+	cluster.network.Connect(followers[0])
+	cluster.network.Connect(followers[1])
+	cluster.requireValue(followers[0], "key", "value")
+	cluster.requireValue(followers[1], "key", "value")
+}
+
+func TestNode_LossyNetwork(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 3)
+	cluster.network.SetDropRate(0.2)
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		require.Eventually(t, func() bool {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			return cluster.set(ctx, cluster.leader(), key, "value") == nil
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	cluster.network.SetDropRate(0)
+	for _, id := range cluster.ids {
+		for i := 0; i < 10; i++ {
+			cluster.requireValue(id, fmt.Sprintf("key%d", i), "value")
+		}
+	}
+}
+
+func TestNode_Restart(t *testing.T) {
+	t.Parallel()
+
+	cluster := newTestCluster(t, 3)
+	leader := cluster.leader()
+	require.NoError(t, cluster.set(context.Background(), leader, "key", "value"))
+
+	for _, id := range cluster.ids {
+		cluster.requireValue(id, "key", "value")
+		cluster.restart(id)
+	}
+
+	cluster.leader()
+	for _, id := range cluster.ids {
+		cluster.requireValue(id, "key", "value")
+	}
+}
+
+func TestNode_FollowerStatus(t *testing.T) {
+	t.Parallel()
+
+	// узел не запущен, поэтому сам выборы не начнет
+	node, err := NewNode(Config{
+		ID:                "node1",
+		Peers:             []string{"node2", "node3"},
+		ElectionTimeout:   50 * time.Millisecond,
+		HeartbeatInterval: 10 * time.Millisecond,
+	}, NewMemoryNetwork().Transport("node1"), NewMemoryStore(), engine.NewMemoryTable(), zap.NewNop())
+	require.NoError(t, err)
+
+	status := node.Status()
+	require.Equal(t, "follower", status.Role)
+	require.NotNil(t, status.Link)
+	require.False(t, status.Link.Up)
+	require.Empty(t, status.Link.MasterAddress)
+
+	node.HandleAppendEntries(&AppendRequest{Term: 1, LeaderID: "node2", LeaderCommit: 3})
+	status = node.Status()
+	require.True(t, status.Link.Up)
+	require.Equal(t, "node2", status.Link.MasterAddress)
+	require.Equal(t, uint64(3), status.Link.MasterLSN)
+	require.Equal(t, uint64(3), status.Link.LagRecords)
+
+	// лидер молчит дольше electionTimeout
+	time.Sleep(60 * time.Millisecond)
+	status = node.Status()
+	require.False(t, status.Link.Up)
+	require.Equal(t, "node2", status.Link.MasterAddress)
+}
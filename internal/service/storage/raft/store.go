@@ -0,0 +1,154 @@
+package raft
+
+import (
+	"antdb/internal/service/storage/wal"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path"
+	"sync"
+)
+
+const stateFileName = "raft-state.gob"
+
+// HardState - состояние узла, которое должно пережить перезапуск
+type HardState struct {
+	Term     uint64
+	VotedFor string
+}
+
+type LogStore interface {
+	Load() (*HardState, []*wal.Unit, error)
+	SaveState(*HardState) error
+	Append([]*wal.Unit) error
+}
+
+// WALStore хранит лог raft в сегментах WAL. Сегменты только дописываются,
+// поэтому запись с уже существующим LSN при чтении отбрасывает хвост лога.
+type WALStore struct {
+	directory string
+	writer    *wal.Writer
+	logger    *zap.Logger
+}
+
+func NewWALStore(dir string, maxSegmentSize int, logger *zap.Logger) *WALStore {
+	return &WALStore{
+		directory: dir,
+		writer:    wal.NewWriter(dir, maxSegmentSize, logger),
+		logger:    logger,
+	}
+}
+
+func (s *WALStore) Load() (*HardState, []*wal.Unit, error) {
+	state := &HardState{}
+	data, err := os.ReadFile(path.Join(s.directory, stateFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("can't read state: %w", err)
+	}
+	if err == nil {
+		if err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(state); err != nil {
+			return nil, nil, fmt.Errorf("can't decode state: %w", err)
+		}
+	}
+
+	reader := wal.NewReader(s.directory, s.logger)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- reader.Read()
+	}()
+
+	var log []*wal.Unit
+	var replayErr error
+	for units := range reader.GetStream() {
+		for _, unit := range units {
+			if unit.LSN == 0 || replayErr != nil {
+				continue
+			}
+			if unit.LSN > uint64(len(log))+1 {
+				replayErr = fmt.Errorf("gap in log: expected lsn %d, got %d", len(log)+1, unit.LSN)
+				continue
+			}
+			log = append(log[:unit.LSN-1], unit)
+		}
+	}
+	if err = <-errCh; err != nil {
+		return nil, nil, fmt.Errorf("can't read log: %w", err)
+	}
+	if replayErr != nil {
+		return nil, nil, replayErr
+	}
+
+	return state, log, nil
+}
+
+func (s *WALStore) SaveState(state *HardState) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return fmt.Errorf("can't encode state: %w", err)
+	}
+
+	tmpName := path.Join(s.directory, stateFileName+".tmp")
+	file, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open state file: %w", err)
+	}
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("can't write state: %w", err)
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("can't sync state: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("can't close state file: %w", err)
+	}
+
+	return os.Rename(tmpName, path.Join(s.directory, stateFileName))
+}
+
+func (s *WALStore) Append(units []*wal.Unit) error {
+	return s.writer.Write(units)
+}
+
+// MemoryStore - хранилище для тестов, переживает "перезапуск" узла
+type MemoryStore struct {
+	mu    sync.Mutex
+	state HardState
+	log   []*wal.Unit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() (*HardState, []*wal.Unit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state
+	log := make([]*wal.Unit, len(s.log))
+	copy(log, s.log)
+	return &state, log, nil
+}
+
+func (s *MemoryStore) SaveState(state *HardState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = *state
+	return nil
+}
+
+func (s *MemoryStore) Append(units []*wal.Unit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, unit := range units {
+		s.log = append(s.log[:unit.LSN-1], unit)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package raft
+
+import (
+	"antdb/internal/service/storage/wal"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestWALStore_Load(t *testing.T) {
+	tempDir := t.TempDir()
+	store := NewWALStore(tempDir, 1024, zap.NewNop())
+
+	state, log, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, &HardState{}, state)
+	require.Len(t, log, 0)
+
+	require.NoError(t, store.SaveState(&HardState{Term: 3, VotedFor: "node2"}))
+	require.NoError(t, store.Append([]*wal.Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1, Term: 1},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2, Term: 1},
+		{Command: "SET", Arguments: []string{"c", "3"}, LSN: 3, Term: 1},
+	}))
+	// новый лидер перезаписал хвост лога
+	require.NoError(t, store.Append([]*wal.Unit{
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 2, Term: 2},
+	}))
+
+	state, log, err = NewWALStore(tempDir, 1024, zap.NewNop()).Load()
+	require.NoError(t, err)
+	require.Equal(t, &HardState{Term: 3, VotedFor: "node2"}, state)
+	require.Equal(t, []*wal.Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1, Term: 1},
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 2, Term: 2},
+	}, log)
+}
@@ -0,0 +1,241 @@
+package raft
+
+import (
+	"antdb/internal/service/storage/replication"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const dialTimeout = time.Second
+
+// maxFrameSize - наибольший размер RPC. Пачка AppendEntries может занимать
+// много чтений, поэтому RPC передаются с длиной, см. replication.EncodeFrame
+const maxFrameSize = 64 << 20
+
+type rpcRequest struct {
+	Vote   *VoteRequest
+	Append *AppendRequest
+}
+
+type rpcResponse struct {
+	Vote   *VoteResponse
+	Append *AppendResponse
+}
+
+type peerConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// TCPTransport передает RPC между узлами поверх tcp, сообщения кодируются gob
+type TCPTransport struct {
+	address string
+	peers   map[string]string
+	conns   map[string]*peerConn
+	logger  *zap.Logger
+}
+
+func NewTCPTransport(address string, peers map[string]string, logger *zap.Logger) *TCPTransport {
+	conns := make(map[string]*peerConn, len(peers))
+	for id := range peers {
+		conns[id] = &peerConn{}
+	}
+
+	return &TCPTransport{
+		address: address,
+		peers:   peers,
+		conns:   conns,
+		logger:  logger,
+	}
+}
+
+// Listen принимает соединения узлов, пока не отменен ctx. Каждое соединение
+// читается в своей горутине: узел отправляет по нему RPC одно за другим
+func (t *TCPTransport) Listen(ctx context.Context, handler Handler) error {
+	listener, err := net.Listen("tcp", t.address)
+	if err != nil {
+		return fmt.Errorf("can't listen %s: %w", t.address, err)
+	}
+
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("can't accept connection: %w", err)
+		}
+
+		mu.Lock()
+		// остановка могла закрыть соединения до того, как это попало в список
+		if ctx.Err() != nil {
+			mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				_ = conn.Close()
+			}()
+
+			t.serve(ctx, conn, handler)
+		}()
+	}
+}
+
+// serve отвечает на RPC соединения, пока оно открыто
+func (t *TCPTransport) serve(ctx context.Context, conn net.Conn, handler Handler) {
+	for {
+		data, err := replication.ReadFrame(conn, maxFrameSize)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				t.logger.Debug("failed to read rpc request", zap.Error(err))
+			}
+			return
+		}
+
+		response := t.handle(data, handler)
+		if response == nil {
+			return
+		}
+		if _, err = conn.Write(replication.EncodeFrame(response)); err != nil {
+			t.logger.Debug("failed to send rpc response", zap.Error(err))
+			return
+		}
+	}
+}
+
+// handle возвращает nil, если запрос не разобран
+func (t *TCPTransport) handle(data []byte, handler Handler) []byte {
+	var req rpcRequest
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&req); err != nil {
+		t.logger.Error("failed to decode rpc request", zap.Error(err))
+		return nil
+	}
+
+	var resp rpcResponse
+	switch {
+	case req.Vote != nil:
+		resp.Vote = handler.HandleRequestVote(req.Vote)
+	case req.Append != nil:
+		resp.Append = handler.HandleAppendEntries(req.Append)
+	default:
+		t.logger.Error("empty rpc request")
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&resp); err != nil {
+		t.logger.Error("failed to encode rpc response", zap.Error(err))
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func (t *TCPTransport) RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	resp, err := t.call(ctx, peer, &rpcRequest{Vote: req})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Vote == nil {
+		return nil, errors.New("empty vote response")
+	}
+	return resp.Vote, nil
+}
+
+func (t *TCPTransport) AppendEntries(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error) {
+	resp, err := t.call(ctx, peer, &rpcRequest{Append: req})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Append == nil {
+		return nil, errors.New("empty append response")
+	}
+	return resp.Append, nil
+}
+
+func (t *TCPTransport) call(ctx context.Context, peer string, req *rpcRequest) (*rpcResponse, error) {
+	pc, ok := t.conns[peer]
+	if !ok {
+		return nil, fmt.Errorf("unknown peer %s", peer)
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.conn == nil {
+		conn, err := net.DialTimeout("tcp", t.peers[peer], dialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnreachable, err)
+		}
+		pc.conn = conn
+	}
+
+	resp, err := t.roundTrip(ctx, pc.conn, req)
+	if err != nil {
+		_ = pc.conn.Close()
+		pc.conn = nil
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *TCPTransport) roundTrip(ctx context.Context, conn net.Conn, req *rpcRequest) (*rpcResponse, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to encode rpc request: %w", err)
+	}
+	if _, err := conn.Write(replication.EncodeFrame(buf.Bytes())); err != nil {
+		return nil, fmt.Errorf("failed to send rpc request: %w", err)
+	}
+
+	data, err := replication.ReadFrame(conn, maxFrameSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpc response: %w", err)
+	}
+
+	var resp rpcResponse
+	if err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode rpc response: %w", err)
+	}
+	return &resp, nil
+}
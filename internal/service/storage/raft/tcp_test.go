@@ -0,0 +1,126 @@
+package raft
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage/engine"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPTransport(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addresses := map[string]string{
+		"node1": ":4101",
+		"node2": ":4102",
+		"node3": ":4103",
+	}
+
+	tables := make(map[string]*engine.MemoryTable, len(addresses))
+	nodes := make(map[string]*Node, len(addresses))
+	for id, address := range addresses {
+		peers := make(map[string]string)
+		var peerIDs []string
+		for peerID, peerAddress := range addresses {
+			if peerID != id {
+				peers[peerID] = peerAddress
+				peerIDs = append(peerIDs, peerID)
+			}
+		}
+
+		tables[id] = engine.NewMemoryTable()
+		var err error
+		nodes[id], err = NewNode(Config{
+			ID:                id,
+			Peers:             peerIDs,
+			ElectionTimeout:   100 * time.Millisecond,
+			HeartbeatInterval: 20 * time.Millisecond,
+		}, NewTCPTransport(address, peers, zap.NewNop()), NewWALStore(t.TempDir(), 1024, zap.NewNop()), tables[id], zap.NewNop())
+		require.NoError(t, err)
+
+		go func(node *Node) {
+			_ = node.Start(ctx)
+		}(nodes[id])
+	}
+
+	var leader *Node
+	require.Eventually(t, func() bool {
+		for _, node := range nodes {
+			if node.IsMaster() {
+				leader = node
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	lsn, err := leader.Propose(ctx, wal.NewUnit(compute.SetCommand, []string{"key", "value"}))
+	require.NoError(t, err)
+	require.Greater(t, lsn, uint64(0))
+
+	for _, table := range tables {
+		require.Eventually(t, func() bool {
+			value, ok := table.Get("key")
+			return ok && value == "value"
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
+
+type appendRecorder struct {
+	requests chan *AppendRequest
+}
+
+func (r *appendRecorder) HandleRequestVote(req *VoteRequest) *VoteResponse {
+	return &VoteResponse{Term: req.Term}
+}
+
+func (r *appendRecorder) HandleAppendEntries(req *AppendRequest) *AppendResponse {
+	r.requests <- req
+	return &AppendResponse{Term: req.Term, Success: true}
+}
+
+func TestTCPTransport_LargeBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recorder := &appendRecorder{requests: make(chan *AppendRequest, 2)}
+	follower := NewTCPTransport(":4104", nil, zap.NewNop())
+	listened := make(chan error, 1)
+	go func() {
+		listened <- follower.Listen(ctx, recorder)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// пачка больше одного чтения из сокета
+	entries := make([]*wal.Unit, 0, maxAppendEntries)
+	for i := 1; i <= maxAppendEntries; i++ {
+		entries = append(entries, &wal.Unit{
+			Command:   string(compute.SetCommand),
+			Arguments: []string{strconv.Itoa(i), strings.Repeat("x", 2<<10)},
+			LSN:       uint64(i),
+		})
+	}
+	req := &AppendRequest{Term: 1, LeaderID: "leader", Entries: entries}
+
+	leader := NewTCPTransport(":0", map[string]string{"follower": ":4104"}, zap.NewNop())
+	for i := 0; i < 2; i++ {
+		resp, err := leader.AppendEntries(ctx, "follower", req)
+		require.NoError(t, err)
+		require.Equal(t, &AppendResponse{Term: 1, Success: true}, resp)
+		require.Equal(t, req, <-recorder.requests)
+	}
+
+	cancel()
+	require.NoError(t, <-listened)
+}
@@ -0,0 +1,49 @@
+package raft
+
+import (
+	"antdb/internal/service/storage/wal"
+	"context"
+	"errors"
+)
+
+var ErrUnreachable = errors.New("peer is unreachable")
+
+type VoteRequest struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type VoteResponse struct {
+	Term    uint64
+	Granted bool
+}
+
+type AppendRequest struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []*wal.Unit
+	LeaderCommit uint64
+}
+
+type AppendResponse struct {
+	Term    uint64
+	Success bool
+	// ConflictIndex - с какого индекса лидеру стоит повторить отправку
+	ConflictIndex uint64
+}
+
+// Handler обрабатывает входящие RPC от других узлов
+type Handler interface {
+	HandleRequestVote(*VoteRequest) *VoteResponse
+	HandleAppendEntries(*AppendRequest) *AppendResponse
+}
+
+type Transport interface {
+	Listen(ctx context.Context, handler Handler) error
+	RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error)
+	AppendEntries(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error)
+}
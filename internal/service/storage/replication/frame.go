@@ -0,0 +1,37 @@
+package replication
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Ответ мастера может не поместиться в одно чтение (TLS делит данные на записи
+// по 16KB), поэтому перед ним передается его длина. Так же передаются RPC raft
+const frameHeaderSize = 4
+
+func EncodeFrame(data []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[frameHeaderSize:], data)
+	return frame
+}
+
+// ReadFrame читает сообщение, записанное EncodeFrame, не длиннее maxSize
+func ReadFrame(reader io.Reader, maxSize int) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	size := int(binary.BigEndian.Uint32(header))
+	if size > maxSize {
+		return nil, fmt.Errorf("frame is too large: %d bytes", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
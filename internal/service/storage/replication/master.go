@@ -1,30 +1,92 @@
 package replication
 
 import (
+	"antdb/internal/network"
 	"antdb/internal/service/storage/wal"
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/gob"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/wrapperspb"
-	"os"
-	"path"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// maxBatchUnits ограничивает размер ответа реплике
+const maxBatchUnits = 256
+
+var ErrNotEnoughReplicas = errors.New("not enough replicas acknowledged write")
+
 type Server interface {
 	Start(context.Context, func(context.Context, []byte) []byte) error
 }
 
+// connectionRejecter - сервер, который сам отклоняет соединения (например, без
+// подходящего клиентского сертификата)
+type connectionRejecter interface {
+	RejectedConnections() uint64
+}
+
+// Journal сообщает мастеру о новых записях на диске
+type Journal interface {
+	Notify() <-chan struct{}
+}
+
+// Upstream - источник журнала промежуточного узла каскада
+type Upstream interface {
+	Reporter
+	// Chain возвращает узлы от исходного мастера до источника
+	Chain() []string
+}
+
 type Master struct {
-	Server    Server
-	directory string
-	logger    *zap.Logger
+	Server      Server
+	id          string
+	directory   string
+	journal     Journal
+	minReplicas int
+	ackTimeout  time.Duration
+	authToken   string
+	rejected    atomic.Uint64
+	upstream    Upstream
+
+	mu        sync.Mutex
+	replicas  map[string]*ReplicaStatus
+	ackNotify chan struct{}
+	snapshots map[string][]*wal.Unit
+
+	logger *zap.Logger
 }
 
-func NewMaster(server Server, directory string, logger *zap.Logger) *Master {
+func NewMaster(
+	server Server,
+	id string,
+	directory string,
+	journal Journal,
+	minReplicas int,
+	ackTimeout time.Duration,
+	authToken string,
+	logger *zap.Logger,
+) *Master {
 	return &Master{
-		Server:    server,
-		directory: directory,
-		logger:    logger,
+		Server:      server,
+		id:          id,
+		directory:   directory,
+		journal:     journal,
+		minReplicas: minReplicas,
+		ackTimeout:  ackTimeout,
+		authToken:   authToken,
+		replicas:    make(map[string]*ReplicaStatus),
+		ackNotify:   make(chan struct{}),
+		snapshots:   make(map[string][]*wal.Unit),
+		logger:      logger,
 	}
 }
 
@@ -36,51 +98,310 @@ func (m *Master) Start(ctx context.Context) error {
 			return nil
 		}
 
-		m.logger.Debug("request", zap.String("name", segmentReq.GetLastName().GetValue()))
+		m.logger.Debug("request",
+			zap.String("replica", segmentReq.GetReplicaId()),
+			zap.Uint64("lsn", segmentReq.GetLastLsn()))
 
-		response := m.findLastSegment(segmentReq)
-		data, err := proto.Marshal(response)
-		if err != nil {
-			m.logger.Error("failed to marshal response", zap.Error(err))
-			return nil
+		if !m.authenticate(segmentReq.GetAuthToken()) {
+			m.rejected.Add(1)
+			m.logger.Warn("replica rejected: invalid auth token",
+				zap.String("replica", segmentReq.GetReplicaId()),
+				zap.String("address", network.ClientAddr(ctx)))
+			return m.encode(&SegmentResponse{Error: "unauthorized"})
+		}
+
+		if chain := m.chain(); slices.Contains(chain, segmentReq.GetReplicaId()) {
+			m.logger.Warn("replica rejected: replication loop",
+				zap.String("replica", segmentReq.GetReplicaId()),
+				zap.Strings("chain", chain))
+			return m.encode(&SegmentResponse{Error: "replication loop", Chain: chain})
 		}
 
-		return data
+		m.touch(segmentReq.GetReplicaId(), network.ClientAddr(ctx))
+
+		var response *SegmentResponse
+		if segmentReq.GetSnapshotOffset() > 0 || m.needsFullSync(segmentReq.GetLastLsn()) {
+			response = m.findSnapshot(segmentReq)
+		} else {
+			m.acknowledge(segmentReq.GetReplicaId(), segmentReq.GetLastLsn())
+			response = m.findUnits(ctx, segmentReq)
+		}
+
+		return m.encode(response)
 	})
 }
 
+func (m *Master) encode(response *SegmentResponse) []byte {
+	data, err := proto.Marshal(response)
+	if err != nil {
+		m.logger.Error("failed to marshal response", zap.Error(err))
+		return nil
+	}
+
+	return EncodeFrame(data)
+}
+
 func (m *Master) IsMaster() bool {
 	return true
 }
 
-func (m *Master) findLastSegment(req *SegmentRequest) *SegmentResponse {
-	segment, err := wal.GetNextSegment(m.directory, req.GetLastName().GetValue())
-	if err != nil {
-		m.logger.Error("failed to get next segments", zap.Error(err))
-		return &SegmentResponse{
-			Name: &wrapperspb.StringValue{Value: segment},
+// WaitForReplicas ждет, пока replicas реплик подтвердят запись с LSN lsn
+func (m *Master) WaitForReplicas(ctx context.Context, lsn uint64, replicas int, timeout time.Duration) error {
+	if replicas <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		m.mu.Lock()
+		acked := 0
+		for _, replica := range m.replicas {
+			if replica.AckLSN >= lsn {
+				acked++
+			}
 		}
+		notify := m.ackNotify
+		m.mu.Unlock()
+
+		if acked >= replicas {
+			return nil
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return fmt.Errorf("%w: %d of %d", ErrNotEnoughReplicas, acked, replicas)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WaitForDefaultReplicas ждет подтверждения от min_replicas_to_ack реплик
+func (m *Master) WaitForDefaultReplicas(ctx context.Context, lsn uint64) error {
+	return m.WaitForReplicas(ctx, lsn, m.minReplicas, m.ackTimeout)
+}
+
+// Status возвращает позицию журнала мастера и состояние известных реплик
+func (m *Master) Status() Status {
+	lsn, err := wal.GetLastLSN(m.directory)
+	if err != nil {
+		m.logger.Error("failed to get last lsn", zap.Error(err))
 	}
 
-	if segment == req.GetLastName().GetValue() {
-		return &SegmentResponse{
-			Name: &wrapperspb.StringValue{Value: segment},
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	replicas := make([]ReplicaStatus, 0, len(m.replicas))
+	for _, replica := range m.replicas {
+		replicas = append(replicas, *replica)
+	}
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].ID < replicas[j].ID
+	})
+
+	rejected := m.rejected.Load()
+	if server, ok := m.Server.(connectionRejecter); ok {
+		rejected += server.RejectedConnections()
+	}
+
+	return Status{
+		Role:             RoleMaster,
+		LSN:              lsn,
+		Replicas:         replicas,
+		RejectedReplicas: rejected,
+	}
+}
+
+func (m *Master) authenticate(token string) bool {
+	if m.authToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(m.authToken)) == 1
+}
+
+func (m *Master) touch(replicaID, address string) {
+	if replicaID == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	replica, ok := m.replicas[replicaID]
+	if !ok {
+		replica = &ReplicaStatus{ID: replicaID}
+		m.replicas[replicaID] = replica
+	}
+	replica.Address = address
+	replica.LastContact = time.Now()
+}
+
+func (m *Master) acknowledge(replicaID string, lsn uint64) {
+	if replicaID == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	replica, ok := m.replicas[replicaID]
+	if !ok || lsn <= replica.AckLSN {
+		return
+	}
+
+	replica.AckLSN = lsn
+	close(m.ackNotify)
+	m.ackNotify = make(chan struct{})
+}
+
+func (m *Master) findUnits(ctx context.Context, req *SegmentRequest) *SegmentResponse {
+	// канал берем до чтения, чтобы не пропустить запись между чтением и ожиданием
+	notify := m.journal.Notify()
+
+	units, err := wal.ReadUnitsAfter(m.directory, req.GetLastLsn(), maxBatchUnits)
+	if err != nil {
+		m.logger.Error("failed to read units", zap.Error(err))
+		return m.emptyResponse(req)
+	}
+
+	if len(units) == 0 && req.GetWait() > 0 {
+		timer := time.NewTimer(time.Duration(req.GetWait()) * time.Millisecond)
+		select {
+		case <-notify:
+			units, err = wal.ReadUnitsAfter(m.directory, req.GetLastLsn(), maxBatchUnits)
+			if err != nil {
+				m.logger.Error("failed to read units", zap.Error(err))
+			}
+		case <-timer.C:
+		case <-ctx.Done():
 		}
+		timer.Stop()
 	}
 
-	var data []byte
-	if segment != "" {
-		data, err = os.ReadFile(path.Join(m.directory, segment))
+	if len(units) == 0 {
+		return m.emptyResponse(req)
+	}
+
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(&units); err != nil {
+		m.logger.Error("failed to encode units", zap.Error(err))
+		return m.emptyResponse(req)
+	}
+
+	response := m.emptyResponse(req)
+	response.Data = buf.Bytes()
+	response.LastLsn = units[len(units)-1].LSN
+	return response
+}
+
+// needsFullSync проверяет, может ли реплика догнать мастер по журналу
+func (m *Master) needsFullSync(lsn uint64) bool {
+	historyStart, err := wal.GetHistoryStart(m.directory)
+	if err != nil {
+		m.logger.Error("failed to get history start", zap.Error(err))
+		return false
+	}
+
+	lastLSN, err := wal.GetLastLSN(m.directory)
+	if err != nil {
+		m.logger.Error("failed to get last lsn", zap.Error(err))
+		return false
+	}
+
+	// промежуточный узел сам может отставать от исходного мастера: реплика,
+	// которая его опередила, ждет, пока он догонит
+	if m.upstream != nil && lsn > lastLSN {
+		return false
+	}
+
+	// реплика отстала дальше начала журнала или разошлась с мастером
+	return lsn < historyStart || lsn > lastLSN
+}
+
+// chain возвращает узлы от исходного мастера до текущего
+func (m *Master) chain() []string {
+	if m.upstream == nil {
+		return []string{m.id}
+	}
+	return append(m.upstream.Chain(), m.id)
+}
+
+func (m *Master) findSnapshot(req *SegmentRequest) *SegmentResponse {
+	replicaID := req.GetReplicaId()
+	offset := req.GetSnapshotOffset()
+
+	m.mu.Lock()
+	units, ok := m.snapshots[replicaID]
+	m.mu.Unlock()
+
+	if !ok || offset == 0 || offset > uint64(len(units)) {
+		var err error
+		units, err = wal.ReadSnapshot(m.directory)
 		if err != nil {
-			m.logger.Error("failed to read segment", zap.Error(err))
-			return &SegmentResponse{
-				Name: &wrapperspb.StringValue{Value: segment},
-			}
+			m.logger.Error("failed to read snapshot", zap.Error(err))
+			return m.emptyResponse(req)
+		}
+		offset = 0
+
+		m.logger.Info("start full sync",
+			zap.String("replica", replicaID),
+			zap.Uint64("lsn", units[0].LSN),
+			zap.Int("keys", len(units)-1))
+	}
+
+	end := min(offset+maxBatchUnits, uint64(len(units)))
+	chunk := units[offset:end]
+	done := end == uint64(len(units))
+
+	m.mu.Lock()
+	if done {
+		delete(m.snapshots, replicaID)
+	} else {
+		m.snapshots[replicaID] = units
+	}
+	m.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&chunk); err != nil {
+		m.logger.Error("failed to encode snapshot", zap.Error(err))
+		return m.emptyResponse(req)
+	}
+
+	response := m.emptyResponse(req)
+	response.Data = buf.Bytes()
+	response.LastLsn = units[0].LSN
+	response.Snapshot = true
+	response.SnapshotOffset = offset
+	response.SnapshotDone = done
+	return response
+}
+
+// emptyResponse всегда заполняет name, чтобы ответ не был пустым сообщением
+func (m *Master) emptyResponse(req *SegmentRequest) *SegmentResponse {
+	segment, err := wal.GetLastSegment(m.directory)
+	if err != nil {
+		m.logger.Error("failed to get last segment", zap.Error(err))
+	}
+
+	lastLSN, err := wal.GetLastLSN(m.directory)
+	if err != nil {
+		m.logger.Error("failed to get last lsn", zap.Error(err))
+	}
+
+	// отставание считается от исходного мастера, а не от промежуточного узла
+	if m.upstream != nil {
+		if link := m.upstream.Status().Link; link != nil {
+			lastLSN = max(lastLSN, link.MasterLSN)
 		}
 	}
 
 	return &SegmentResponse{
-		Name: &wrapperspb.StringValue{Value: segment},
-		Data: data,
+		Name:      &wrapperspb.StringValue{Value: segment},
+		LastLsn:   req.GetLastLsn(),
+		MasterLsn: lastLSN,
+		Chain:     m.chain(),
 	}
 }
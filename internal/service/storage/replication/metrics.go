@@ -0,0 +1,86 @@
+package replication
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+var (
+	roleDesc = prometheus.NewDesc("antdb_replication_role",
+		"Replication role of the node, always 1.", []string{"role"}, nil)
+	lsnDesc = prometheus.NewDesc("antdb_replication_lsn",
+		"LSN of the last applied record.", nil, nil)
+	linkUpDesc = prometheus.NewDesc("antdb_replication_master_link_up",
+		"Whether the replica is connected to its master.", nil, nil)
+	lagRecordsDesc = prometheus.NewDesc("antdb_replication_lag_records",
+		"Number of records the replica is behind its master.", nil, nil)
+	lagSecondsDesc = prometheus.NewDesc("antdb_replication_lag_seconds",
+		"Age of the oldest record the replica has not applied yet.", nil, nil)
+	connectedReplicasDesc = prometheus.NewDesc("antdb_replication_connected_replicas",
+		"Number of replicas known to the master.", nil, nil)
+	rejectedReplicasDesc = prometheus.NewDesc("antdb_replication_rejected_replicas_total",
+		"Replica requests rejected by the master.", nil, nil)
+	replicaLagDesc = prometheus.NewDesc("antdb_replication_replica_lag_records",
+		"Number of records a replica has not acknowledged yet.", []string{"replica"}, nil)
+	replicaContactDesc = prometheus.NewDesc("antdb_replication_replica_last_contact_seconds",
+		"Seconds since the last request of a replica.", []string{"replica"}, nil)
+)
+
+// Collector при каждом сборе метрик берет состояние репликации из Status
+type Collector struct {
+	reporter Reporter
+}
+
+func NewCollector(reporter Reporter) *Collector {
+	return &Collector{
+		reporter: reporter,
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- roleDesc
+	ch <- lsnDesc
+	ch <- linkUpDesc
+	ch <- lagRecordsDesc
+	ch <- lagSecondsDesc
+	ch <- connectedReplicasDesc
+	ch <- rejectedReplicasDesc
+	ch <- replicaLagDesc
+	ch <- replicaContactDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	status := c.reporter.Status()
+
+	ch <- prometheus.MustNewConstMetric(roleDesc, prometheus.GaugeValue, 1, status.Role)
+	ch <- prometheus.MustNewConstMetric(lsnDesc, prometheus.GaugeValue, float64(status.LSN))
+
+	if link := status.Link; link != nil {
+		var up float64
+		if link.Up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(linkUpDesc, prometheus.GaugeValue, up)
+		ch <- prometheus.MustNewConstMetric(lagRecordsDesc, prometheus.GaugeValue, float64(link.LagRecords))
+		ch <- prometheus.MustNewConstMetric(lagSecondsDesc, prometheus.GaugeValue, link.LagSeconds)
+	}
+
+	// список реплик есть у мастера и у промежуточного узла каскада
+	if status.Role != RoleMaster && status.Replicas == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(connectedReplicasDesc, prometheus.GaugeValue, float64(len(status.Replicas)))
+	ch <- prometheus.MustNewConstMetric(rejectedReplicasDesc, prometheus.CounterValue, float64(status.RejectedReplicas))
+	for _, replica := range status.Replicas {
+		var lag uint64
+		if status.LSN > replica.AckLSN {
+			lag = status.LSN - replica.AckLSN
+		}
+		ch <- prometheus.MustNewConstMetric(replicaLagDesc, prometheus.GaugeValue, float64(lag), replica.ID)
+		if !replica.LastContact.IsZero() {
+			ch <- prometheus.MustNewConstMetric(replicaContactDesc, prometheus.GaugeValue,
+				time.Since(replica.LastContact).Seconds(), replica.ID)
+		}
+	}
+}
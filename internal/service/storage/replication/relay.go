@@ -0,0 +1,52 @@
+package replication
+
+import "context"
+
+// Relay - промежуточный узел каскада: получает журнал от мастера как реплика
+// и раздает сохраненные записи своим репликам. LSN записей не меняются,
+// поэтому позиции реплик совпадают по всей цепочке
+type Relay struct {
+	slave  *Slave
+	master *Master
+}
+
+// NewRelay связывает реплику и сервер, который раздает ее журнал. Сервер
+// должен читать каталог журнала реплики
+func NewRelay(slave *Slave, master *Master) *Relay {
+	master.upstream = slave
+
+	return &Relay{
+		slave:  slave,
+		master: master,
+	}
+}
+
+func (r *Relay) Start(ctx context.Context) error {
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- r.master.Start(ctx)
+	}()
+	go func() {
+		errCh <- r.slave.Start(ctx)
+	}()
+
+	// при ошибке запуска выходим сразу, при остановке ждем обе части
+	if err := <-errCh; err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+func (r *Relay) IsMaster() bool {
+	return false
+}
+
+// Status возвращает состояние связи с мастером и реплик, получающих журнал от узла
+func (r *Relay) Status() Status {
+	status := r.slave.Status()
+	masterStatus := r.master.Status()
+	status.Replicas = masterStatus.Replicas
+	status.RejectedReplicas = masterStatus.RejectedReplicas
+
+	return status
+}
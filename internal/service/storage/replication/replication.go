@@ -1,8 +1,40 @@
 package replication
 
-import "context"
+import (
+	"antdb/internal/service/storage/wal"
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotApplied = errors.New("lsn is not applied yet")
 
 type Replication interface {
 	Start(context.Context) error
 	IsMaster() bool
 }
+
+// Consensus - репликация, при которой запись подтверждается кворумом узлов
+// до того, как будет применена
+type Consensus interface {
+	Propose(context.Context, *wal.Unit) (uint64, error)
+}
+
+// Acknowledger - репликация, в которой мастер может дождаться подтверждения
+// записи репликами
+type Acknowledger interface {
+	WaitForReplicas(ctx context.Context, lsn uint64, replicas int, timeout time.Duration) error
+	WaitForDefaultReplicas(ctx context.Context, lsn uint64) error
+}
+
+// Applier - репликация, которая сама применяет записи к движку и может
+// дождаться применения записи с заданным LSN
+type Applier interface {
+	WaitForApplied(ctx context.Context, lsn uint64, timeout time.Duration) error
+}
+
+// Observable - репликация, которая применяет записи к движку в обход
+// хранилища и сообщает о каждой примененной записи
+type Observable interface {
+	Observe(func(*wal.Unit))
+}
@@ -0,0 +1,315 @@
+package replication
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/network/tlstest"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func startMaster(
+	t *testing.T,
+	ctx context.Context,
+	address string,
+	minReplicas int,
+	authToken string,
+	options ...network.ServerOption,
+) (*Master, *wal.Writer) {
+	t.Helper()
+
+	masterDir := t.TempDir()
+	writer := wal.NewWriter(masterDir, 1024, zap.NewNop())
+	server, err := network.NewServer(address, 5, 10<<20, zap.NewNop(), options...)
+	require.NoError(t, err)
+
+	master := NewMaster(server, "master", masterDir, writer, minReplicas, 500*time.Millisecond, authToken, zap.NewNop())
+	go func() {
+		_ = master.Start(ctx)
+	}()
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+	return master, writer
+}
+
+func TestReplication_SemiSync(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	master, writer := startMaster(t, ctx, ":3311", 1, "")
+
+	// без реплик запись не подтверждается
+	require.NoError(t, writer.Write([]*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}))
+	err := master.WaitForDefaultReplicas(ctx, 1)
+	require.True(t, errors.Is(err, ErrNotEnoughReplicas))
+
+	slaveDir := t.TempDir()
+	stream := make(chan []*wal.Unit, 10)
+	slave, err := NewSlave(":3311", 100*time.Millisecond, slaveDir, 1024, "replica1", "", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = slave.Start(ctx)
+	}()
+
+	require.Equal(t, []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}, <-stream)
+	require.NoError(t, master.WaitForDefaultReplicas(ctx, 1))
+
+	require.NoError(t, writer.Write([]*wal.Unit{{Command: "DEL", Arguments: []string{"a"}, LSN: 2}}))
+	require.NoError(t, master.WaitForReplicas(ctx, 2, 1, time.Second))
+	require.Equal(t, []*wal.Unit{{Command: "DEL", Arguments: []string{"a"}, LSN: 2}}, <-stream)
+
+	// реплика сохранила записи в свой журнал
+	lsn, err := wal.GetLastLSN(slaveDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lsn)
+
+	err = master.WaitForReplicas(ctx, 2, 2, 100*time.Millisecond)
+	require.True(t, errors.Is(err, ErrNotEnoughReplicas))
+
+	masterStatus := master.Status()
+	require.Equal(t, RoleMaster, masterStatus.Role)
+	require.Equal(t, uint64(2), masterStatus.LSN)
+	require.Len(t, masterStatus.Replicas, 1)
+	require.Equal(t, "replica1", masterStatus.Replicas[0].ID)
+	require.Equal(t, uint64(2), masterStatus.Replicas[0].AckLSN)
+	require.NotEmpty(t, masterStatus.Replicas[0].Address)
+	require.False(t, masterStatus.Replicas[0].LastContact.IsZero())
+
+	slaveStatus := slave.Status()
+	require.Equal(t, RoleSlave, slaveStatus.Role)
+	require.Equal(t, uint64(2), slaveStatus.LSN)
+	require.True(t, slaveStatus.Link.Up)
+	require.Equal(t, ":3311", slaveStatus.Link.MasterAddress)
+	require.Equal(t, uint64(0), slaveStatus.Link.LagRecords)
+}
+
+func TestReplication_FullSync(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, writer := startMaster(t, ctx, ":3312", 0, "")
+
+	// история до LSN 10 свернута компакцией
+	require.NoError(t, writer.Write([]*wal.Unit{
+		{Command: wal.CheckpointCommand, LSN: 10},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 7},
+		{Command: "SET", Arguments: []string{"c", "3"}, LSN: 10},
+	}))
+	require.NoError(t, writer.Write([]*wal.Unit{
+		{Command: "SET", Arguments: []string{"d", "4"}, LSN: 11},
+	}))
+
+	// у реплики старые данные, удаленные на мастере
+	slaveDir := t.TempDir()
+	require.NoError(t, wal.NewWriter(slaveDir, 1024, zap.NewNop()).Write([]*wal.Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+	}))
+
+	stream := make(chan []*wal.Unit, 10)
+	slave, err := NewSlave(":3312", 100*time.Millisecond, slaveDir, 1024, "replica1", "", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = slave.Start(ctx)
+	}()
+
+	require.Equal(t, []*wal.Unit{
+		{Command: wal.CheckpointCommand, LSN: 11},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 7},
+		{Command: "SET", Arguments: []string{"c", "3"}, LSN: 10},
+		{Command: "SET", Arguments: []string{"d", "4"}, LSN: 11},
+	}, <-stream)
+
+	snapshot, err := wal.ReadSnapshot(slaveDir)
+	require.NoError(t, err)
+	require.Len(t, snapshot, 4)
+	require.Equal(t, uint64(11), snapshot[0].LSN)
+
+	// после снимка репликация продолжается по журналу
+	require.NoError(t, writer.Write([]*wal.Unit{
+		{Command: "DEL", Arguments: []string{"b"}, LSN: 12},
+	}))
+	require.Equal(t, []*wal.Unit{{Command: "DEL", Arguments: []string{"b"}, LSN: 12}}, <-stream)
+}
+
+func TestReplication_AuthToken(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	master, writer := startMaster(t, ctx, ":3313", 0, "secret")
+	require.NoError(t, writer.Write([]*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}))
+
+	stream := make(chan []*wal.Unit, 10)
+	intruder, err := NewSlave(":3313", 100*time.Millisecond, t.TempDir(), 1024, "intruder", "wrong", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = intruder.Start(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return master.Status().RejectedReplicas > 0
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, stream)
+	require.Empty(t, master.Status().Replicas)
+	require.False(t, intruder.Status().Link.Up)
+
+	slave, err := NewSlave(":3313", 100*time.Millisecond, t.TempDir(), 1024, "replica1", "secret", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = slave.Start(ctx)
+	}()
+
+	require.Equal(t, []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}, <-stream)
+}
+
+func TestReplication_MutualTLS(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	certs := tlstest.Generate(t)
+	serverTLS, err := network.NewServerTLSConfig(certs.ServerCertFile, certs.ServerKeyFile, certs.CAFile)
+	require.NoError(t, err)
+
+	master, writer := startMaster(t, ctx, ":3314", 0, "", network.WithTLS(serverTLS))
+	require.NoError(t, writer.Write([]*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}))
+
+	// сертификат, выпущенный чужим CA
+	other := tlstest.Generate(t)
+	untrustedTLS, err := network.NewClientTLSConfig(other.ClientCertFile, other.ClientKeyFile, certs.CAFile, "localhost")
+	require.NoError(t, err)
+
+	stream := make(chan []*wal.Unit, 10)
+	intruder, err := NewSlave("localhost:3314", 100*time.Millisecond, t.TempDir(), 1024, "intruder", "", untrustedTLS, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = intruder.Start(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return master.Status().RejectedReplicas > 0
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, stream)
+
+	clientTLS, err := network.NewClientTLSConfig(certs.ClientCertFile, certs.ClientKeyFile, certs.CAFile, "localhost")
+	require.NoError(t, err)
+	slave, err := NewSlave("localhost:3314", 100*time.Millisecond, t.TempDir(), 1024, "replica1", "", clientTLS, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = slave.Start(ctx)
+	}()
+
+	require.Equal(t, []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}, <-stream)
+}
+
+func startRelay(t *testing.T, ctx context.Context, id, upstream, address string) (*Relay, chan []*wal.Unit) {
+	t.Helper()
+
+	dir := t.TempDir()
+	stream := make(chan []*wal.Unit, 10)
+	slave, err := NewSlave(upstream, 100*time.Millisecond, dir, 1024, id, "", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+
+	server, err := network.NewServer(address, 5, 10<<20, zap.NewNop())
+	require.NoError(t, err)
+	master := NewMaster(server, id, dir, slave.Journal(), 0, 500*time.Millisecond, "", zap.NewNop())
+
+	relay := NewRelay(slave, master)
+	go func() {
+		_ = relay.Start(ctx)
+	}()
+	return relay, stream
+}
+
+func TestReplication_Cascade(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, writer := startMaster(t, ctx, ":3315", 0, "")
+	relay, relayStream := startRelay(t, ctx, "relay", ":3315", ":3316")
+
+	// Ждем, пока сервер стартует
+	time.Sleep(100 * time.Millisecond)
+
+	stream := make(chan []*wal.Unit, 10)
+	slave, err := NewSlave(":3316", 100*time.Millisecond, t.TempDir(), 1024, "replica1", "", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = slave.Start(ctx)
+	}()
+
+	require.NoError(t, writer.Write([]*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}))
+	require.Equal(t, []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}, <-relayStream)
+	require.Equal(t, []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}, <-stream)
+
+	require.Eventually(t, func() bool {
+		status := relay.Status()
+		return len(status.Replicas) == 1 && status.Replicas[0].AckLSN == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, []string{"master", "relay"}, slave.Chain())
+	slaveStatus := slave.Status()
+	require.Equal(t, uint64(1), slaveStatus.LSN)
+	require.Equal(t, uint64(1), slaveStatus.Link.MasterLSN)
+}
+
+func TestReplication_Loop(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// каждый узел указывает другой как источник журнала
+	first, firstStream := startRelay(t, ctx, "first", ":3318", ":3317")
+	second, secondStream := startRelay(t, ctx, "second", ":3317", ":3318")
+
+	require.Eventually(t, func() bool {
+		return !first.Status().Link.Up && !second.Status().Link.Up
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Empty(t, firstStream)
+	require.Empty(t, secondStream)
+}
+
+func TestReplication_LongPoll(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	master, writer := startMaster(t, ctx, ":3319", 0, "")
+
+	// мастер держит запрос реплики до 5 секунд, но отвечает сразу после записи
+	stream := make(chan []*wal.Unit, 10)
+	slave, err := NewSlave(":3319", 5*time.Second, t.TempDir(), 1024, "replica1", "", nil, stream, zap.NewNop())
+	require.NoError(t, err)
+	go func() {
+		_ = slave.Start(ctx)
+	}()
+
+	// реплика пришла к мастеру, и он держит ее запрос
+	require.Eventually(t, func() bool {
+		return len(master.Status().Replicas) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, writer.Write([]*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}))
+	select {
+	case units := <-stream:
+		require.Equal(t, []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1}}, units)
+	case <-time.After(time.Second):
+		t.Fatal("replica didn't receive write before sync interval")
+	}
+}
@@ -4,64 +4,99 @@ import (
 	"antdb/internal/service/storage/wal"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/known/wrapperspb"
 	"net"
 	"os"
 	"path"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+// maxResponseSize ограничивает размер ответа мастера
+const maxResponseSize = 10 << 20
+
 type Slave struct {
-	connection      net.Conn
-	syncInterval    time.Duration
-	walDirectory    string
-	lastSegmentName string
-	stream          chan<- []*wal.Unit
-	log             *zap.Logger
+	address      string
+	connection   net.Conn
+	authToken    string
+	tlsConfig    *tls.Config
+	syncInterval time.Duration
+	replicaID    string
+	walDirectory string
+	writer       *wal.Writer
+	lastLSN      uint64
+	snapshot     []*wal.Unit
+	stream       chan<- []*wal.Unit
+
+	mu         sync.Mutex
+	link       LinkStatus
+	caughtUpAt time.Time
+	chain      []string
+	stopped    bool
+
+	log *zap.Logger
 }
 
 func NewSlave(
 	address string,
 	syncInterval time.Duration,
 	walDirectory string,
+	maxSegmentSize int,
+	replicaID string,
+	authToken string,
+	tlsConfig *tls.Config,
 	stream chan<- []*wal.Unit,
 	log *zap.Logger,
 ) (*Slave, error) {
-	connection, err := net.Dial("tcp", address)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial: %w", err)
-	}
-
-	lastSegment, err := wal.GetLastSegment(walDirectory)
+	lastLSN, err := wal.GetLastLSN(walDirectory)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last segment: %w", err)
+		return nil, fmt.Errorf("failed to get last lsn: %w", err)
 	}
 
 	return &Slave{
-		connection:      connection,
-		syncInterval:    syncInterval,
-		walDirectory:    walDirectory,
-		lastSegmentName: lastSegment,
-		stream:          stream,
-		log:             log,
+		address:      address,
+		authToken:    authToken,
+		tlsConfig:    tlsConfig,
+		syncInterval: syncInterval,
+		replicaID:    replicaID,
+		walDirectory: walDirectory,
+		writer:       wal.NewWriter(walDirectory, maxSegmentSize, log),
+		lastLSN:      lastLSN,
+		stream:       stream,
+		link:         LinkStatus{MasterAddress: address},
+		caughtUpAt:   time.Now(),
+		log:          log,
 	}, nil
 }
 
 func (s *Slave) Start(ctx context.Context) error {
-	ticker := time.NewTicker(s.syncInterval)
-	defer ticker.Stop()
+	// мастер может держать запрос долго, при остановке прерываем его
+	stop := context.AfterFunc(ctx, s.interrupt)
+	defer stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			s.sync(ctx)
-
 		case <-ctx.Done():
 			return nil
+		default:
+		}
+
+		// мастер держит запрос до появления новых записей, поэтому ждем только после ошибки
+		if err := s.sync(); err != nil {
+			s.log.Error("failed to sync", zap.Error(err))
+
+			select {
+			case <-time.After(s.syncInterval):
+			case <-ctx.Done():
+				return nil
+			}
 		}
 	}
 }
@@ -70,88 +105,249 @@ func (s *Slave) IsMaster() bool {
 	return false
 }
 
-func (s *Slave) sync(ctx context.Context) {
+// Status возвращает позицию реплики и состояние связи с мастером
+func (s *Slave) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link := s.link
+	if link.LagRecords > 0 {
+		link.LagSeconds = time.Since(s.caughtUpAt).Seconds()
+	}
+
+	return Status{
+		Role: RoleSlave,
+		LSN:  s.lastLSN,
+		Link: &link,
+	}
+}
+
+// Chain возвращает узлы от исходного мастера до мастера этой реплики
+func (s *Slave) Chain() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.chain)
+}
+
+// Journal сообщает о записях, сохраненных репликой
+func (s *Slave) Journal() Journal {
+	return s.writer
+}
+
+func (s *Slave) currentLSN() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastLSN
+}
+
+func (s *Slave) setLastLSN(lsn uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastLSN = lsn
+}
+
+func (s *Slave) setChain(chain []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chain = chain
+}
+
+func (s *Slave) updateLink(up bool, masterLSN uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.link.Up = up
+	if !up {
+		return
+	}
+
+	s.link.LastContact = time.Now()
+	s.link.MasterLSN = masterLSN
+	s.link.LagRecords = 0
+	if masterLSN > s.lastLSN {
+		s.link.LagRecords = masterLSN - s.lastLSN
+	}
+	if s.link.LagRecords == 0 {
+		s.caughtUpAt = time.Now()
+	}
+}
+
+func (s *Slave) sync() error {
 	req := &SegmentRequest{
-		LastName: &wrapperspb.StringValue{Value: s.lastSegmentName},
+		LastLsn:   s.currentLSN(),
+		ReplicaId: s.replicaID,
+		Wait:      s.syncInterval.Milliseconds(),
+		AuthToken: s.authToken,
+
+		SnapshotOffset: uint64(len(s.snapshot)),
 	}
 	s.log.Debug("request", zap.Any("request", req))
 	data, err := proto.Marshal(req)
 	if err != nil {
-		s.log.Error("failed to marshal request", zap.Error(err))
-		return
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	resp, err := s.send(data)
 	if err != nil {
-		s.log.Error("failed to send request", zap.Error(err))
-		return
+		s.updateLink(false, 0)
+		return fmt.Errorf("failed to send request: %w", err)
 	}
 
 	segmentResponse := &SegmentResponse{}
 	err = proto.Unmarshal(resp, segmentResponse)
 	if err != nil {
-		s.log.Error("failed to unmarshal response", zap.Error(err))
-		return
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	// цепочку запоминаем и при отказе: узлы ниже по каскаду тоже увидят петлю
+	s.setChain(segmentResponse.GetChain())
+	if segmentResponse.GetError() != "" {
+		s.updateLink(false, 0)
+		return fmt.Errorf("master rejected request: %s", segmentResponse.GetError())
+	}
+	if chain := segmentResponse.GetChain(); slices.Contains(chain, s.replicaID) {
+		s.updateLink(false, 0)
+		return fmt.Errorf("replication loop: %s -> %s", strings.Join(chain, " -> "), s.replicaID)
 	}
 
-	err = s.saveSegment(segmentResponse.GetName().GetValue(), segmentResponse.GetData())
-	if err != nil {
-		s.log.Error("failed to save segment", zap.Error(err))
-		return
+	defer s.updateLink(true, segmentResponse.GetMasterLsn())
+
+	if len(segmentResponse.GetData()) == 0 {
+		return nil
 	}
 
-	err = s.applyDataToEngine(segmentResponse.GetData())
-	if err != nil {
-		s.log.Error("failed to apply data to engine", zap.Error(err))
-		return
+	var units []*wal.Unit
+	decoder := gob.NewDecoder(bytes.NewBuffer(segmentResponse.GetData()))
+	if err = decoder.Decode(&units); err != nil {
+		return fmt.Errorf("failed to decode data: %w", err)
+	}
+
+	if segmentResponse.GetSnapshot() {
+		return s.loadSnapshot(segmentResponse, units)
 	}
 
-	s.lastSegmentName = segmentResponse.GetName().GetValue()
+	// подтверждаем запись мастеру только после того, как она на диске
+	if err = s.writer.Write(units); err != nil {
+		return fmt.Errorf("failed to save units: %w", err)
+	}
+
+	s.stream <- units
+	s.setLastLSN(segmentResponse.GetLastLsn())
+	return nil
 }
 
 func (s *Slave) send(req []byte) ([]byte, error) {
+	if s.connection == nil {
+		connection, err := dial(s.address, s.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.setConnection(connection); err != nil {
+			return nil, err
+		}
+	}
+
+	// мастер может держать запрос до syncInterval
+	if err := s.connection.SetDeadline(time.Now().Add(2*s.syncInterval + time.Second)); err != nil {
+		return nil, err
+	}
+
 	if _, err := s.connection.Write(req); err != nil {
+		s.reset()
 		return nil, err
 	}
 
-	response := make([]byte, 10<<20)
-	buf, err := s.connection.Read(response)
+	response, err := ReadFrame(s.connection, maxResponseSize)
 	if err != nil {
+		s.reset()
 		return nil, err
 	}
 
-	return response[:buf], nil
+	return response, nil
 }
 
-func (s *Slave) saveSegment(name string, data []byte) error {
-	if name == "" {
-		return nil
+func dial(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig == nil {
+		return net.Dial("tcp", address)
 	}
-	filename := path.Join(s.walDirectory, name)
-	segment, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to create segment: %w", err)
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+}
+
+func (s *Slave) setConnection(connection net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		_ = connection.Close()
+		return errors.New("replication is stopped")
 	}
+	s.connection = connection
+	return nil
+}
+
+func (s *Slave) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, err = segment.Write(data); err != nil {
-		return fmt.Errorf("failed to write segment: %w", err)
+	if err := s.connection.Close(); err != nil && !s.stopped {
+		s.log.Warn("failed to close connection", zap.Error(err))
 	}
+	s.connection = nil
+}
+
+func (s *Slave) interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return segment.Sync()
+	s.stopped = true
+	if s.connection != nil {
+		_ = s.connection.SetDeadline(time.Now())
+	}
 }
 
-func (s *Slave) applyDataToEngine(segmentData []byte) error {
-	if len(segmentData) == 0 {
+func (s *Slave) loadSnapshot(resp *SegmentResponse, units []*wal.Unit) error {
+	if resp.GetSnapshotOffset() == 0 {
+		s.log.Info("start full sync", zap.Uint64("lsn", resp.GetLastLsn()))
+		s.snapshot = nil
+	}
+	if resp.GetSnapshotOffset() != uint64(len(s.snapshot)) {
+		s.snapshot = nil
+		return fmt.Errorf("unexpected snapshot offset %d", resp.GetSnapshotOffset())
+	}
+
+	s.snapshot = append(s.snapshot, units...)
+	if !resp.GetSnapshotDone() {
 		return nil
 	}
 
-	var units []*wal.Unit
-	buffer := bytes.NewBuffer(segmentData)
-	decoder := gob.NewDecoder(buffer)
-	if err := decoder.Decode(&units); err != nil {
-		return fmt.Errorf("failed to decode data: %w", err)
+	snapshot := s.snapshot
+	s.snapshot = nil
+
+	// старые данные больше не нужны: снимок полностью заменяет журнал реплики
+	if err := s.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close segment: %w", err)
+	}
+	segments, err := wal.GetNewerSegmentNames(s.walDirectory, "")
+	if err != nil {
+		return fmt.Errorf("failed to get segments: %w", err)
+	}
+	for _, segment := range segments {
+		if err = os.Remove(path.Join(s.walDirectory, segment)); err != nil {
+			return fmt.Errorf("failed to remove segment [%s]: %w", segment, err)
+		}
 	}
 
-	s.stream <- units
+	if err = s.writer.Write(snapshot); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	s.stream <- snapshot
+	s.setLastLSN(resp.GetLastLsn())
+	s.log.Info("full sync finished", zap.Uint64("lsn", resp.GetLastLsn()), zap.Int("keys", len(snapshot)-1))
 	return nil
 }
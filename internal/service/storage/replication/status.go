@@ -0,0 +1,42 @@
+package replication
+
+import "time"
+
+const (
+	RoleMaster = "master"
+	RoleSlave  = "slave"
+	// RoleCandidate - узел raft во время выборов, лидер ему неизвестен
+	RoleCandidate = "candidate"
+)
+
+// ReplicaStatus - состояние реплики с точки зрения мастера
+type ReplicaStatus struct {
+	ID          string
+	Address     string
+	AckLSN      uint64
+	LastContact time.Time
+}
+
+// LinkStatus - состояние связи реплики с мастером
+type LinkStatus struct {
+	MasterAddress string
+	Up            bool
+	LastContact   time.Time
+	MasterLSN     uint64
+	LagRecords    uint64
+	LagSeconds    float64
+}
+
+type Status struct {
+	Role     string
+	LSN      uint64
+	Replicas []ReplicaStatus
+	Link     *LinkStatus
+	// RejectedReplicas - сколько раз мастер отказал реплике в доступе
+	RejectedReplicas uint64
+}
+
+// Reporter - репликация, которая может рассказать о своем состоянии
+type Reporter interface {
+	Status() Status
+}
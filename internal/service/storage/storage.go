@@ -4,39 +4,96 @@ import (
 	"antdb/internal/service/compute"
 	"antdb/internal/service/storage/replication"
 	"antdb/internal/service/storage/wal"
+	"antdb/internal/tracing"
 	"context"
 	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
+var ErrNotFound = errors.New("not found")
+
+const keyOrderCount = 256
+
 type Storage struct {
 	engine      Engine
 	wal         *wal.Wal
 	replication replication.Replication
 	stream      chan []*wal.Unit
-	logger      *zap.Logger
+
+	// applied - LSN последней записи, примененной к движку
+	mu            sync.Mutex
+	applied       uint64
+	appliedNotify chan struct{}
+
+	// keyOrders упорядочивают применение записей одного ключа, см. orderKey
+	keyOrders [keyOrderCount]keyOrder
+
+	watchers watchers
+	// publisher == nil - события ключей не публикуются
+	publisher Publisher
+
+	logger *zap.Logger
+}
+
+type StorageOption func(*Storage)
+
+// WithKeyspaceEvents публикует изменения ключей в каналы KeyspaceChannel.
+// Ключи, удаленные при полной синхронизации реплики, событий не получают
+func WithKeyspaceEvents(publisher Publisher) StorageOption {
+	return func(e *Storage) {
+		e.publisher = publisher
+	}
 }
 
 type Engine interface {
 	Set(string, string)
 	Get(string) (string, bool)
 	Del(string)
+	Clear()
+	Scan(prefix string, fn func(key, value string))
+	// Stats возвращает число ключей и суммарную длину ключей и значений
+	Stats() (int, int)
+}
+
+type KeyValue struct {
+	Key   string
+	Value string
 }
 
 func NewStorage(engine Engine,
 	wal *wal.Wal,
-	replication replication.Replication,
+	replica replication.Replication,
 	streamInit <-chan []*wal.Unit,
 	stream chan []*wal.Unit,
 	logger *zap.Logger,
+	options ...StorageOption,
 ) *Storage {
 	storage := &Storage{
 		engine:      engine,
 		wal:         wal,
-		replication: replication,
+		replication: replica,
 		stream:      stream,
-		logger:      logger,
+
+		appliedNotify: make(chan struct{}),
+
+		watchers: watchers{list: make(map[*watcher]struct{})},
+
+		logger: logger,
+	}
+
+	for _, option := range options {
+		option(storage)
+	}
+
+	// raft применяет записи к движку сам, события берем у него
+	if observable, ok := replica.(replication.Observable); ok {
+		observable.Observe(storage.notifyUnit)
 	}
 
 	// for restore
@@ -54,55 +111,319 @@ func NewStorage(engine Engine,
 	return storage
 }
 
-func (e *Storage) Set(ctx context.Context, key, value string) error {
-	if e.wal != nil {
-		if e.replication != nil && !e.replication.IsMaster() {
-			return errors.New("can't set in slave")
-		}
-		err := e.wal.Set(ctx, key, value)
-		if err != nil {
-			e.logger.Error("error set in wal", zap.Error(err))
-			return fmt.Errorf("can't set in wal: %w", err)
-		}
+// Set возвращает LSN записи в журнале (0, если журнал не ведется)
+func (e *Storage) Set(ctx context.Context, key, value string) (uint64, error) {
+	if consensus, ok := e.replication.(replication.Consensus); ok {
+		return consensus.Propose(ctx, wal.NewUnit(compute.SetCommand, []string{key, value}))
 	}
 
-	e.engine.Set(key, value)
-	return nil
+	lsn, err := e.set(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+	return lsn, e.waitDefaultReplicas(ctx, lsn)
 }
 
 func (e *Storage) Get(_ context.Context, key string) (string, error) {
 	value, ok := e.engine.Get(key)
 	if !ok {
-		return "", fmt.Errorf("not found")
+		return "", ErrNotFound
 	}
 
 	return value, nil
 }
 
-func (e *Storage) Del(ctx context.Context, key string) error {
+// Scan возвращает до limit ключей с префиксом prefix, для которых match
+// возвращает true, в порядке возрастания начиная с ключа после after.
+// limit == 0 - без ограничения
+func (e *Storage) Scan(_ context.Context, prefix, after string, limit int, match func(key string) bool) []KeyValue {
+	var result []KeyValue
+	e.engine.Scan(prefix, func(key, value string) {
+		if key > after && match(key) {
+			result = append(result, KeyValue{Key: key, Value: value})
+		}
+	})
+
+	slices.SortFunc(result, func(a, b KeyValue) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+func (e *Storage) Del(ctx context.Context, key string) (uint64, error) {
+	if consensus, ok := e.replication.(replication.Consensus); ok {
+		return consensus.Propose(ctx, wal.NewUnit(compute.DelCommand, []string{key}))
+	}
+
+	lsn, err := e.del(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return lsn, e.waitDefaultReplicas(ctx, lsn)
+}
+
+func (e *Storage) set(ctx context.Context, key, value string) (uint64, error) {
+	finish := e.orderKey(key)
+
+	var lsn uint64
+	if e.wal != nil {
+		if e.replication != nil && !e.replication.IsMaster() {
+			finish(0, nil)
+			return 0, errors.New("can't set in slave")
+		}
+
+		var err error
+		lsn, err = e.wal.Set(ctx, key, value)
+		if err != nil {
+			finish(0, nil)
+			e.logger.Error("error set in wal", zap.Error(err))
+			return 0, fmt.Errorf("can't set in wal: %w", err)
+		}
+	}
+
+	finish(lsn, func() {
+		_, span := tracing.Start(ctx, "engine.apply")
+		e.engine.Set(key, value)
+		span.End()
+		e.notify(Event{Command: compute.SetCommand, Key: key, Value: value, LSN: lsn})
+	})
+	e.setApplied(lsn)
+	return lsn, nil
+}
+
+func (e *Storage) del(ctx context.Context, key string) (uint64, error) {
+	finish := e.orderKey(key)
+
+	var lsn uint64
 	if e.wal != nil {
 		if e.replication != nil && !e.replication.IsMaster() {
-			return errors.New("can't del in slave")
+			finish(0, nil)
+			return 0, errors.New("can't del in slave")
 		}
-		err := e.wal.Del(ctx, key)
+
+		var err error
+		lsn, err = e.wal.Del(ctx, key)
 		if err != nil {
+			finish(0, nil)
 			e.logger.Error("error del wal", zap.Error(err))
-			return fmt.Errorf("can't del in wal: %w", err)
+			return 0, fmt.Errorf("can't del in wal: %w", err)
 		}
 	}
 
-	e.engine.Del(key)
+	finish(lsn, func() {
+		_, span := tracing.Start(ctx, "engine.apply")
+		e.engine.Del(key)
+		span.End()
+		e.notify(Event{Command: compute.DelCommand, Key: key, LSN: lsn})
+	})
+	e.setApplied(lsn)
+	return lsn, nil
+}
+
+// keyOrder - ключи одной части хэшей, у которых есть незавершенные записи
+type keyOrder struct {
+	mu   sync.Mutex
+	keys map[string]*keyWrites
+}
+
+type keyWrites struct {
+	// pending - записи ключа, которые еще не применены
+	pending int
+	// applied - LSN последней примененной записи ключа
+	applied uint64
+}
+
+// orderKey регистрирует запись ключа до того, как журнал назначит ей LSN.
+// Возвращенная finish применяет запись под блокировкой ключа, поэтому
+// движок и события получают записи ключа в порядке LSN, а ожидание fsync
+// идет без блокировки. Запись, которую уже обогнала более поздняя запись
+// того же ключа, не применяется и события не дает. Без журнала LSN == 0,
+// такие записи применяются всегда. apply == nil - запись не удалась
+func (e *Storage) orderKey(key string) (finish func(lsn uint64, apply func())) {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	order := &e.keyOrders[hash.Sum32()%keyOrderCount]
+
+	order.mu.Lock()
+	if order.keys == nil {
+		order.keys = make(map[string]*keyWrites)
+	}
+	writes, ok := order.keys[key]
+	if !ok {
+		writes = &keyWrites{}
+		order.keys[key] = writes
+	}
+	writes.pending++
+	order.mu.Unlock()
+
+	return func(lsn uint64, apply func()) {
+		order.mu.Lock()
+		defer order.mu.Unlock()
+
+		if apply != nil && (lsn == 0 || lsn > writes.applied) {
+			apply()
+			writes.applied = lsn
+		}
+
+		// пока записей ключа в работе нет, любая новая получит больший LSN
+		writes.pending--
+		if writes.pending == 0 {
+			delete(order.keys, key)
+		}
+	}
+}
+
+// Stats возвращает число ключей и суммарную длину ключей и значений
+func (e *Storage) Stats() (int, int) {
+	return e.engine.Stats()
+}
+
+// CheckWAL возвращает ошибку, если журнал не принимает записи
+func (e *Storage) CheckWAL() error {
+	if e.wal == nil {
+		return nil
+	}
+	return e.wal.Writable()
+}
+
+// CheckReplication возвращает ошибку, если узел не может обслуживать запросы
+// из-за репликации: у реплики нет связи с мастером или она отстала больше,
+// чем на maxLag записей, а в raft нет лидера или follower давно его не
+// слышал. maxLag == 0 - отставание не проверяется
+func (e *Storage) CheckReplication(maxLag uint64) error {
+	status, ok := e.ReplicationStatus()
+	if !ok {
+		return nil
+	}
+
+	if status.Role == replication.RoleCandidate {
+		return errors.New("raft leader is not elected")
+	}
+
+	link := status.Link
+	switch {
+	case link == nil:
+		return nil
+	case !link.Up && link.MasterAddress == "":
+		// follower raft, которому лидер еще неизвестен
+		return errors.New("raft leader is not elected")
+	case !link.Up:
+		return fmt.Errorf("master link to %s is down", link.MasterAddress)
+	case maxLag > 0 && link.LagRecords > maxLag:
+		return fmt.Errorf("replica is %d records behind master", link.LagRecords)
+	}
+	return nil
+}
+
+// ReplicationStatus возвращает состояние репликации, если она настроена
+func (e *Storage) ReplicationStatus() (replication.Status, bool) {
+	reporter, ok := e.replication.(replication.Reporter)
+	if !ok {
+		return replication.Status{}, false
+	}
+
+	return reporter.Status(), true
+}
+
+// WaitReplicas ждет, пока replicas реплик подтвердят запись с LSN lsn
+func (e *Storage) WaitReplicas(ctx context.Context, lsn uint64, replicas int, timeout time.Duration) error {
+	if replicas <= 0 {
+		return nil
+	}
+
+	acknowledger, ok := e.replication.(replication.Acknowledger)
+	if !ok {
+		return errors.New("replicas acknowledgement is not supported")
+	}
+
+	return acknowledger.WaitForReplicas(ctx, lsn, replicas, timeout)
+}
+
+// WaitApplied ждет, пока узел применит запись с LSN lsn. Так реплика может
+// прочитать данные не старше записи, которую клиент уже сделал на мастере
+func (e *Storage) WaitApplied(ctx context.Context, lsn uint64, timeout time.Duration) error {
+	if applier, ok := e.replication.(replication.Applier); ok {
+		return applier.WaitForApplied(ctx, lsn, timeout)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		e.mu.Lock()
+		applied := e.applied
+		notify := e.appliedNotify
+		e.mu.Unlock()
+
+		if applied >= lsn {
+			return nil
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return fmt.Errorf("%w: %d, applied %d", replication.ErrNotApplied, lsn, applied)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *Storage) setApplied(lsn uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if lsn <= e.applied {
+		return
+	}
+
+	e.applied = lsn
+	close(e.appliedNotify)
+	e.appliedNotify = make(chan struct{})
+}
+
+func (e *Storage) waitDefaultReplicas(ctx context.Context, lsn uint64) error {
+	acknowledger, ok := e.replication.(replication.Acknowledger)
+	if !ok || lsn == 0 {
+		return nil
+	}
+
+	if err := acknowledger.WaitForDefaultReplicas(ctx, lsn); err != nil {
+		e.logger.Warn("write is not acknowledged by replicas", zap.Uint64("lsn", lsn), zap.Error(err))
+		return err
+	}
+
 	return nil
 }
 
 func (e *Storage) applyUnits(units []*wal.Unit) {
+	var lsn uint64
+	defer func() {
+		e.setApplied(lsn)
+	}()
+
 	for _, unit := range units {
+		lsn = max(lsn, unit.LSN)
+
 		if unit.Command == string(compute.SetCommand) {
 			e.engine.Set(unit.Arguments[0], unit.Arguments[1])
+			e.notifyUnit(unit)
 			continue
 		}
 		if unit.Command == string(compute.DelCommand) {
 			e.engine.Del(unit.Arguments[0])
+			e.notifyUnit(unit)
+			continue
+		}
+
+		// после CHECKPOINT идут записи снимка, по ним события публикуются.
+		// Об удалении ключей, которых в снимке нет, события не публикуются
+		if unit.Command == wal.CheckpointCommand {
+			e.engine.Clear()
 			continue
 		}
 	}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage/engine"
+	"antdb/internal/service/storage/replication"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStorage_WaitApplied(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit, 1)
+	restore <- []*wal.Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 3}}
+	close(restore)
+
+	stream := make(chan []*wal.Unit)
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, stream, zap.NewNop())
+
+	// восстановленные из журнала записи уже применены
+	require.NoError(t, st.WaitApplied(context.Background(), 3, 10*time.Millisecond))
+
+	err := st.WaitApplied(context.Background(), 4, 10*time.Millisecond)
+	require.True(t, errors.Is(err, replication.ErrNotApplied))
+
+	go func() {
+		stream <- []*wal.Unit{{Command: "SET", Arguments: []string{"a", "2"}, LSN: 4}}
+	}()
+	require.NoError(t, st.WaitApplied(context.Background(), 4, time.Second))
+
+	value, err := st.Get(context.Background(), "a")
+	require.NoError(t, err)
+	require.Equal(t, "2", value)
+}
+
+func TestStorage_Watch(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	stream := make(chan []*wal.Unit)
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, stream, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := st.Watch(ctx, func(key string) bool {
+		return key != "skip"
+	})
+
+	_, err := st.Set(context.Background(), "skip", "1")
+	require.NoError(t, err)
+	_, err = st.Set(context.Background(), "a", "1")
+	require.NoError(t, err)
+	// записи, полученные репликацией, тоже попадают подписчикам
+	stream <- []*wal.Unit{{Command: "DEL", Arguments: []string{"a"}, LSN: 7}}
+
+	require.Equal(t, Event{Command: compute.SetCommand, Key: "a", Value: "1"}, <-events)
+	require.Equal(t, Event{Command: compute.DelCommand, Key: "a", LSN: 7}, <-events)
+
+	cancel()
+	_, ok := <-events
+	require.False(t, ok)
+}
+
+func TestStorage_WatchSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+
+	events := st.Watch(context.Background(), func(string) bool { return true })
+	for i := 0; i <= watchBufferSize; i++ {
+		_, err := st.Set(context.Background(), "a", "1")
+		require.NoError(t, err)
+	}
+
+	// подписчик, переполнивший буфер, отключается
+	for range events {
+	}
+}
+
+func TestStorage_Scan(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+	for _, key := range []string{"b/2", "a/1", "b/1", "b/3", "b/secret"} {
+		_, err := st.Set(context.Background(), key, key)
+		require.NoError(t, err)
+	}
+	all := func(string) bool { return true }
+
+	require.Equal(t, []KeyValue{{"b/1", "b/1"}, {"b/2", "b/2"}}, st.Scan(context.Background(), "b/", "", 2, all))
+	require.Equal(t, []KeyValue{{"b/3", "b/3"}, {"b/secret", "b/secret"}}, st.Scan(context.Background(), "b/", "b/2", 0, all))
+	require.Equal(t, []KeyValue{{"b/1", "b/1"}, {"b/2", "b/2"}, {"b/3", "b/3"}},
+		st.Scan(context.Background(), "b/", "", 0, func(key string) bool { return key != "b/secret" }))
+}
+
+type fakeReplication struct {
+	status replication.Status
+}
+
+func (r *fakeReplication) Start(context.Context) error {
+	return nil
+}
+
+func (r *fakeReplication) IsMaster() bool {
+	return r.status.Link == nil
+}
+
+func (r *fakeReplication) Status() replication.Status {
+	return r.status
+}
+
+func TestStorage_CheckReplication(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		status replication.Status
+		maxLag uint64
+		err    string
+	}{
+		"master": {
+			status: replication.Status{Role: replication.RoleMaster},
+		},
+		"raft candidate": {
+			status: replication.Status{Role: replication.RoleCandidate},
+			err:    "raft leader is not elected",
+		},
+		"raft follower without leader": {
+			status: replication.Status{Role: "follower", Link: &replication.LinkStatus{}},
+			err:    "raft leader is not elected",
+		},
+		"raft follower with stale leader": {
+			status: replication.Status{Role: "follower", Link: &replication.LinkStatus{MasterAddress: "node1"}},
+			err:    "master link to node1 is down",
+		},
+		"replica link down": {
+			status: replication.Status{Role: replication.RoleSlave, Link: &replication.LinkStatus{MasterAddress: ":3232"}},
+			err:    "master link to :3232 is down",
+		},
+		"replica lag is not checked": {
+			status: replication.Status{Role: replication.RoleSlave, Link: &replication.LinkStatus{Up: true, LagRecords: 100}},
+		},
+		"replica lag below limit": {
+			status: replication.Status{Role: replication.RoleSlave, Link: &replication.LinkStatus{Up: true, LagRecords: 10}},
+			maxLag: 10,
+		},
+		"replica lag above limit": {
+			status: replication.Status{Role: replication.RoleSlave, Link: &replication.LinkStatus{Up: true, LagRecords: 11}},
+			maxLag: 10,
+			err:    "replica is 11 records behind master",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			restore := make(chan []*wal.Unit)
+			close(restore)
+			st := NewStorage(engine.NewMemoryTable(), nil, &fakeReplication{status: test.status}, restore, make(chan []*wal.Unit), zap.NewNop())
+
+			err := st.CheckReplication(test.maxLag)
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.err)
+			}
+		})
+	}
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+	require.NoError(t, st.CheckReplication(1))
+	require.NoError(t, st.CheckWAL())
+}
+
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (p *fakePublisher) Publish(channel, payload string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, channel+" "+payload)
+	return 1
+}
+
+func TestStorage_KeyspaceEvents(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	stream := make(chan []*wal.Unit)
+	publisher := &fakePublisher{}
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, stream, zap.NewNop(), WithKeyspaceEvents(publisher))
+
+	_, err := st.Set(context.Background(), "a", "1")
+	require.NoError(t, err)
+	_, err = st.Del(context.Background(), "a")
+	require.NoError(t, err)
+	// записи репликации тоже публикуются
+	stream <- []*wal.Unit{{Command: "SET", Arguments: []string{"b", "2"}, LSN: 1}}
+
+	require.Eventually(t, func() bool {
+		publisher.mu.Lock()
+		defer publisher.mu.Unlock()
+		return len(publisher.messages) == 3
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []string{"__keyspace__/a set", "__keyspace__/a del", "__keyspace__/b set"}, publisher.messages)
+
+	key, ok := KeyFromChannel(KeyspaceChannel("users/1"))
+	require.True(t, ok)
+	require.Equal(t, "users/1", key)
+	_, ok = KeyFromChannel("news")
+	require.False(t, ok)
+}
+
+// slowEngine расширяет окно между изменением движка и публикацией события
+type slowEngine struct {
+	*engine.MemoryTable
+}
+
+func (e slowEngine) Set(key, value string) {
+	e.MemoryTable.Set(key, value)
+	time.Sleep(time.Millisecond)
+}
+
+func (e slowEngine) Del(key string) {
+	e.MemoryTable.Del(key)
+	time.Sleep(time.Millisecond)
+}
+
+func TestStorage_EventsOrder(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := NewStorage(slowEngine{engine.NewMemoryTable()}, nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := st.Watch(ctx, func(string) bool { return true })
+
+	// последнее событие ключа совпадает с его значением в движке, как бы ни
+	// пересекались параллельные записи
+	for round := 0; round < 20; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i%3 == 0 {
+					_, _ = st.Del(context.Background(), "key")
+					return
+				}
+				_, _ = st.Set(context.Background(), "key", strconv.Itoa(i))
+			}(i)
+		}
+		wg.Wait()
+
+		var last Event
+		for i := 0; i < 8; i++ {
+			last = <-events
+		}
+		value, err := st.Get(context.Background(), "key")
+		if last.Command == compute.DelCommand {
+			require.ErrorIs(t, err, ErrNotFound)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, last.Value, value)
+		}
+	}
+}
+
+func TestStorage_OrderKey(t *testing.T) {
+	t.Parallel()
+
+	restore := make(chan []*wal.Unit)
+	close(restore)
+	st := NewStorage(engine.NewMemoryTable(), nil, nil, restore, make(chan []*wal.Unit), zap.NewNop())
+
+	// журнал назначил записям LSN 5 и 6, но вторая закончила fsync первой
+	var applied []uint64
+	first := st.orderKey("key")
+	second := st.orderKey("key")
+	failed := st.orderKey("key")
+	other := st.orderKey("other")
+
+	second(6, func() { applied = append(applied, 6) })
+	first(5, func() { applied = append(applied, 5) })
+	failed(0, nil)
+	other(4, func() { applied = append(applied, 4) })
+	require.Equal(t, []uint64{6, 4}, applied)
+
+	// после завершения всех записей сведения о ключах не хранятся
+	for i := range st.keyOrders {
+		require.Empty(t, st.keyOrders[i].keys)
+	}
+}
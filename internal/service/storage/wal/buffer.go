@@ -2,7 +2,9 @@ package wal
 
 import (
 	"context"
+	"go.opentelemetry.io/otel/trace"
 	"sync"
+	"time"
 )
 
 type Buffer interface {
@@ -32,7 +34,12 @@ func (b *buffer) Push(ctx context.Context, unit *Unit) chan error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.values = append(b.values, &UnitData{Unit: unit, ErrChan: errorCh})
+	unitData := &UnitData{Unit: unit, ErrChan: errorCh}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsSampled() {
+		unitData.SpanContext = spanContext
+		unitData.Pushed = time.Now()
+	}
+	b.values = append(b.values, unitData)
 
 	if len(b.values) >= b.limit && len(b.oversize) == 0 {
 		b.oversize <- struct{}{}
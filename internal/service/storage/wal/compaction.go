@@ -1,7 +1,6 @@
 package wal
 
 import (
-	"antdb/internal/service/compute"
 	"bytes"
 	"context"
 	"encoding/gob"
@@ -11,6 +10,7 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +19,11 @@ type Compaction struct {
 	isProcessing bool // операция с файлами может быть долгая
 	interval     time.Duration
 	logger       *zap.Logger
+
+	// результат последнего запуска, см. LastRun
+	mu      sync.Mutex
+	lastRun time.Time
+	lastErr error
 }
 
 func NewCompaction(dir string, interval time.Duration, logger *zap.Logger) *Compaction {
@@ -40,7 +45,14 @@ func (c *Compaction) Start(ctx context.Context) error {
 			if c.isProcessing {
 				continue
 			}
+			start := time.Now()
 			err := c.run()
+			observeCompaction(start, err)
+
+			c.mu.Lock()
+			c.lastRun, c.lastErr = start, err
+			c.mu.Unlock()
+
 			if err != nil {
 				c.logger.Error("can't compact wal", zap.Error(err))
 			}
@@ -48,6 +60,15 @@ func (c *Compaction) Start(ctx context.Context) error {
 	}
 }
 
+// LastRun возвращает время начала последнего запуска и его ошибку.
+// Нулевое время - запусков еще не было
+func (c *Compaction) LastRun() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastRun, c.lastErr
+}
+
 func (c *Compaction) run() error {
 	c.isProcessing = true
 	defer func() {
@@ -66,7 +87,8 @@ func (c *Compaction) run() error {
 		}
 	}
 
-	if len(segments) > 1 {
+	// последний сегмент открыт на запись, его не трогаем
+	if len(segments) > 2 {
 		sort.Strings(segments) // asc
 		err = c.compact(segments[:2])
 		if err != nil {
@@ -90,11 +112,13 @@ func (c *Compaction) compact(segments []string) error {
 		return nil
 	}
 
+	// сжатый файл пишется под временным именем, которое не похоже на сегмент
 	compactedFilename := path.Join(c.directory, fmt.Sprintf("compacted-%d.gob", time.Now().Unix()))
-	file, err := os.OpenFile(compactedFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := os.OpenFile(compactedFilename, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("can't open file: %w", err)
 	}
+	defer file.Close()
 
 	var buf bytes.Buffer
 	encoder := gob.NewEncoder(&buf)
@@ -112,54 +136,42 @@ func (c *Compaction) compact(segments []string) error {
 		return fmt.Errorf("can't sync file: %w", err)
 	}
 
-	for _, segment := range segments {
-		err = os.Remove(path.Join(c.directory, segment))
-		if err != nil {
-			return fmt.Errorf("can't remove segment [%s]: %w", segment, err)
-		}
-	}
+	// первый сегмент атомарно заменяется сжатым, и только потом удаляются
+	// остальные. Чтение сегментов мастером ждет, пока замена не закончится
+	dir := getSegmentDir(c.directory)
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+	defer dir.forget(segments)
 
 	err = os.Rename(compactedFilename, path.Join(c.directory, segments[0]))
 	if err != nil {
 		return fmt.Errorf("can't rename file segment: %w", err)
 	}
 
+	for _, segment := range segments[1:] {
+		err = os.Remove(path.Join(c.directory, segment))
+		if err != nil {
+			return fmt.Errorf("can't remove segment [%s]: %w", segment, err)
+		}
+	}
+
 	return nil
 }
 
+// readUnits сворачивает сегменты в набор записей SET, сохраняя их LSN.
+// Если в сегментах были LSN, первой идет служебная запись с последним из них.
 func (c *Compaction) readUnits(segments []string) ([]*Unit, error) {
-	memoryTable := make(map[string]string)
+	state := newSnapshot()
 	for _, segment := range segments {
-		file, err := os.ReadFile(path.Join(c.directory, segment))
+		units, err := readSegment(path.Join(c.directory, segment))
 		if err != nil {
-			return nil, fmt.Errorf("can't open segment [%s]: %w", segment, err)
-		}
-
-		datBuf := bytes.NewBuffer(file)
-		for datBuf.Len() > 0 {
-			var units []*Unit
-			decoder := gob.NewDecoder(datBuf)
-			if err := decoder.Decode(&units); err != nil {
-				return nil, fmt.Errorf("can't parse segment [%s]: %w", segment, err)
-			}
-
-			for _, unit := range units {
-				if unit.Command == string(compute.SetCommand) {
-					memoryTable[unit.Arguments[0]] = unit.Arguments[1]
-					continue
-				}
-				if unit.Command == string(compute.DelCommand) {
-					delete(memoryTable, unit.Arguments[0])
-					continue
-				}
-			}
+			return nil, err
 		}
+		state.apply(units)
 	}
 
-	var unitsData []*Unit
-	for key, val := range memoryTable {
-		unitsData = append(unitsData, NewUnit(compute.SetCommand, []string{key, val}))
+	if state.lsn == 0 {
+		return state.result(), nil
 	}
-
-	return unitsData, nil
+	return state.checkpoint(), nil
 }
@@ -1,11 +1,14 @@
 package wal
 
 import (
+	"bytes"
+	"encoding/gob"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"os"
 	"path"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -63,3 +66,90 @@ func TestCompaction_compact(t *testing.T) {
 	require.Equal(t, 1, len(files))
 	require.Equal(t, "wal-1716904987.gob", files[0].Name())
 }
+
+func TestCompaction_readUnitsWithLSN(t *testing.T) {
+	tempDir := t.TempDir()
+	writer := NewWriter(tempDir, 1024, zap.NewNop())
+	err := writer.Write([]*Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+		{Command: "DEL", Arguments: []string{"b"}, LSN: 3},
+	})
+	require.NoError(t, err)
+
+	segment, err := GetLastSegment(tempDir)
+	require.NoError(t, err)
+
+	compaction := NewCompaction(tempDir, time.Second, zap.NewNop())
+	units, err := compaction.readUnits([]string{segment})
+	require.NoError(t, err)
+
+	// позиция журнала сохраняется, чтобы реплики могли понять, что история свернута
+	require.Equal(t, []*Unit{
+		{Command: CheckpointCommand, LSN: 3},
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+	}, units)
+}
+
+func writeSegment(t *testing.T, dir, name string, units []*Unit) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&units))
+	require.NoError(t, os.WriteFile(path.Join(dir, name), buf.Bytes(), 0o644))
+}
+
+func TestCompaction_ConcurrentReaders(t *testing.T) {
+	tempDir := t.TempDir()
+	compaction := NewCompaction(tempDir, time.Second, zap.NewNop())
+
+	for i := 0; i < 200; i++ {
+		writeSegment(t, tempDir, "wal-1.gob", []*Unit{
+			{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+			{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+		})
+		writeSegment(t, tempDir, "wal-2.gob", []*Unit{
+			{Command: "DEL", Arguments: []string{"a"}, LSN: 3},
+		})
+		writeSegment(t, tempDir, "wal-3.gob", []*Unit{
+			{Command: "SET", Arguments: []string{"c", "3"}, LSN: 4},
+		})
+
+		// во время сжатия мастер видит либо старые сегменты, либо сжатый
+		// вместо первых двух, но не каталог без них
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					units, err := ReadUnitsAfter(tempDir, 0, 100)
+					require.NoError(t, err)
+					require.Equal(t, uint64(4), units[len(units)-1].LSN)
+					start, err := GetHistoryStart(tempDir)
+					require.NoError(t, err)
+					require.Contains(t, []uint64{0, 3}, start)
+				}
+			}()
+		}
+
+		require.NoError(t, compaction.compact([]string{"wal-1.gob", "wal-2.gob"}))
+		close(done)
+		wg.Wait()
+
+		units, err := ReadUnitsAfter(tempDir, 0, 100)
+		require.NoError(t, err)
+		require.Equal(t, []*Unit{
+			{Command: CheckpointCommand, LSN: 3},
+			{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+			{Command: "SET", Arguments: []string{"c", "3"}, LSN: 4},
+		}, units)
+	}
+}
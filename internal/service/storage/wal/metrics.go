@@ -0,0 +1,85 @@
+package wal
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+var (
+	flushBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "antdb",
+		Subsystem: "wal",
+		Name:      "flush_batch_size",
+		Help:      "Number of records written to the WAL in one flush.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+	fsyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "antdb",
+		Subsystem: "wal",
+		Name:      "fsync_duration_seconds",
+		Help:      "Time spent in fsync of a WAL segment.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	})
+	compactionRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "antdb",
+		Subsystem: "wal",
+		Name:      "compaction_runs_total",
+		Help:      "Number of WAL compaction runs by result.",
+	}, []string{"result"})
+	compactionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "antdb",
+		Subsystem: "wal",
+		Name:      "compaction_duration_seconds",
+		Help:      "Duration of WAL compaction runs.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+)
+
+// RegisterMetrics регистрирует метрики записи и сжатия журнала
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(flushBatchSize, fsyncDuration, compactionRuns, compactionDuration)
+}
+
+var (
+	segmentsDesc = prometheus.NewDesc("antdb_wal_segments",
+		"Number of WAL segments on disk.", nil, nil)
+	segmentBytesDesc = prometheus.NewDesc("antdb_wal_segment_bytes",
+		"Total size of WAL segments on disk.", nil, nil)
+)
+
+// SegmentsCollector при каждом сборе метрик считает сегменты журнала в каталоге
+type SegmentsCollector struct {
+	directory string
+}
+
+func NewSegmentsCollector(dir string) *SegmentsCollector {
+	return &SegmentsCollector{
+		directory: dir,
+	}
+}
+
+func (c *SegmentsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- segmentsDesc
+	ch <- segmentBytesDesc
+}
+
+func (c *SegmentsCollector) Collect(ch chan<- prometheus.Metric) {
+	segments, size, err := SegmentStats(c.directory)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(segmentsDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(segmentsDesc, prometheus.GaugeValue, float64(segments))
+	ch <- prometheus.MustNewConstMetric(segmentBytesDesc, prometheus.GaugeValue, float64(size))
+}
+
+// observeCompaction учитывает запуск сжатия, который начался в start
+func observeCompaction(start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	compactionRuns.WithLabelValues(result).Inc()
+	compactionDuration.Observe(time.Since(start).Seconds())
+}
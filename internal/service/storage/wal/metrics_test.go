@@ -0,0 +1,30 @@
+package wal
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSegmentsCollector(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal-1.gob"), make([]byte, 100), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal-2.gob"), make([]byte, 50), 0o644))
+	// незавершенный снимок сжатия не считается сегментом
+	require.NoError(t, os.WriteFile(path.Join(dir, "compacted-3.gob"), make([]byte, 10), 0o644))
+
+	expected := `
+# HELP antdb_wal_segment_bytes Total size of WAL segments on disk.
+# TYPE antdb_wal_segment_bytes gauge
+antdb_wal_segment_bytes 150
+# HELP antdb_wal_segments Number of WAL segments on disk.
+# TYPE antdb_wal_segments gauge
+antdb_wal_segments 2
+`
+	require.NoError(t, testutil.CollectAndCompare(NewSegmentsCollector(dir), strings.NewReader(expected)))
+}
@@ -9,11 +9,13 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 type Reader struct {
 	directory string
 	stream    chan []*Unit
+	lastLSN   atomic.Uint64
 	logger    *zap.Logger
 }
 
@@ -56,6 +58,11 @@ func (r *Reader) Read() error {
 				return fmt.Errorf("can't parse segment [%s]: %w", segment, err)
 			}
 
+			for _, unit := range units {
+				if unit.LSN > r.lastLSN.Load() {
+					r.lastLSN.Store(unit.LSN)
+				}
+			}
 			r.stream <- units
 		}
 	}
@@ -66,3 +73,8 @@ func (r *Reader) Read() error {
 func (r *Reader) GetStream() chan []*Unit {
 	return r.stream
 }
+
+// LastLSN возвращает наибольший LSN среди прочитанных записей
+func (r *Reader) LastLSN() uint64 {
+	return r.lastLSN.Load()
+}
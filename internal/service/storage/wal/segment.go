@@ -1,13 +1,96 @@
 package wal
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// segmentDirs - общее для всех читателей состояние каталогов журнала
+var segmentDirs sync.Map
+
+type segmentDir struct {
+	// mu: сжатие заменяет сегменты под блокировкой на запись, чтение
+	// содержимого сегментов идет под блокировкой на чтение, поэтому читатель
+	// не видит каталог, из которого сегменты уже удалены, а сжатый файл еще
+	// не на месте
+	mu sync.RWMutex
+
+	// index - сведения о прочитанных сегментах, по ним реплики, которые
+	// догнали мастер, не декодируют весь журнал на каждый запрос
+	indexMu sync.Mutex
+	index   map[string]segmentInfo
+}
+
+// segmentInfo действительна, пока у файла сегмента те же размер и время
+// изменения. first - первая запись с LSN, lastLSN - наибольший LSN сегмента
+type segmentInfo struct {
+	size    int64
+	modTime time.Time
+	first   *Unit
+	lastLSN uint64
+}
+
+func getSegmentDir(dir string) *segmentDir {
+	d, _ := segmentDirs.LoadOrStore(filepath.Clean(dir), &segmentDir{index: make(map[string]segmentInfo)})
+	return d.(*segmentDir)
+}
+
+// describe возвращает сведения о сегменте. Сегмент декодируется, только если
+// его еще не читали или он изменился, тогда возвращаются и его записи
+func (d *segmentDir) describe(dir, segment string) (segmentInfo, []*Unit, error) {
+	filename := path.Join(dir, segment)
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return segmentInfo{}, nil, fmt.Errorf("can't stat segment [%s]: %w", filename, err)
+	}
+
+	d.indexMu.Lock()
+	info, ok := d.index[segment]
+	d.indexMu.Unlock()
+	if ok && info.size == stat.Size() && info.modTime.Equal(stat.ModTime()) {
+		return info, nil, nil
+	}
+
+	units, err := readSegment(filename)
+	if err != nil {
+		return segmentInfo{}, nil, err
+	}
+
+	// файл мог вырасти после Stat, тогда при следующем чтении размер не
+	// совпадет и сегмент прочитается заново
+	info = segmentInfo{size: stat.Size(), modTime: stat.ModTime()}
+	for _, unit := range units {
+		if info.first == nil && unit.LSN > 0 {
+			info.first = unit
+		}
+		info.lastLSN = max(info.lastLSN, unit.LSN)
+	}
+
+	d.indexMu.Lock()
+	d.index[segment] = info
+	d.indexMu.Unlock()
+	return info, units, nil
+}
+
+// forget удаляет сведения о сегментах, которые заменило сжатие
+func (d *segmentDir) forget(segments []string) {
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+
+	for _, segment := range segments {
+		delete(d.index, segment)
+	}
+}
+
 func GetNewerSegmentNames(dir string, name string) ([]string, error) {
 	parseName := func(fileName string) (int64, error) {
 		if fileName == "" {
@@ -47,6 +130,23 @@ func GetNewerSegmentNames(dir string, name string) ([]string, error) {
 	return segments, nil
 }
 
+// SegmentStats возвращает число сегментов в каталоге и их общий размер
+func SegmentStats(dir string) (int, int64, error) {
+	segments, err := GetNewerSegmentNames(dir, "")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+	for _, segment := range segments {
+		// сегмент мог удалить компактор
+		if info, err := os.Stat(path.Join(dir, segment)); err == nil {
+			size += info.Size()
+		}
+	}
+	return len(segments), size, nil
+}
+
 func GetLastSegment(dir string) (string, error) {
 	segments, err := GetNewerSegmentNames(dir, "")
 	if err != nil {
@@ -72,3 +172,93 @@ func GetNextSegment(dir string, name string) (string, error) {
 
 	return segments[1], nil
 }
+
+// ReadUnitsAfter возвращает записи с LSN больше lsn в порядке журнала, не больше limit
+func ReadUnitsAfter(dir string, lsn uint64, limit int) ([]*Unit, error) {
+	d := getSegmentDir(dir)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.readUnitsAfter(dir, lsn, limit)
+}
+
+// readUnitsAfter пропускает сегменты, в которых все LSN не больше lsn
+func (d *segmentDir) readUnitsAfter(dir string, lsn uint64, limit int) ([]*Unit, error) {
+	segments, err := GetNewerSegmentNames(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Unit
+	for _, segment := range segments {
+		info, units, err := d.describe(dir, segment)
+		if err != nil {
+			return nil, err
+		}
+		if info.lastLSN <= lsn {
+			continue
+		}
+		if units == nil {
+			if units, err = readSegment(path.Join(dir, segment)); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, unit := range units {
+			if unit.LSN <= lsn {
+				continue
+			}
+			result = append(result, unit)
+			if len(result) >= limit {
+				return result, nil
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// GetLastLSN возвращает наибольший LSN журнала. Последний сегмент может быть
+// пустым: сразу после смены сегмента или если узел упал до первой записи в
+// него, тогда LSN берется из предыдущих
+func GetLastLSN(dir string) (uint64, error) {
+	d := getSegmentDir(dir)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	segments, err := GetNewerSegmentNames(dir, "")
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		info, _, err := d.describe(dir, segments[i])
+		if err != nil {
+			return 0, err
+		}
+		if info.lastLSN > 0 {
+			return info.lastLSN, nil
+		}
+	}
+	return 0, nil
+}
+
+func readSegment(filename string) ([]*Unit, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't open segment [%s]: %w", filename, err)
+	}
+
+	var result []*Unit
+	datBuf := bytes.NewBuffer(data)
+	for datBuf.Len() > 0 {
+		var units []*Unit
+		decoder := gob.NewDecoder(datBuf)
+		if err := decoder.Decode(&units); err != nil {
+			return nil, fmt.Errorf("can't parse segment [%s]: %w", filename, err)
+		}
+		result = append(result, units...)
+	}
+
+	return result, nil
+}
@@ -3,6 +3,9 @@ package wal
 import (
 	"errors"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -130,3 +133,86 @@ func TestSegment_GetNextSegment(t *testing.T) {
 	}
 
 }
+
+func TestSegment_ReadUnitsAfter(t *testing.T) {
+	tempDir := t.TempDir()
+	writer := NewWriter(tempDir, 1024, zap.NewNop())
+	err := writer.Write([]*Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+	})
+	require.NoError(t, err)
+	err = writer.Write([]*Unit{
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 3},
+	})
+	require.NoError(t, err)
+
+	units, err := ReadUnitsAfter(tempDir, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, []*Unit{
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 3},
+	}, units)
+
+	units, err = ReadUnitsAfter(tempDir, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, units, 1)
+
+	lsn, err := GetLastLSN(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lsn)
+}
+
+func TestSegment_ReadUnitsAfterSkipsSegments(t *testing.T) {
+	tempDir := t.TempDir()
+	writeSegment(t, tempDir, "wal-1.gob", []*Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+	})
+	writeSegment(t, tempDir, "wal-2.gob", []*Unit{
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 3},
+	})
+
+	units, err := ReadUnitsAfter(tempDir, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, units, 3)
+
+	// прочитанный сегмент, все записи которого реплика уже получила, больше
+	// не декодируется: испорченный файл того же размера не мешает чтению
+	filename := path.Join(tempDir, "wal-1.gob")
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, make([]byte, info.Size()), 0o644))
+	require.NoError(t, os.Chtimes(filename, info.ModTime(), info.ModTime()))
+
+	units, err = ReadUnitsAfter(tempDir, 2, 10)
+	require.NoError(t, err)
+	require.Equal(t, []*Unit{{Command: "DEL", Arguments: []string{"a"}, LSN: 3}}, units)
+
+	start, err := GetHistoryStart(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), start)
+
+	// измененный сегмент читается заново
+	writeSegment(t, tempDir, "wal-2.gob", []*Unit{
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 3},
+		{Command: "SET", Arguments: []string{"c", "4"}, LSN: 4},
+	})
+	units, err = ReadUnitsAfter(tempDir, 3, 10)
+	require.NoError(t, err)
+	require.Equal(t, []*Unit{{Command: "SET", Arguments: []string{"c", "4"}, LSN: 4}}, units)
+}
+
+func TestSegment_GetLastLSNEmptySegment(t *testing.T) {
+	tempDir := t.TempDir()
+	writeSegment(t, tempDir, "wal-1.gob", []*Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+	})
+	// новый сегмент создан, но записать в него узел не успел
+	require.NoError(t, os.WriteFile(path.Join(tempDir, "wal-2.gob"), nil, 0o644))
+
+	lsn, err := GetLastLSN(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lsn)
+}
@@ -0,0 +1,116 @@
+package wal
+
+import (
+	"antdb/internal/service/compute"
+	"path"
+	"sort"
+)
+
+// snapshot - состояние, полученное проигрыванием записей журнала
+type snapshot struct {
+	lsn   uint64
+	order []string
+	units map[string]*Unit
+}
+
+func newSnapshot() *snapshot {
+	return &snapshot{
+		units: make(map[string]*Unit),
+	}
+}
+
+func (s *snapshot) apply(units []*Unit) {
+	for _, unit := range units {
+		s.lsn = max(s.lsn, unit.LSN)
+
+		switch unit.Command {
+		case string(compute.SetCommand):
+			if _, ok := s.units[unit.Arguments[0]]; !ok {
+				s.order = append(s.order, unit.Arguments[0])
+			}
+			s.units[unit.Arguments[0]] = unit
+		case string(compute.DelCommand):
+			delete(s.units, unit.Arguments[0])
+		case CheckpointCommand:
+			s.order = nil
+			s.units = make(map[string]*Unit)
+		}
+	}
+}
+
+// result возвращает записи SET в порядке LSN, без служебной записи
+func (s *snapshot) result() []*Unit {
+	var result []*Unit
+	seen := make(map[string]bool, len(s.units))
+	for _, key := range s.order {
+		unit, ok := s.units[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, unit)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LSN < result[j].LSN
+	})
+	return result
+}
+
+// checkpoint возвращает снимок, который начинается со служебной записи
+func (s *snapshot) checkpoint() []*Unit {
+	return append([]*Unit{{Command: CheckpointCommand, LSN: s.lsn}}, s.result()...)
+}
+
+// ReadSnapshot проигрывает все сегменты журнала и возвращает согласованный
+// снимок: служебную запись с LSN снимка и записи SET для всех ключей
+func ReadSnapshot(dir string) ([]*Unit, error) {
+	d := getSegmentDir(dir)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	segments, err := GetNewerSegmentNames(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	state := newSnapshot()
+	for _, segment := range segments {
+		units, err := readSegment(path.Join(dir, segment))
+		if err != nil {
+			return nil, err
+		}
+		state.apply(units)
+	}
+
+	return state.checkpoint(), nil
+}
+
+// GetHistoryStart возвращает LSN, начиная с которого журнал содержит все записи:
+// реплика с меньшим LSN не может догнать мастер по журналу
+func GetHistoryStart(dir string) (uint64, error) {
+	d := getSegmentDir(dir)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	segments, err := GetNewerSegmentNames(dir, "")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, segment := range segments {
+		info, _, err := d.describe(dir, segment)
+		if err != nil {
+			return 0, err
+		}
+		if info.first == nil {
+			continue
+		}
+
+		if info.first.Command == CheckpointCommand {
+			return info.first.LSN, nil
+		}
+		return info.first.LSN - 1, nil
+	}
+	return 0, nil
+}
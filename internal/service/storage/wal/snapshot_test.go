@@ -0,0 +1,47 @@
+package wal
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	tempDir := t.TempDir()
+	writer := NewWriter(tempDir, 1024, zap.NewNop())
+	err := writer.Write([]*Unit{
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 1},
+		{Command: "SET", Arguments: []string{"b", "2"}, LSN: 2},
+		{Command: "DEL", Arguments: []string{"a"}, LSN: 3},
+		{Command: "SET", Arguments: []string{"b", "3"}, LSN: 4},
+		{Command: "SET", Arguments: []string{"c", "4"}, LSN: 5},
+	})
+	require.NoError(t, err)
+
+	units, err := ReadSnapshot(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, []*Unit{
+		{Command: CheckpointCommand, LSN: 5},
+		{Command: "SET", Arguments: []string{"b", "3"}, LSN: 4},
+		{Command: "SET", Arguments: []string{"c", "4"}, LSN: 5},
+	}, units)
+
+	start, err := GetHistoryStart(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), start)
+}
+
+func TestGetHistoryStart(t *testing.T) {
+	tempDir := t.TempDir()
+	writer := NewWriter(tempDir, 1024, zap.NewNop())
+	err := writer.Write([]*Unit{
+		{Command: CheckpointCommand, LSN: 10},
+		{Command: "SET", Arguments: []string{"b", "3"}, LSN: 7},
+		{Command: "SET", Arguments: []string{"a", "1"}, LSN: 11},
+	})
+	require.NoError(t, err)
+
+	start, err := GetHistoryStart(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), start)
+}
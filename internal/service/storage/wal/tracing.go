@@ -0,0 +1,30 @@
+package wal
+
+import (
+	"antdb/internal/tracing"
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// traceFlush записывает в трассировку запроса ожидание в буфере и запись
+// пачки на диск. Пачку пишут несколько запросов, поэтому спаны создаются
+// задним числом для каждого из них
+func traceFlush(unitData *UnitData, batchSize int, popped, synced, flushed time.Time, err error) {
+	if !unitData.SpanContext.IsValid() {
+		return
+	}
+
+	ctx := trace.ContextWithSpanContext(context.Background(), unitData.SpanContext)
+	_, wait := tracing.Start(ctx, "wal.buffer_wait", trace.WithTimestamp(unitData.Pushed))
+	wait.End(trace.WithTimestamp(popped))
+
+	ctx, flush := tracing.Start(ctx, "wal.flush", trace.WithTimestamp(popped),
+		trace.WithAttributes(attribute.Int("wal.batch_size", batchSize)))
+	if !synced.IsZero() {
+		_, fsync := tracing.Start(ctx, "wal.fsync", trace.WithTimestamp(synced))
+		fsync.End(trace.WithTimestamp(flushed))
+	}
+	tracing.End(flush, err, trace.WithTimestamp(flushed))
+}
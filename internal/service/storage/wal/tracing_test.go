@@ -0,0 +1,53 @@
+package wal
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestWriter_FlushTracing(t *testing.T) {
+	// провайдер глобальный, поэтому спаны отбираются по трассировке запроса
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	writer := NewWriter(t.TempDir(), 1024, zap.NewNop())
+	buff := NewBuffer(1024)
+	errCh := buff.Push(ctx, &Unit{Command: "SET", Arguments: []string{"qwe", "zxc"}})
+	// запрос без трассировки попадает в ту же пачку
+	otherCh := buff.Push(context.Background(), &Unit{Command: "SET", Arguments: []string{"asd", "098"}})
+
+	go writer.Flush(context.Background(), buff)
+	require.NoError(t, <-errCh)
+	require.NoError(t, <-otherCh)
+	request.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() == request.SpanContext().TraceID() {
+			spans[span.Name()] = span
+		}
+	}
+	require.Len(t, spans, 4)
+
+	requestID := request.SpanContext().SpanID()
+	require.Equal(t, requestID, spans["wal.buffer_wait"].Parent().SpanID())
+	require.Equal(t, requestID, spans["wal.flush"].Parent().SpanID())
+	require.Equal(t, spans["wal.flush"].SpanContext().SpanID(), spans["wal.fsync"].Parent().SpanID())
+	require.False(t, spans["wal.fsync"].StartTime().Before(spans["wal.flush"].StartTime()))
+	require.False(t, spans["wal.flush"].StartTime().Before(spans["wal.buffer_wait"].EndTime()))
+
+	var batchSize int64
+	for _, attribute := range spans["wal.flush"].Attributes() {
+		if attribute.Key == "wal.batch_size" {
+			batchSize = attribute.Value.AsInt64()
+		}
+	}
+	require.Equal(t, int64(2), batchSize)
+}
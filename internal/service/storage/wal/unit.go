@@ -1,15 +1,29 @@
 package wal
 
-import "antdb/internal/service/compute"
+import (
+	"antdb/internal/service/compute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// CheckpointCommand - служебная запись: все предыдущее состояние заменяется
+// следующими за ней записями. Ее LSN - позиция журнала, которую отражает снимок.
+const CheckpointCommand = "CHECKPOINT"
 
 type Unit struct {
 	Command   string
 	Arguments []string
+	// LSN - порядковый номер записи в журнале, Term - срок лидера (для raft)
+	LSN  uint64
+	Term uint64
 }
 
 type UnitData struct {
 	Unit    *Unit
 	ErrChan chan error
+	// span запроса и время попадания в буфер, если запрос трассируется
+	SpanContext trace.SpanContext
+	Pushed      time.Time
 }
 
 func NewUnit(command compute.Command, arguments []string) *Unit {
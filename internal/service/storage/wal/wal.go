@@ -2,9 +2,15 @@ package wal
 
 import (
 	"antdb/internal/service/compute"
+	"antdb/internal/tracing"
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -12,15 +18,33 @@ type Wal struct {
 	walWriter *Writer
 	walReader *Reader
 	buffer    *buffer
+	mu        sync.Mutex
+	lsn       uint64
+	direct    bool
+	closed    bool
 	logger    *zap.Logger
+
+	// результат последней пробной записи в каталог журнала
+	probeMu  sync.Mutex
+	probedAt time.Time
+	probeErr error
+	now      func() time.Time
 }
 
+// probeInterval - как часто Writable пробует создать файл в каталоге журнала.
+// Пробы готовности приходят каждые несколько секунд, и без кэша каждая
+// создавала бы и удаляла файл рядом с сегментами
+const probeInterval = 30 * time.Second
+
+var ErrClosed = errors.New("wal is closed")
+
 func NewWAL(walWriter *Writer, walReader *Reader, buffer *buffer, logger *zap.Logger) *Wal {
 	return &Wal{
 		walWriter: walWriter,
 		walReader: walReader,
 		buffer:    buffer,
 		logger:    logger,
+		now:       time.Now,
 	}
 }
 
@@ -31,23 +55,104 @@ func (w *Wal) Start(ctx context.Context, timeout time.Duration) error {
 	}
 
 	NewWatcher(w.buffer).Watch(ctx, timeout, w.walWriter)
+
+	// при остановке запросы еще дорабатывают: их записи сразу идут на диск,
+	// пока журнал не закроют
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.direct = true
+	w.walWriter.Flush(ctx, w.buffer)
 	return nil
 }
 
-func (w *Wal) Set(ctx context.Context, key, value string) error {
-	errCh := w.buffer.Push(ctx, NewUnit(compute.SetCommand, []string{key, value}))
-	if err := <-errCh; err != nil {
-		return fmt.Errorf("can't push to buffer: %w", err)
-	}
+// Close сбрасывает оставшиеся записи на диск, после этого записи не принимаются
+func (w *Wal) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
+	w.closed = true
+	w.walWriter.Flush(context.Background(), w.buffer)
+	if err := w.walWriter.Close(); err != nil {
+		return fmt.Errorf("can't close wal segment: %w", err)
+	}
 	return nil
 }
 
-func (w *Wal) Del(ctx context.Context, key string) error {
-	errCh := w.buffer.Push(ctx, NewUnit(compute.DelCommand, []string{key}))
+// Writable проверяет, что журнал принимает записи: он не закрыт, последняя
+// запись на диск удалась и в каталоге журнала можно создать файл. Пробный
+// файл создается не чаще раза в probeInterval, между пробами возвращается
+// запомненный результат
+func (w *Wal) Writable() error {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	if err := w.walWriter.Err(); err != nil {
+		return fmt.Errorf("last write failed: %w", err)
+	}
+
+	w.probeMu.Lock()
+	defer w.probeMu.Unlock()
+
+	now := w.now()
+	if w.probedAt.IsZero() || now.Sub(w.probedAt) >= probeInterval {
+		w.probeErr = w.probeDirectory()
+		w.probedAt = now
+	}
+	return w.probeErr
+}
+
+func (w *Wal) probeDirectory() error {
+	// имя пробного файла не похоже на сегмент, читатель и сжатие его пропустят
+	probe, err := os.CreateTemp(w.walWriter.directory, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("can't create file in wal directory: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// Set записывает в журнал и возвращает LSN записи
+func (w *Wal) Set(ctx context.Context, key, value string) (uint64, error) {
+	return w.push(ctx, NewUnit(compute.SetCommand, []string{key, value}))
+}
+
+func (w *Wal) Del(ctx context.Context, key string) (uint64, error) {
+	return w.push(ctx, NewUnit(compute.DelCommand, []string{key}))
+}
+
+func (w *Wal) push(ctx context.Context, unit *Unit) (uint64, error) {
+	// LSN назначается под мьютексом, чтобы порядок в буфере совпадал с порядком номеров
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return 0, ErrClosed
+	}
+	if lastLSN := w.walReader.LastLSN(); w.lsn < lastLSN {
+		w.lsn = lastLSN
+	}
+	w.lsn++
+	unit.LSN = w.lsn
+	if w.direct {
+		defer w.mu.Unlock()
+		_, span := tracing.Start(ctx, "wal.flush", trace.WithAttributes(attribute.Int("wal.batch_size", 1)))
+		err := w.walWriter.Write([]*Unit{unit})
+		tracing.End(span, err)
+		if err != nil {
+			return 0, fmt.Errorf("can't write to wal: %w", err)
+		}
+		return unit.LSN, nil
+	}
+	errCh := w.buffer.Push(ctx, unit)
+	w.mu.Unlock()
+
 	if err := <-errCh; err != nil {
-		return fmt.Errorf("can't push to buffer: %w", err)
+		return 0, fmt.Errorf("can't push to buffer: %w", err)
 	}
 
-	return nil
+	return unit.LSN, nil
 }
@@ -0,0 +1,120 @@
+package wal
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWal_LSN(t *testing.T) {
+	tempDir := t.TempDir()
+	writer := NewWriter(tempDir, 1024, zap.NewNop())
+	err := writer.Write([]*Unit{{Command: "SET", Arguments: []string{"a", "1"}, LSN: 5}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := NewReader(tempDir, zap.NewNop())
+	journal := NewWAL(NewWriter(tempDir, 1024, zap.NewNop()), reader, NewBuffer(1), zap.NewNop())
+	go func() {
+		require.NoError(t, journal.Start(ctx, 10*time.Millisecond))
+	}()
+	for range reader.GetStream() {
+	}
+
+	lsn, err := journal.Set(ctx, "b", "2")
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), lsn)
+
+	lsn, err = journal.Del(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), lsn)
+}
+
+func TestWal_Stop(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	reader := NewReader(tempDir, zap.NewNop())
+	// буфер и таймаут большие: запись попадет на диск только при остановке
+	journal := NewWAL(NewWriter(tempDir, 1024, zap.NewNop()), reader, NewBuffer(100), zap.NewNop())
+	stopped := make(chan error)
+	go func() {
+		stopped <- journal.Start(ctx, time.Hour)
+	}()
+	for range reader.GetStream() {
+	}
+
+	written := make(chan error)
+	go func() {
+		_, err := journal.Set(context.Background(), "a", "1")
+		written <- err
+	}()
+
+	// ждем, пока запись попадет в буфер
+	require.Eventually(t, func() bool {
+		journal.buffer.mu.Lock()
+		defer journal.buffer.mu.Unlock()
+		return len(journal.buffer.values) == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-stopped)
+	require.NoError(t, <-written)
+
+	// до закрытия записи идут на диск сразу
+	lsn, err := journal.Set(context.Background(), "b", "2")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lsn)
+
+	lastLSN, err := GetLastLSN(tempDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lastLSN)
+
+	require.NoError(t, journal.Close())
+	_, err = journal.Set(context.Background(), "c", "3")
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestWal_Writable(t *testing.T) {
+	tempDir := t.TempDir()
+	journal := NewWAL(NewWriter(tempDir, 1024, zap.NewNop()), NewReader(tempDir, zap.NewNop()), NewBuffer(1), zap.NewNop())
+	require.NoError(t, journal.Writable())
+
+	// пробный файл не остается в каталоге журнала
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, journal.Close())
+	require.ErrorIs(t, journal.Writable(), ErrClosed)
+}
+
+func TestWal_WritableCachesProbe(t *testing.T) {
+	tempDir := t.TempDir()
+	journal := NewWAL(NewWriter(tempDir, 1024, zap.NewNop()), NewReader(tempDir, zap.NewNop()), NewBuffer(1), zap.NewNop())
+	now := time.Now()
+	journal.now = func() time.Time { return now }
+	require.NoError(t, journal.Writable())
+
+	// до конца интервала каталог не проверяется повторно
+	require.NoError(t, os.Remove(tempDir))
+	require.NoError(t, journal.Writable())
+
+	now = now.Add(probeInterval)
+	require.Error(t, journal.Writable())
+
+	// ошибка тоже запоминается до следующей пробы
+	require.NoError(t, os.Mkdir(tempDir, 0o755))
+	require.Error(t, journal.Writable())
+
+	now = now.Add(probeInterval)
+	require.NoError(t, journal.Writable())
+
+	require.NoError(t, journal.Close())
+	require.ErrorIs(t, journal.Writable(), ErrClosed)
+}
@@ -8,6 +8,7 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"path"
+	"sync"
 	"time"
 )
 
@@ -16,17 +17,30 @@ type Writer struct {
 	file               *os.File
 	maxSegmentSize     int
 	currentSegmentSize int
-	logger             *zap.Logger
+	mu                 sync.Mutex
+	notify             chan struct{}
+	// lastErr - ошибка последней записи, nil - запись удалась
+	lastErr error
+	logger  *zap.Logger
 }
 
 func NewWriter(dir string, maxSegmentSize int, logger *zap.Logger) *Writer {
 	return &Writer{
 		directory:      dir,
 		maxSegmentSize: maxSegmentSize,
+		notify:         make(chan struct{}),
 		logger:         logger,
 	}
 }
 
+// Notify возвращает канал, который закроется после следующей записи на диск
+func (w *Writer) Notify() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.notify
+}
+
 func (w *Writer) Flush(_ context.Context, buff *buffer) {
 	walBuffer := buff.PopAll()
 	if len(walBuffer) == 0 {
@@ -37,29 +51,55 @@ func (w *Writer) Flush(_ context.Context, buff *buffer) {
 	for _, unitData := range walBuffer {
 		units = append(units, unitData.Unit)
 	}
-	err := w.Write(units)
+	popped := time.Now()
+	synced, err := w.write(units)
+	w.setLastErr(err)
+	flushed := time.Now()
 	for _, unitData := range walBuffer {
+		traceFlush(unitData, len(units), popped, synced, flushed, err)
 		unitData.ErrChan <- err
 	}
 }
 
 func (w *Writer) Write(unitsData []*Unit) error {
+	_, err := w.write(unitsData)
+	w.setLastErr(err)
+	return err
+}
+
+// Err возвращает ошибку последней записи на диск
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastErr
+}
+
+func (w *Writer) setLastErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastErr = err
+}
+
+// write возвращает время начала fsync для трассировки, если до него дошло
+func (w *Writer) write(unitsData []*Unit) (time.Time, error) {
 	if w.file == nil {
 		err := w.createNewSegment()
 		if err != nil {
-			return fmt.Errorf("can't create new segment: %w", err)
+			return time.Time{}, fmt.Errorf("can't create new segment: %w", err)
 		}
 	}
 
 	if w.currentSegmentSize >= w.maxSegmentSize {
 		err := w.file.Close()
 		if err != nil {
-			return fmt.Errorf("can't close file: %w", err)
+			return time.Time{}, fmt.Errorf("can't close file: %w", err)
 		}
 
 		err = w.createNewSegment()
 		if err != nil {
-			return fmt.Errorf("can't create new segment: %w", err)
+			return time.Time{}, fmt.Errorf("can't create new segment: %w", err)
 		}
 	}
 
@@ -67,20 +107,40 @@ func (w *Writer) Write(unitsData []*Unit) error {
 	encoder := gob.NewEncoder(&buf)
 	err := encoder.Encode(&unitsData)
 	if err != nil {
-		return fmt.Errorf("can't encode data: %w", err)
+		return time.Time{}, fmt.Errorf("can't encode data: %w", err)
 	}
 	bufSize, err := w.file.Write(buf.Bytes())
 	if err != nil {
-		return fmt.Errorf("can't write data: %w", err)
+		return time.Time{}, fmt.Errorf("can't write data: %w", err)
 	}
 
+	start := time.Now()
 	err = w.file.Sync()
 	if err != nil {
-		return fmt.Errorf("can't sync file: %w", err)
+		return start, fmt.Errorf("can't sync file: %w", err)
 	}
+	fsyncDuration.Observe(time.Since(start).Seconds())
+	flushBatchSize.Observe(float64(len(unitsData)))
 	w.currentSegmentSize += bufSize
 
-	return nil
+	// будим тех, кто ждет записи через Notify
+	w.mu.Lock()
+	close(w.notify)
+	w.notify = make(chan struct{})
+	w.mu.Unlock()
+
+	return start, nil
+}
+
+// Close закрывает текущий сегмент, следующая запись начнет новый
+func (w *Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
 }
 
 func (w *Writer) createNewSegment() error {
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage/wal"
+	"context"
+	"strings"
+	"sync"
+)
+
+// watchBufferSize - сколько событий может накопить подписчик. Отстающего
+// сильнее подписчика отключают, чтобы запись не ждала медленного клиента
+const watchBufferSize = 1024
+
+// Event - изменение ключа. Value пусто для DEL
+type Event struct {
+	Command compute.Command
+	Key     string
+	Value   string
+	LSN     uint64
+}
+
+// KeyspacePrefix - начало имени канала событий ключа, см. KeyspaceChannel
+const KeyspacePrefix = "__keyspace__/"
+
+// Publisher рассылает сообщение подписчикам канала
+type Publisher interface {
+	Publish(channel, payload string) int
+}
+
+// KeyspaceChannel - канал, в который публикуются события ключа: "set" или "del"
+func KeyspaceChannel(key string) string {
+	return KeyspacePrefix + key
+}
+
+// KeyFromChannel возвращает ключ, если channel - канал событий ключа
+func KeyFromChannel(channel string) (string, bool) {
+	return strings.CutPrefix(channel, KeyspacePrefix)
+}
+
+type watcher struct {
+	match  func(key string) bool
+	events chan Event
+}
+
+type watchers struct {
+	mu   sync.Mutex
+	list map[*watcher]struct{}
+}
+
+// Watch подписывается на изменения ключей, для которых match возвращает true.
+// Канал закрывается после отмены ctx или если подписчик не успевает читать
+// события
+func (e *Storage) Watch(ctx context.Context, match func(key string) bool) <-chan Event {
+	w := &watcher{
+		match:  match,
+		events: make(chan Event, watchBufferSize),
+	}
+
+	e.watchers.mu.Lock()
+	e.watchers.list[w] = struct{}{}
+	e.watchers.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		e.watchers.mu.Lock()
+		defer e.watchers.mu.Unlock()
+
+		if _, ok := e.watchers.list[w]; ok {
+			delete(e.watchers.list, w)
+			close(w.events)
+		}
+	})
+
+	return w.events
+}
+
+func (e *Storage) notify(event Event) {
+	e.notifyWatchers(event)
+
+	if e.publisher != nil {
+		e.publisher.Publish(KeyspaceChannel(event.Key), strings.ToLower(string(event.Command)))
+	}
+}
+
+func (e *Storage) notifyWatchers(event Event) {
+	e.watchers.mu.Lock()
+	defer e.watchers.mu.Unlock()
+
+	for w := range e.watchers.list {
+		if !w.match(event.Key) {
+			continue
+		}
+
+		select {
+		case w.events <- event:
+		default:
+			delete(e.watchers.list, w)
+			close(w.events)
+		}
+	}
+}
+
+func (e *Storage) notifyUnit(unit *wal.Unit) {
+	switch unit.Command {
+	case string(compute.SetCommand):
+		e.notify(Event{Command: compute.SetCommand, Key: unit.Arguments[0], Value: unit.Arguments[1], LSN: unit.LSN})
+	case string(compute.DelCommand):
+		e.notify(Event{Command: compute.DelCommand, Key: unit.Arguments[0], LSN: unit.LSN})
+	}
+}
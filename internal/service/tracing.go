@@ -0,0 +1,78 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"antdb/internal/service/compute"
+	"antdb/internal/service/storage"
+	"antdb/internal/tracing"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// parseQuery разбирает запрос и открывает его span, который закрывает
+// вызывающий. Родитель span может прийти в модификаторе TRACEPARENT,
+// поэтому span открывается после разбора, а parse и analyze пишутся задним числом
+func (d *Database) parseQuery(ctx context.Context, queryStr string) (context.Context, trace.Span, *compute.Query, error) {
+	start := time.Now()
+	tokens, parseErr := d.compute.Parse(queryStr)
+	parsed := time.Now()
+
+	var query *compute.Query
+	var err error
+	if parseErr == nil {
+		query, err = d.compute.Analyze(tokens)
+	}
+	analyzed := time.Now()
+
+	if query != nil {
+		if traceParent, ok := query.GetModifier(compute.TraceParentModifier); ok {
+			ctx = tracing.ExtractTraceParent(ctx, traceParent[0])
+		}
+	}
+
+	ctx, span := startQuerySpan(ctx, query, start)
+	if span.IsRecording() {
+		_, parseSpan := tracing.Start(ctx, "parse", trace.WithTimestamp(start))
+		tracing.End(parseSpan, parseErr, trace.WithTimestamp(parsed))
+		if parseErr == nil {
+			_, analyzeSpan := tracing.Start(ctx, "analyze", trace.WithTimestamp(parsed))
+			tracing.End(analyzeSpan, err, trace.WithTimestamp(analyzed))
+		}
+	}
+
+	if parseErr != nil {
+		return ctx, span, nil, parseErr
+	}
+	return ctx, span, query, err
+}
+
+// startQuerySpan открывает span запроса, query == nil - запрос не разобран
+func startQuerySpan(ctx context.Context, query *compute.Query, start time.Time) (context.Context, trace.Span) {
+	name := "query"
+	if query != nil {
+		name = string(query.GetCommand())
+	}
+
+	ctx, span := tracing.Start(ctx, name, trace.WithTimestamp(start), trace.WithSpanKind(trace.SpanKindServer))
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("db.system", "antdb"))
+		if query != nil {
+			span.SetAttributes(attribute.String("db.operation", string(query.GetCommand())))
+		}
+		if addr := network.ClientAddr(ctx); addr != "" {
+			span.SetAttributes(attribute.String("client.address", addr))
+		}
+	}
+	return ctx, span
+}
+
+// endQuerySpan закрывает span запроса. Отсутствие ключа - обычный ответ, а не ошибка
+func endQuerySpan(span trace.Span, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
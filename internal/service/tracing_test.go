@@ -0,0 +1,61 @@
+package service
+
+import (
+	"antdb/internal/network"
+	"context"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestDatabase_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	db := newTestDatabase(t, nil)
+	ctx := network.WithClientAddr(network.WithSession(context.Background(), network.NewSession()), "127.0.0.1:50000")
+
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	require.Equal(t, "[ok]", db.HandleQuery(ctx, "SET key value TRACEPARENT "+traceParent))
+	require.Equal(t, "[error] not found", db.HandleQuery(ctx, "GET missing TRACEPARENT "+traceParent))
+	require.Equal(t, "[error] slowlog is not enabled", db.HandleQuery(ctx, "SLOWLOG GET TRACEPARENT "+traceParent))
+	// без TRACEPARENT запрос начинает свою трассировку
+	require.Equal(t, "[ok] value", db.HandleQuery(ctx, "GET key"))
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	remoteID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	roots := make(map[string]sdktrace.ReadOnlySpan)
+	children := make(map[trace.SpanID][]string)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != traceID {
+			continue
+		}
+		if span.Parent().SpanID() == remoteID {
+			require.True(t, span.Parent().IsRemote())
+			roots[span.Name()] = span
+			continue
+		}
+		children[span.Parent().SpanID()] = append(children[span.Parent().SpanID()], span.Name())
+	}
+	require.Len(t, roots, 3)
+
+	set := roots["SET"]
+	require.Equal(t, trace.SpanKindServer, set.SpanKind())
+	require.Equal(t, codes.Unset, set.Status().Code)
+	require.ElementsMatch(t, []string{"parse", "analyze", "engine.apply"}, children[set.SpanContext().SpanID()])
+
+	// отсутствие ключа не считается ошибкой
+	require.Equal(t, codes.Unset, roots["GET"].Status().Code)
+
+	slowLog := roots["SLOWLOG"]
+	require.Equal(t, codes.Error, slowLog.Status().Code)
+	require.Equal(t, "slowlog is not enabled", slowLog.Status().Description)
+	require.ElementsMatch(t, []string{"parse", "analyze"}, children[slowLog.SpanContext().SpanID()])
+}
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := map[string]struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		"exact":               {pattern: "key", key: "key", match: true},
+		"exact mismatch":      {pattern: "key", key: "key1"},
+		"any":                 {pattern: "*", key: "users/1", match: true},
+		"prefix":              {pattern: "public_*", key: "public_key", match: true},
+		"prefix mismatch":     {pattern: "public_*", key: "private_key"},
+		"suffix":              {pattern: "*_tmp", key: "cache_tmp", match: true},
+		"middle":              {pattern: "users/*/name", key: "users/1/name", match: true},
+		"middle mismatch":     {pattern: "users/*/name", key: "users/1/email"},
+		"overlapping parts":   {pattern: "a*a", key: "a"},
+		"several wildcards":   {pattern: "*x*x", key: "xx", match: true},
+		"empty wildcard part": {pattern: "ab*", key: "ab", match: true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, test.match, MatchPattern(test.pattern, test.key))
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"os"
+	"sync"
+)
+
+const serviceName = "antdb"
+
+// NewProvider создает провайдер, который отправляет спаны в exporter пачками.
+// sampleRatio - доля записываемых трассировок, если клиент не передал свое
+// решение в контексте трассировки
+func NewProvider(exporter sdktrace.SpanExporter, sampleRatio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
+
+// NewStdoutExporter пишет спаны в w в формате JSON экспортера stdouttrace
+func NewStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, fmt.Errorf("can't create stdout exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// NewFileExporter дописывает спаны в файл в формате OTLP JSON: по строке
+// TracesData на каждую отправку. Такой файл читает filereceiver коллектора
+func NewFileExporter(ctx context.Context, filename string) (sdktrace.SpanExporter, error) {
+	exporter, err := otlptrace.New(ctx, &fileClient{filename: filename})
+	if err != nil {
+		return nil, fmt.Errorf("can't create otlp file exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// fileClient - клиент otlptrace, который вместо отправки коллектору пишет в файл
+type fileClient struct {
+	filename string
+	mu       sync.Mutex
+	file     *os.File
+}
+
+func (c *fileClient) Start(_ context.Context) error {
+	file, err := os.OpenFile(c.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("can't open traces file: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.file = file
+	return nil
+}
+
+func (c *fileClient) Stop(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *fileClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	line, err := marshalOTLP(&tracepb.TracesData{ResourceSpans: spans})
+	if err != nil {
+		return fmt.Errorf("can't encode spans: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return os.ErrClosed
+	}
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
+
+// idFields - поля с идентификаторами трассировки и спанов
+var idFields = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+// marshalOTLP кодирует данные в OTLP JSON. В отличие от обычного protojson
+// идентификаторы в нем записываются в hex, а перечисления - числами
+func marshalOTLP(data *tracepb.TracesData) ([]byte, error) {
+	encoded, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var document any
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err = decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if err = hexIDs(document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func hexIDs(value any) error {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if id, ok := field.(string); ok && idFields[key] {
+				raw, err := base64.StdEncoding.DecodeString(id)
+				if err != nil {
+					return fmt.Errorf("can't decode %s: %w", key, err)
+				}
+				value[key] = hex.EncodeToString(raw)
+				continue
+			}
+			if err := hexIDs(field); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range value {
+			if err := hexIDs(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFileExporter(t *testing.T) {
+	t.Parallel()
+
+	filename := path.Join(t.TempDir(), "traces.jsonl")
+	exporter, err := NewFileExporter(context.Background(), filename)
+	require.NoError(t, err)
+	provider := NewProvider(exporter, 1)
+
+	ctx := ExtractTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := provider.Tracer("test").Start(ctx, "SET")
+	_, child := provider.Tracer("test").Start(ctx, "engine.apply")
+	child.End()
+	parent.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	// поля OTLP JSON, которые проверяет тест
+	type otlpSpan struct {
+		TraceID      string `json:"traceId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Kind         int    `json:"kind"`
+	}
+	type otlpTraces struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+
+	spans := make(map[string]otlpSpan)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var data otlpTraces
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &data))
+		for _, resourceSpans := range data.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, spans, 2)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans["SET"].TraceID)
+	require.Equal(t, "00f067aa0ba902b7", spans["SET"].ParentSpanID)
+	require.Equal(t, parent.SpanContext().SpanID().String(), spans["engine.apply"].ParentSpanID)
+	// SPAN_KIND_INTERNAL
+	require.Equal(t, 1, spans["SET"].Kind)
+}
+
+func TestStdoutExporter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	exporter, err := NewStdoutExporter(&buf)
+	require.NoError(t, err)
+	provider := NewProvider(exporter, 1)
+
+	_, span := provider.Tracer("test").Start(context.Background(), "GET")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	require.Contains(t, buf.String(), `"Name":"GET"`)
+}
+
+func TestExtractTraceParent(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		traceParent string
+		valid       bool
+		sampled     bool
+	}{
+		"sampled": {
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			valid:       true,
+			sampled:     true,
+		},
+		"not sampled": {
+			traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			valid:       true,
+		},
+		"zero trace id": {
+			traceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		},
+		"malformed": {
+			traceParent: "not-a-trace-parent",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			spanContext := trace.SpanContextFromContext(ExtractTraceParent(context.Background(), test.traceParent))
+			require.Equal(t, test.valid, spanContext.IsValid())
+			require.Equal(t, test.sampled, spanContext.IsSampled())
+			require.Equal(t, test.valid, spanContext.IsRemote())
+		})
+	}
+}
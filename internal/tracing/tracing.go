@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Имена заголовка HTTP и метаданных gRPC, в которых клиент передает контекст трассировки
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// Пока провайдер не задан через otel.SetTracerProvider, спаны ничего не пишут
+var tracer = otel.Tracer("antdb")
+
+// propagator разбирает контекст трассировки в формате W3C Trace Context
+var propagator = propagation.TraceContext{}
+
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, options...)
+}
+
+// End завершает span и отмечает в нем ошибку, если она есть
+func End(span trace.Span, err error, options ...trace.SpanEndOption) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(options...)
+}
+
+// Extract продолжает трассировку клиента, переданную в заголовках.
+// Некорректный контекст игнорируется
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// ExtractTraceParent продолжает трассировку клиента по значению traceparent,
+// например "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+func ExtractTraceParent(ctx context.Context, traceParent string) context.Context {
+	return Extract(ctx, propagation.MapCarrier{TraceParentHeader: traceParent})
+}
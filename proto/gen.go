@@ -1,3 +1,4 @@
 package proto
 
 //go:generate protoc --go_out=. replica.proto
+//go:generate protoc --go_out=. --go-grpc_out=. kv.proto